@@ -0,0 +1,195 @@
+package cacheevict
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// defaultTopN is the number of entries dumped when the request does not specify one.
+const defaultTopN = 10
+
+// AdminHandler is an http.Handler exposing the registered named caches
+// for inspection and manipulation. All responses are JSON encoded.
+//
+//	GET    /caches                     list the stats of all caches
+//	GET    /caches/{name}              get the stats of a cache
+//	GET    /caches/{name}/entries?n=10 dump the top-n entries in retention order
+//	GET    /caches/{name}/keys/{key}   look up a key without refreshing it
+//	DELETE /caches/{name}/keys/{key}   delete a key
+//	POST   /caches/{name}/purge        remove all entries
+//	PUT    /caches/{name}/capacity     resize the cache, body: {"capacity": n}
+//
+// Mount it under a prefix with http.StripPrefix if needed.
+type AdminHandler struct {
+	mu     sync.RWMutex
+	caches map[string]Inspectable
+	mux    *http.ServeMux
+}
+
+// NamedStats is the stats of a registered cache.
+type NamedStats struct {
+	Name string `json:"name"`
+	Stats
+}
+
+// Entry is a cache entry dumped by the AdminHandler.
+type Entry struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// NewAdminHandler creates an AdminHandler without any registered cache.
+func NewAdminHandler() *AdminHandler {
+	h := &AdminHandler{
+		caches: make(map[string]Inspectable),
+		mux:    http.NewServeMux(),
+	}
+	h.mux.HandleFunc("GET /caches", h.list)
+	h.mux.HandleFunc("GET /caches/{name}", h.withCache(h.stats))
+	h.mux.HandleFunc("GET /caches/{name}/entries", h.withCache(h.entries))
+	h.mux.HandleFunc("GET /caches/{name}/keys/{key...}", h.withCache(h.get))
+	h.mux.HandleFunc("DELETE /caches/{name}/keys/{key...}", h.withCache(h.remove))
+	h.mux.HandleFunc("POST /caches/{name}/purge", h.withCache(h.purge))
+	h.mux.HandleFunc("PUT /caches/{name}/capacity", h.withCache(h.resize))
+	return h
+}
+
+// Register exposes the cache under the given name.
+// It panics if the name is already registered.
+func (h *AdminHandler) Register(name string, c Inspectable) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.caches[name]; ok {
+		panic("cache already registered: " + name)
+	}
+	h.caches[name] = c
+}
+
+// Unregister removes the cache with the given name from the handler.
+func (h *AdminHandler) Unregister(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.caches, name)
+}
+
+// ServeHTTP implements http.Handler.
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *AdminHandler) list(w http.ResponseWriter, _ *http.Request) {
+	h.mu.RLock()
+	res := make([]NamedStats, 0, len(h.caches))
+	for name, c := range h.caches {
+		res = append(res, NamedStats{Name: name, Stats: c.Stats()})
+	}
+	h.mu.RUnlock()
+
+	slices.SortFunc(res, func(a, b NamedStats) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (h *AdminHandler) stats(w http.ResponseWriter, r *http.Request, c Inspectable) {
+	writeJSON(w, http.StatusOK, NamedStats{Name: r.PathValue("name"), Stats: c.Stats()})
+}
+
+func (h *AdminHandler) entries(w http.ResponseWriter, r *http.Request, c Inspectable) {
+	n := defaultTopN
+	if s := r.URL.Query().Get("n"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v <= 0 {
+			writeError(w, http.StatusBadRequest, "n must be a positive integer")
+			return
+		}
+		n = v
+	}
+
+	res := make([]Entry, 0, min(n, c.Len()))
+	c.Range(func(key string, value any) bool {
+		res = append(res, Entry{Key: key, Value: marshalValue(value)})
+		return len(res) < n
+	})
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (h *AdminHandler) get(w http.ResponseWriter, r *http.Request, c Inspectable) {
+	key := r.PathValue("key")
+	value, ok := c.Peek(key)
+	if !ok {
+		writeError(w, http.StatusNotFound, "key not found: "+key)
+		return
+	}
+	writeJSON(w, http.StatusOK, Entry{Key: key, Value: marshalValue(value)})
+}
+
+func (h *AdminHandler) remove(w http.ResponseWriter, r *http.Request, c Inspectable) {
+	key := r.PathValue("key")
+	if !c.Remove(key) {
+		writeError(w, http.StatusNotFound, "key not found: "+key)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AdminHandler) purge(w http.ResponseWriter, _ *http.Request, c Inspectable) {
+	c.Purge()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AdminHandler) resize(w http.ResponseWriter, r *http.Request, c Inspectable) {
+	var req struct {
+		Capacity int `json:"capacity"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+	if req.Capacity <= 0 {
+		writeError(w, http.StatusBadRequest, "capacity must be greater than 0")
+		return
+	}
+	evicted := c.Resize(req.Capacity)
+	writeJSON(w, http.StatusOK, map[string]int{"evicted": evicted})
+}
+
+// withCache resolves the cache named in the path before calling fn.
+func (h *AdminHandler) withCache(fn func(http.ResponseWriter, *http.Request, Inspectable)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		h.mu.RLock()
+		c, ok := h.caches[name]
+		h.mu.RUnlock()
+		if !ok {
+			writeError(w, http.StatusNotFound, "cache not found: "+name)
+			return
+		}
+		fn(w, r, c)
+	}
+}
+
+// marshalValue encodes a cached value as JSON,
+// falling back to its string form for values JSON cannot represent.
+func marshalValue(value any) json.RawMessage {
+	b, err := json.Marshal(value)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprint(value))
+	}
+	return b
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
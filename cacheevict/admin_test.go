@@ -0,0 +1,134 @@
+package cacheevict
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serve(h http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return rec
+}
+
+func TestAdminHandler_Register(t *testing.T) {
+	h := NewAdminHandler()
+	h.Register("users", NewLRUCache(1))
+	assert.Panics(t, func() { h.Register("users", NewLRUCache(1)) })
+
+	h.Unregister("users")
+	assert.Equal(t, http.StatusNotFound, serve(h, http.MethodGet, "/caches/users", "").Code)
+}
+
+func TestAdminHandler_Stats(t *testing.T) {
+	lru := NewLRUCache(4)
+	lru.Add("a", 1)
+	lru.Add("b", 2)
+	h := NewAdminHandler()
+	h.Register("users", lru)
+	h.Register("sessions", NewFIFOCache(2))
+	lru.Get("a")
+	lru.Get("missing")
+
+	rec := serve(h, http.MethodGet, "/caches", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var list []NamedStats
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	assert.Equal(t, []NamedStats{
+		{Name: "sessions", Stats: Stats{Capacity: 2}},
+		{Name: "users", Stats: Stats{Len: 2, Capacity: 4, Hits: 1, Misses: 1}},
+	}, list)
+
+	rec = serve(h, http.MethodGet, "/caches/users", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"name":"users","len":2,"capacity":4,"hits":1,"misses":1,"evictions":0,"expirations":0,"rejections":0}`, rec.Body.String())
+
+	rec = serve(h, http.MethodGet, "/caches/unknown", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.JSONEq(t, `{"error":"cache not found: unknown"}`, rec.Body.String())
+}
+
+func TestAdminHandler_Keys(t *testing.T) {
+	lru := NewLRUCache(4)
+	lru.Add("a", 1)
+	lru.Add("c/d", []int{3})
+	lru.Add("fn", func() {})
+	h := NewAdminHandler()
+	h.Register("users", lru)
+
+	rec := serve(h, http.MethodGet, "/caches/users/keys/c/d", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"key":"c/d","value":[3]}`, rec.Body.String())
+
+	// values JSON cannot encode fall back to their string form
+	rec = serve(h, http.MethodGet, "/caches/users/keys/fn", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var entry Entry
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &entry))
+	assert.True(t, strings.HasPrefix(string(entry.Value), `"0x`))
+
+	// looking up a key must not count as an access
+	assert.Equal(t, uint64(0), lru.Stats().Hits)
+
+	assert.Equal(t, http.StatusNotFound, serve(h, http.MethodGet, "/caches/users/keys/x", "").Code)
+
+	assert.Equal(t, http.StatusNoContent, serve(h, http.MethodDelete, "/caches/users/keys/a", "").Code)
+	assert.Equal(t, http.StatusNotFound, serve(h, http.MethodDelete, "/caches/users/keys/a", "").Code)
+	_, found := lru.Peek("a")
+	assert.False(t, found)
+}
+
+func TestAdminHandler_Entries(t *testing.T) {
+	lru := NewLRUCache(4)
+	lru.Add("a", 1)
+	lru.Add("b", "two")
+	lru.Add("c", 3)
+	h := NewAdminHandler()
+	h.Register("users", lru)
+	lru.Get("a")
+
+	rec := serve(h, http.MethodGet, "/caches/users/entries?n=2", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var entries []Entry
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &entries))
+	require.Len(t, entries, 2)
+	assert.Equal(t, Entry{Key: "a", Value: json.RawMessage("1")}, entries[0])
+	assert.Equal(t, Entry{Key: "c", Value: json.RawMessage("3")}, entries[1])
+
+	rec = serve(h, http.MethodGet, "/caches/users/entries", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &entries))
+	assert.Len(t, entries, 3)
+
+	rec = serve(h, http.MethodGet, "/caches/users/entries?n=0", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestAdminHandler_PurgeAndResize(t *testing.T) {
+	lru := NewLRUCache(4)
+	for _, key := range []string{"a", "b", "c", "d"} {
+		lru.Add(key, 1)
+	}
+	h := NewAdminHandler()
+	h.Register("users", lru)
+
+	rec := serve(h, http.MethodPut, "/caches/users/capacity", `{"capacity":2}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"evicted":2}`, rec.Body.String())
+	assert.Equal(t, 2, lru.Stats().Capacity)
+
+	assert.Equal(t, http.StatusBadRequest, serve(h, http.MethodPut, "/caches/users/capacity", `{"capacity":0}`).Code)
+	assert.Equal(t, http.StatusBadRequest, serve(h, http.MethodPut, "/caches/users/capacity", `oops`).Code)
+
+	assert.Equal(t, http.StatusNoContent, serve(h, http.MethodPost, "/caches/users/purge", "").Code)
+	assert.Equal(t, 0, lru.Len())
+
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(h, http.MethodGet, "/caches/users/purge", "").Code)
+}
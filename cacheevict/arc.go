@@ -13,6 +13,7 @@ type ARCCache struct {
 	p                  int
 	t1, t2, b1, b2     *list.List
 	t1m, t2m, b1m, b2m map[string]*list.Element
+	base
 }
 
 func NewARCCache(size int) *ARCCache {
@@ -37,22 +38,132 @@ func (c *ARCCache) Len() int {
 }
 
 func (c *ARCCache) Get(key string) (any, bool) {
+	defer c.flush()
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	if item := c.cached(key); item != nil && item.expired(c.now()) {
+		c.removeCached(key, EventExpire)
+		c.access(key, nil, false)
+		return nil, false
+	}
 	el, ok := c.lookup(key)
 	if !ok {
+		c.access(key, nil, false)
 		return nil, false
 	}
-	return el.Value.(*cacheItem).value, true
+	value := el.Value.(*cacheItem).value
+	c.access(key, value, true)
+	return value, true
+}
+
+// Peek returns the value of a cached key without adapting the cache.
+func (c *ARCCache) Peek(key string) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if item := c.cached(key); item != nil && !item.expired(c.now()) {
+		return item.value, true
+	}
+	return nil, false
+}
+
+// Remove deletes the key from the cache and its ghost lists,
+// and reports whether it was cached.
+func (c *ARCCache) Remove(key string) bool {
+	defer c.flush()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := c.removeCached(key, EventRemove)
+	c.removeFrom(c.b1, c.b1m, key)
+	c.removeFrom(c.b2, c.b2m, key)
+	return removed
+}
+
+// Purge removes all entries and ghost entries from the cache.
+func (c *ARCCache) Purge() {
+	defer c.flush()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, l := range []*list.List{c.t2, c.t1} {
+		for el := l.Front(); el != nil; el = el.Next() {
+			item := el.Value.(*cacheItem)
+			c.observe(EventRemove, item.key, item.value)
+		}
+	}
+	c.p = 0
+	for _, l := range []*list.List{c.t1, c.t2, c.b1, c.b2} {
+		l.Init()
+	}
+	c.t1m = make(map[string]*list.Element)
+	c.t2m = make(map[string]*list.Element)
+	c.b1m = make(map[string]*list.Element)
+	c.b2m = make(map[string]*list.Element)
+}
+
+// Resize changes the capacity of the cache. Entries beyond the new capacity
+// are moved to the ghost lists, which are then trimmed. It returns the number
+// of evicted entries.
+func (c *ARCCache) Resize(size int) int {
+	if size <= 0 {
+		panic("capacity must be greater than 0")
+	}
+	defer c.flush()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.c = size
+	c.p = min(c.p, size)
+	evicted := 0
+	for c.t1.Len()+c.t2.Len() > c.c {
+		c.replace(false)
+		evicted++
+	}
+	for c.t1.Len()+c.b1.Len() > c.c && c.b1.Len() > 0 {
+		c.removeFrom(c.b1, c.b1m, c.b1.Back().Value.(*cacheItem).key)
+	}
+	for c.t1.Len()+c.t2.Len()+c.b1.Len()+c.b2.Len() > 2*c.c && c.b2.Len() > 0 {
+		c.removeFrom(c.b2, c.b2m, c.b2.Back().Value.(*cacheItem).key)
+	}
+	return evicted
+}
+
+// Range iterates the cached entries of t2 and then t1, each from its MRU end.
+func (c *ARCCache) Range(fn func(key string, value any) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	for _, l := range []*list.List{c.t2, c.t1} {
+		for el := l.Front(); el != nil; el = el.Next() {
+			item := el.Value.(*cacheItem)
+			if !item.expired(now) && !fn(item.key, item.value) {
+				return
+			}
+		}
+	}
+}
+
+// Stats returns a snapshot of the cache counters.
+func (c *ARCCache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.snapshot(c.t1.Len()+c.t2.Len(), c.c)
 }
 
 func (c *ARCCache) Add(key string, value any) {
+	defer c.flush()
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	el, _ := c.lookup(key)
+	el, ok := c.lookup(key)
 	if el != nil {
-		el.Value.(*cacheItem).value = value
+		item := el.Value.(*cacheItem)
+		item.value = value
+		item.expireAt = c.deadline()
+		if ok {
+			c.observe(EventUpdate, key, value)
+		} else {
+			// the key was in a ghost list and is cached again
+			c.observe(EventInsert, key, value)
+		}
 		return
 	}
 
@@ -67,7 +178,9 @@ func (c *ARCCache) Add(key string, value any) {
 		} else {
 			el := c.t1.Back()
 			c.t1.Remove(el)
-			delete(c.t1m, el.Value.(*cacheItem).key)
+			item := el.Value.(*cacheItem)
+			delete(c.t1m, item.key)
+			c.observe(EventEvict, item.key, item.value)
 		}
 	} else {
 		if c.t1.Len()+c.t2.Len()+c.b1.Len()+c.b2.Len() >= c.c {
@@ -79,8 +192,9 @@ func (c *ARCCache) Add(key string, value any) {
 			c.replacextp(key)
 		}
 	}
-	c.t1.PushFront(&cacheItem{key: key, value: value})
+	c.t1.PushFront(&cacheItem{key: key, value: value, expireAt: c.deadline()})
 	c.t1m[key] = c.t1.Front()
+	c.observe(EventInsert, key, value)
 }
 
 func (c *ARCCache) lookup(key string) (*list.Element, bool) {
@@ -147,19 +261,69 @@ func (c *ARCCache) δ2() int {
 }
 
 func (c *ARCCache) replacextp(key string) {
-	if (c.t1.Len() > 0) && (c.t1.Len() > c.p || (c.b2m[key] != nil && c.t1.Len() == c.p)) {
+	c.replace(c.b2m[key] != nil)
+}
+
+// replace evicts the LRU entry of t1 or t2 into its ghost list,
+// inB2 tells whether the key being requested is in b2.
+// Nothing is evicted while the cache has room, which happens once entries
+// have been removed or have expired.
+func (c *ARCCache) replace(inB2 bool) {
+	if c.t1.Len()+c.t2.Len() < c.c {
+		return
+	}
+	var el *list.Element
+	if (c.t1.Len() > 0) && (c.t1.Len() > c.p || (inB2 && c.t1.Len() == c.p)) {
 		// delete LRU from t1 and move to b1 MRU
-		el := c.t1.Back()
+		el = c.t1.Back()
 		c.t1.Remove(el)
 		delete(c.t1m, el.Value.(*cacheItem).key)
 		c.b1.PushFront(el.Value)
 		c.b1m[el.Value.(*cacheItem).key] = c.b1.Front()
 	} else {
 		// delete LRU from t2 and move to b2 MRU
-		el := c.t2.Back()
+		el = c.t2.Back()
 		c.t2.Remove(el)
 		delete(c.t2m, el.Value.(*cacheItem).key)
 		c.b2.PushFront(el.Value)
 		c.b2m[el.Value.(*cacheItem).key] = c.b2.Front()
 	}
+	item := el.Value.(*cacheItem)
+	c.observe(EventEvict, item.key, item.value)
+}
+
+// cached returns the item of the key if it is in t1 or t2.
+func (c *ARCCache) cached(key string) *cacheItem {
+	if el, ok := c.t1m[key]; ok {
+		return el.Value.(*cacheItem)
+	}
+	if el, ok := c.t2m[key]; ok {
+		return el.Value.(*cacheItem)
+	}
+	return nil
+}
+
+// removeCached removes the key from t1 or t2 without keeping it in a ghost list,
+// and reports whether it was cached.
+func (c *ARCCache) removeCached(key string, kind EventKind) bool {
+	item := c.cached(key)
+	if item == nil {
+		return false
+	}
+	if !c.removeFrom(c.t1, c.t1m, key) {
+		c.removeFrom(c.t2, c.t2m, key)
+	}
+	c.observe(kind, key, item.value)
+	return true
+}
+
+// removeFrom removes the key from the given list and reports whether it was there.
+func (c *ARCCache) removeFrom(l *list.List, m map[string]*list.Element, key string) bool {
+	el, ok := m[key]
+	if !ok {
+		return false
+	}
+	l.Remove(el)
+	delete(m, key)
+	return true
 }
@@ -124,3 +124,64 @@ func TestARCCache_AdjustP(t *testing.T) {
 		t.Errorf("Expected p to decrease after B2 hit, old p: %d, new p: %d", oldP, cache.p)
 	}
 }
+
+func TestARCCache_PeekRemoveAndPurge(t *testing.T) {
+	cache := NewARCCache(2)
+	cache.Add("a", 1)
+	cache.Add("b", 2)
+
+	// Peek should not promote "a" from T1 to T2
+	if value, found := cache.Peek("a"); !found || value != 1 {
+		t.Errorf("Expected to peek key 'a' with value 1, got %v", value)
+	}
+	if cache.t2.Len() != 0 {
+		t.Errorf("Expected T2 to be empty after peek, got %d", cache.t2.Len())
+	}
+
+	if !cache.Remove("a") {
+		t.Errorf("Expected 'a' to be removed")
+	}
+	if cache.Remove("a") {
+		t.Errorf("Expected removing 'a' twice to report false")
+	}
+	if cache.Len() != 1 {
+		t.Errorf("Expected cache size to be 1, got %d", cache.Len())
+	}
+
+	cache.Purge()
+	if cache.Len() != 0 || cache.b1.Len() != 0 || cache.b2.Len() != 0 || cache.p != 0 {
+		t.Errorf("Expected cache to be empty after purge")
+	}
+}
+
+func TestARCCache_ResizeAndRange(t *testing.T) {
+	cache := NewARCCache(4)
+	for i, key := range []string{"a", "b", "c", "d"} {
+		cache.Add(key, i)
+	}
+	cache.Get("a")
+
+	if evicted := cache.Resize(2); evicted != 2 {
+		t.Errorf("Expected 2 entries to be evicted, got %d", evicted)
+	}
+	if cache.Len() != 2 {
+		t.Errorf("Expected cache size to be 2, got %d", cache.Len())
+	}
+	if cache.t1.Len()+cache.b1.Len() > 2 || cache.t1.Len()+cache.t2.Len()+cache.b1.Len()+cache.b2.Len() > 4 {
+		t.Errorf("Expected ghost lists to be trimmed to the new capacity")
+	}
+
+	var keys []string
+	cache.Range(func(key string, _ any) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if len(keys) != 2 || keys[0] != "a" {
+		t.Errorf("Expected T2 entry 'a' to be ranged first, got %v", keys)
+	}
+
+	stats := cache.Stats()
+	if stats.Capacity != 2 || stats.Hits != 1 || stats.Evictions != 2 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
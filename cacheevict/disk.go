@@ -0,0 +1,555 @@
+package cacheevict
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultDiskSegmentSize is the size from which the active segment is sealed
+// and a new one is started, when none is given.
+const defaultDiskSegmentSize = 4 << 20
+
+const (
+	segmentExt = ".seg"
+
+	recordPut    byte = 1
+	recordDelete byte = 2
+
+	// recordHeaderSize is the size of the record header:
+	// crc32 (4) | kind (1) | expireAt unix nano (8) | key length (4) | value length (4)
+	recordHeaderSize = 21
+)
+
+// errCorruptRecord is returned when a record is truncated or fails its checksum.
+var errCorruptRecord = errors.New("corrupt record")
+
+// DiskCache is a cache storing its values in append-only segment files in a
+// directory, and only the keys with the location of their values in memory,
+// so it survives restarts and can hold more than the memory.
+// Entries are evicted in LRU order.
+//
+// Every Add appends a record to the active segment, which is sealed once it
+// reaches the segment size. Removed, expired and evicted entries are recorded
+// with a tombstone. The oldest segments are deleted as soon as they hold no
+// live value, and Compact rewrites the live values of all sealed segments to
+// reclaim the space of the others.
+//
+// A segment is synced to the disk when it is sealed, and the active one only by
+// Close, so the records written since may be lost on a system crash. The records
+// torn by a crash are discarded on recovery, see OpenDiskCache.
+//
+// Values are encoded with encoding/gob, so custom types must be registered
+// with gob.Register. As the Cache methods cannot return an error, the last
+// I/O or encoding error is reported by Err. The evict, expire and remove events
+// carry no value, which would have to be read from the disk.
+//
+// The expiration time set by SetTTL is recorded with the values, so the entries
+// also expire across restarts.
+type DiskCache struct {
+	mu          sync.Mutex
+	dir         string
+	capacity    int
+	segmentSize int64
+
+	index map[string]*list.Element // key -> element of order
+	order *list.List               // *diskEntry, from the most to the least recently used
+
+	ids      []uint32 // segment ids in ascending order, the last one is active
+	segments map[uint32]*segment
+
+	err error
+	base
+}
+
+type diskEntry struct {
+	key      string
+	segment  uint32
+	offset   int64
+	size     int64 // size of the whole record
+	expireAt time.Time
+}
+
+func (e *diskEntry) expired(now time.Time) bool {
+	return !e.expireAt.IsZero() && now.After(e.expireAt)
+}
+
+type segment struct {
+	id   uint32
+	file *os.File
+	size int64
+	live int64 // size of the records holding a cached value
+}
+
+// diskValue wraps the values so that gob encodes their concrete type.
+type diskValue struct {
+	V any
+}
+
+// OpenDiskCache opens the cache stored in dir, creating the directory if needed,
+// and recovers its entries. Records that are truncated or fail their checksum,
+// as left by a crash during a write, are discarded with the rest of their segment.
+// segmentSize defaults to 4 MiB.
+// It panics if the capacity is less than or equal to 0.
+func OpenDiskCache(dir string, capacity int, segmentSize ...int64) (*DiskCache, error) {
+	if capacity <= 0 {
+		panic("capacity must be greater than 0")
+	}
+	size := int64(defaultDiskSegmentSize)
+	if len(segmentSize) > 0 && segmentSize[0] > 0 {
+		size = segmentSize[0]
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+
+	c := &DiskCache{
+		dir:         dir,
+		capacity:    capacity,
+		segmentSize: size,
+		index:       make(map[string]*list.Element),
+		order:       list.New(),
+		segments:    make(map[uint32]*segment),
+	}
+	if err := c.recover(); err != nil {
+		return nil, errors.Join(err, c.closeFiles())
+	}
+	for c.order.Len() > c.capacity {
+		c.evict()
+	}
+	if c.err != nil {
+		return nil, errors.Join(c.err, c.closeFiles())
+	}
+	return c, nil
+}
+
+func (c *DiskCache) Add(key string, value any) {
+	defer c.flush()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(diskValue{V: value}); err != nil {
+		c.err = err
+		return
+	}
+	expireAt := c.deadline()
+	s, offset, size, err := c.append(recordPut, key, buf.Bytes(), expireAt)
+	if err != nil {
+		c.err = err
+		return
+	}
+	s.live += size
+
+	if el, ok := c.index[key]; ok {
+		e := el.Value.(*diskEntry)
+		c.segments[e.segment].live -= e.size
+		e.segment, e.offset, e.size, e.expireAt = s.id, offset, size, expireAt
+		c.order.MoveToFront(el)
+		c.observe(EventUpdate, key, value)
+		return
+	}
+	if c.order.Len() >= c.capacity {
+		c.evict()
+	}
+	c.index[key] = c.order.PushFront(&diskEntry{
+		key:      key,
+		segment:  s.id,
+		offset:   offset,
+		size:     size,
+		expireAt: expireAt,
+	})
+	c.observe(EventInsert, key, value)
+}
+
+func (c *DiskCache) Get(key string) (any, bool) {
+	defer c.flush()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.index[key]
+	if ok && el.Value.(*diskEntry).expired(c.now()) {
+		c.remove(el, EventExpire)
+		ok = false
+	}
+	var value any
+	if ok {
+		value, ok = c.read(el.Value.(*diskEntry))
+	}
+	if !ok {
+		c.access(key, nil, false)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	c.access(key, value, true)
+	return value, true
+}
+
+// Peek returns the value of the key without marking it as recently used.
+func (c *DiskCache) Peek(key string) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.index[key]
+	if !ok || el.Value.(*diskEntry).expired(c.now()) {
+		return nil, false
+	}
+	return c.read(el.Value.(*diskEntry))
+}
+
+// Remove deletes the key from the cache and reports whether it was present.
+func (c *DiskCache) Remove(key string) bool {
+	defer c.flush()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.index[key]
+	if !ok {
+		return false
+	}
+	c.remove(el, EventRemove)
+	return true
+}
+
+// Len returns the number of entries in the cache.
+func (c *DiskCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Purge removes all entries from the cache and deletes all segment files.
+func (c *DiskCache) Purge() {
+	defer c.flush()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for el := c.order.Front(); el != nil; el = el.Next() {
+		e := el.Value.(*diskEntry)
+		c.observe(EventRemove, e.key, nil)
+	}
+	c.index = make(map[string]*list.Element)
+	c.order.Init()
+	for _, id := range c.ids {
+		if err := c.deleteSegment(id); err != nil {
+			c.err = err
+		}
+	}
+	c.ids = nil
+}
+
+// Resize changes the capacity of the cache, evicting the least recently used
+// entries if needed. It returns the number of evicted entries.
+func (c *DiskCache) Resize(capacity int) int {
+	if capacity <= 0 {
+		panic("capacity must be greater than 0")
+	}
+	defer c.flush()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.capacity = capacity
+	evicted := 0
+	for c.order.Len() > c.capacity {
+		c.evict()
+		evicted++
+	}
+	return evicted
+}
+
+// Range iterates the entries from the most to the least recently used,
+// reading their values from the disk. Entries that cannot be read are skipped.
+func (c *DiskCache) Range(fn func(key string, value any) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for el := c.order.Front(); el != nil; el = el.Next() {
+		e := el.Value.(*diskEntry)
+		if e.expired(now) {
+			continue
+		}
+		value, ok := c.read(e)
+		if ok && !fn(e.key, value) {
+			return
+		}
+	}
+}
+
+// Stats returns a snapshot of the cache counters.
+func (c *DiskCache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.snapshot(c.order.Len(), c.capacity)
+}
+
+// Err returns the last error encountered while writing or reading a segment.
+func (c *DiskCache) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Compact rewrites the live values of the sealed segments to the active one
+// and deletes them, reclaiming the space of overwritten, removed and evicted values.
+func (c *DiskCache) Compact() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.ids) <= 1 {
+		return nil
+	}
+	sealed := slices.Clone(c.ids[:len(c.ids)-1])
+	compacted := make(map[uint32]bool, len(sealed))
+	for _, id := range sealed {
+		compacted[id] = true
+	}
+
+	// rewrite from the least recently used so that a recovery restores the order
+	for el := c.order.Back(); el != nil; el = el.Prev() {
+		e := el.Value.(*diskEntry)
+		if !compacted[e.segment] {
+			continue
+		}
+		record := make([]byte, e.size)
+		if _, err := c.segments[e.segment].file.ReadAt(record, e.offset); err != nil {
+			return err
+		}
+		s, err := c.writable(e.size)
+		if err != nil {
+			return err
+		}
+		if _, err := s.file.Write(record); err != nil {
+			return err
+		}
+		c.segments[e.segment].live -= e.size
+		e.segment, e.offset = s.id, s.size
+		s.size += e.size
+		s.live += e.size
+	}
+
+	// starting new segments above may already have deleted some of them
+	c.ids = slices.DeleteFunc(c.ids, func(id uint32) bool { return compacted[id] })
+	for _, id := range sealed {
+		if _, ok := c.segments[id]; !ok {
+			continue
+		}
+		if err := c.deleteSegment(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close syncs and closes the segment files.
+// The cache must not be used after Close.
+func (c *DiskCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var err error
+	if len(c.ids) > 0 {
+		err = c.segments[c.ids[len(c.ids)-1]].file.Sync()
+	}
+	return errors.Join(err, c.closeFiles())
+}
+
+func (c *DiskCache) evict() {
+	c.remove(c.order.Back(), EventEvict)
+}
+
+// remove drops the entry from the index and records a tombstone for it.
+func (c *DiskCache) remove(el *list.Element, kind EventKind) {
+	e := el.Value.(*diskEntry)
+	c.order.Remove(el)
+	delete(c.index, e.key)
+	c.segments[e.segment].live -= e.size
+	if _, _, _, err := c.append(recordDelete, e.key, nil, time.Time{}); err != nil {
+		c.err = err
+	}
+	c.observe(kind, e.key, nil)
+}
+
+// read decodes the value of the entry from its segment.
+func (c *DiskCache) read(e *diskEntry) (any, bool) {
+	buf := make([]byte, e.size-recordHeaderSize-int64(len(e.key)))
+	if _, err := c.segments[e.segment].file.ReadAt(buf, e.offset+recordHeaderSize+int64(len(e.key))); err != nil {
+		c.err = err
+		return nil, false
+	}
+	var v diskValue
+	if err := gob.NewDecoder(bytes.NewReader(buf)).Decode(&v); err != nil {
+		c.err = err
+		return nil, false
+	}
+	return v.V, true
+}
+
+// append writes a record to the active segment and returns the segment,
+// the offset and the size of the record.
+func (c *DiskCache) append(kind byte, key string, value []byte, expireAt time.Time) (*segment, int64, int64, error) {
+	record := encodeRecord(kind, key, value, expireAt)
+	size := int64(len(record))
+	s, err := c.writable(size)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if _, err := s.file.Write(record); err != nil {
+		return nil, 0, 0, err
+	}
+	offset := s.size
+	s.size += size
+	return s, offset, size, nil
+}
+
+// writable returns the active segment, sealing it and starting a new one
+// if it cannot hold size more bytes.
+func (c *DiskCache) writable(size int64) (*segment, error) {
+	if len(c.ids) > 0 {
+		s := c.segments[c.ids[len(c.ids)-1]]
+		if s.size == 0 || s.size+size <= c.segmentSize {
+			return s, nil
+		}
+		if err := s.file.Sync(); err != nil {
+			return nil, err
+		}
+	}
+
+	var id uint32 = 1
+	if len(c.ids) > 0 {
+		id = c.ids[len(c.ids)-1] + 1
+	}
+	f, err := os.OpenFile(c.segmentPath(id), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	s := &segment{id: id, file: f}
+	c.segments[id] = s
+	c.ids = append(c.ids, id)
+
+	// the oldest segments without live values are not needed anymore,
+	// newer ones may hold tombstones hiding the values of older ones
+	for len(c.ids) > 1 && c.segments[c.ids[0]].live == 0 {
+		if err := c.deleteSegment(c.ids[0]); err != nil {
+			return nil, err
+		}
+		c.ids = c.ids[1:]
+	}
+	return s, nil
+}
+
+// recover rebuilds the index by replaying the segments from the oldest.
+func (c *DiskCache) recover() error {
+	names, err := filepath.Glob(filepath.Join(c.dir, "*"+segmentExt))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		id, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(name), segmentExt), 10, 32)
+		if err != nil {
+			continue
+		}
+		c.ids = append(c.ids, uint32(id))
+	}
+	slices.Sort(c.ids)
+
+	for _, id := range c.ids {
+		f, err := os.OpenFile(c.segmentPath(id), os.O_RDWR|os.O_APPEND, 0o600)
+		if err != nil {
+			return err
+		}
+		s := &segment{id: id, file: f}
+		c.segments[id] = s
+		if err := c.replay(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *DiskCache) replay(s *segment) error {
+	data, err := os.ReadFile(c.segmentPath(s.id))
+	if err != nil {
+		return err
+	}
+	for s.size < int64(len(data)) {
+		kind, key, expireAt, size, err := decodeRecord(data[s.size:])
+		if err != nil {
+			// drop the torn tail so that new records are appended after a valid one
+			return s.file.Truncate(s.size)
+		}
+
+		if el, ok := c.index[key]; ok {
+			e := el.Value.(*diskEntry)
+			c.segments[e.segment].live -= e.size
+			c.order.Remove(el)
+			delete(c.index, key)
+		}
+		e := &diskEntry{key: key, segment: s.id, offset: s.size, size: size, expireAt: expireAt}
+		if kind == recordPut && !e.expired(c.now()) {
+			c.index[key] = c.order.PushFront(e)
+			s.live += size
+		}
+		s.size += size
+	}
+	return nil
+}
+
+func (c *DiskCache) deleteSegment(id uint32) error {
+	s := c.segments[id]
+	delete(c.segments, id)
+	return errors.Join(s.file.Close(), os.Remove(c.segmentPath(id)))
+}
+
+func (c *DiskCache) closeFiles() error {
+	var errs []error
+	for _, s := range c.segments {
+		errs = append(errs, s.file.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (c *DiskCache) segmentPath(id uint32) string {
+	return filepath.Join(c.dir, fmt.Sprintf("%08d%s", id, segmentExt))
+}
+
+func encodeRecord(kind byte, key string, value []byte, expireAt time.Time) []byte {
+	record := make([]byte, recordHeaderSize+len(key)+len(value))
+	record[4] = kind
+	if !expireAt.IsZero() {
+		binary.LittleEndian.PutUint64(record[5:], uint64(expireAt.UnixNano()))
+	}
+	binary.LittleEndian.PutUint32(record[13:], uint32(len(key)))
+	binary.LittleEndian.PutUint32(record[17:], uint32(len(value)))
+	copy(record[recordHeaderSize:], key)
+	copy(record[recordHeaderSize+len(key):], value)
+	binary.LittleEndian.PutUint32(record, crc32.ChecksumIEEE(record[4:]))
+	return record
+}
+
+func decodeRecord(data []byte) (kind byte, key string, expireAt time.Time, size int64, err error) {
+	if len(data) < recordHeaderSize {
+		return 0, "", time.Time{}, 0, errCorruptRecord
+	}
+	keyLen := int64(binary.LittleEndian.Uint32(data[13:]))
+	valueLen := int64(binary.LittleEndian.Uint32(data[17:]))
+	size = recordHeaderSize + keyLen + valueLen
+	if int64(len(data)) < size || binary.LittleEndian.Uint32(data) != crc32.ChecksumIEEE(data[4:size]) {
+		return 0, "", time.Time{}, 0, errCorruptRecord
+	}
+	if nano := binary.LittleEndian.Uint64(data[5:]); nano != 0 {
+		expireAt = time.Unix(0, int64(nano))
+	}
+	return data[4], string(data[recordHeaderSize : recordHeaderSize+keyLen]), expireAt, size, nil
+}
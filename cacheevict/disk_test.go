@@ -0,0 +1,272 @@
+package cacheevict
+
+import (
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openDiskCache(t *testing.T, dir string, capacity int, segmentSize ...int64) *DiskCache {
+	t.Helper()
+	c, err := OpenDiskCache(dir, capacity, segmentSize...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func segmentFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	names, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	require.NoError(t, err)
+	return names
+}
+
+type diskPoint struct {
+	X, Y int
+}
+
+func TestOpenDiskCache(t *testing.T) {
+	assert.Panics(t, func() { _, _ = OpenDiskCache(t.TempDir(), 0) })
+
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, nil, 0o600))
+	_, err := OpenDiskCache(file, 1)
+	assert.Error(t, err, "Expected an error when dir is a file")
+}
+
+func TestDiskCache_AddAndGet(t *testing.T) {
+	c := openDiskCache(t, t.TempDir(), 2)
+
+	c.Add("a", 1)
+	c.Add("b", "two")
+	value, found := c.Get("a")
+	assert.True(t, found)
+	assert.Equal(t, 1, value)
+
+	c.Add("c", []byte("three")) // evicts "b", "a" was used more recently
+	_, found = c.Get("b")
+	assert.False(t, found)
+	value, found = c.Get("c")
+	assert.True(t, found)
+	assert.Equal(t, []byte("three"), value)
+
+	c.Add("a", 10)
+	value, _ = c.Peek("a")
+	assert.Equal(t, 10, value)
+
+	assert.True(t, c.Remove("a"))
+	assert.False(t, c.Remove("a"))
+	assert.Equal(t, Stats{Len: 1, Capacity: 2, Hits: 2, Misses: 1, Evictions: 1}, c.Stats())
+	assert.NoError(t, c.Err())
+}
+
+func TestDiskCache_Values(t *testing.T) {
+	c := openDiskCache(t, t.TempDir(), 10)
+
+	c.Add("nil", nil)
+	value, found := c.Get("nil")
+	assert.True(t, found)
+	assert.Nil(t, value)
+
+	c.Add("chan", make(chan int))
+	_, found = c.Get("chan")
+	assert.False(t, found, "Expected values gob cannot encode not to be cached")
+	assert.Error(t, c.Err())
+
+	gob.Register(diskPoint{})
+	c.Add("point", diskPoint{X: 1, Y: 2})
+	value, _ = c.Get("point")
+	assert.Equal(t, diskPoint{X: 1, Y: 2}, value)
+}
+
+func TestDiskCache_Recover(t *testing.T) {
+	dir := t.TempDir()
+	c, err := OpenDiskCache(dir, 3)
+	require.NoError(t, err)
+	c.Add("a", 1)
+	c.Add("b", 2)
+	c.Add("c", 3)
+	c.Add("a", 10)
+	c.Remove("b")
+	c.Add("d", 4)
+	require.NoError(t, c.Close())
+
+	c = openDiskCache(t, dir, 3)
+	var keys []string
+	var values []any
+	c.Range(func(key string, value any) bool {
+		keys = append(keys, key)
+		values = append(values, value)
+		return true
+	})
+	assert.Equal(t, []string{"d", "a", "c"}, keys)
+	assert.Equal(t, []any{4, 10, 3}, values)
+}
+
+func TestDiskCache_RecoverEvictsBeyondCapacity(t *testing.T) {
+	dir := t.TempDir()
+	c, err := OpenDiskCache(dir, 3)
+	require.NoError(t, err)
+	c.Add("a", 1)
+	c.Add("b", 2)
+	c.Add("c", 3)
+	require.NoError(t, c.Close())
+
+	c = openDiskCache(t, dir, 2)
+	assert.Equal(t, 2, c.Len())
+	_, found := c.Peek("a")
+	assert.False(t, found)
+	require.NoError(t, c.Close())
+
+	// the eviction has been recorded
+	c = openDiskCache(t, dir, 3)
+	assert.Equal(t, 2, c.Len())
+}
+
+func TestDiskCache_RecoverTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	c, err := OpenDiskCache(dir, 10)
+	require.NoError(t, err)
+	c.Add("a", 1)
+	c.Add("b", 2)
+	require.NoError(t, c.Close())
+
+	// simulate a crash in the middle of writing "b"
+	name := segmentFiles(t, dir)[0]
+	info, err := os.Stat(name)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(name, info.Size()-3))
+
+	c = openDiskCache(t, dir, 10)
+	assert.Equal(t, 1, c.Len())
+	_, found := c.Peek("b")
+	assert.False(t, found)
+
+	// new records are appended after the last valid one
+	c.Add("c", 3)
+	require.NoError(t, c.Close())
+	c = openDiskCache(t, dir, 10)
+	value, found := c.Peek("c")
+	assert.True(t, found)
+	assert.Equal(t, 3, value)
+}
+
+func TestDiskCache_Segments(t *testing.T) {
+	dir := t.TempDir()
+	c := openDiskCache(t, dir, 100, 256)
+
+	for i := 0; i < 50; i++ {
+		c.Add(fmt.Sprintf("key-%d", i%5), i)
+	}
+	assert.Equal(t, 5, c.Len())
+	assert.Less(t, len(segmentFiles(t, dir)), 5,
+		"Expected the oldest segments without live values to be deleted")
+
+	for i := 0; i < 5; i++ {
+		c.Add(fmt.Sprintf("key-%d", i), i)
+		c.Add(fmt.Sprintf("other-%d", i), i)
+		c.Remove(fmt.Sprintf("other-%d", i))
+	}
+	before := len(segmentFiles(t, dir))
+	require.Greater(t, before, 2)
+
+	require.NoError(t, c.Compact())
+	assert.NoError(t, c.Err())
+	assert.Less(t, len(segmentFiles(t, dir)), before)
+	require.NoError(t, c.Close())
+
+	c = openDiskCache(t, dir, 100, 256)
+	assert.Equal(t, 5, c.Len())
+	for i := 0; i < 5; i++ {
+		value, found := c.Get(fmt.Sprintf("key-%d", i))
+		assert.True(t, found)
+		assert.Equal(t, i, value)
+	}
+}
+
+func TestDiskCache_PurgeAndResize(t *testing.T) {
+	dir := t.TempDir()
+	c := openDiskCache(t, dir, 4)
+	for i := 0; i < 4; i++ {
+		c.Add(fmt.Sprint(i), i)
+	}
+
+	assert.Equal(t, 2, c.Resize(2))
+	assert.Equal(t, 2, c.Len())
+
+	c.Purge()
+	assert.Equal(t, 0, c.Len())
+	assert.Empty(t, segmentFiles(t, dir))
+
+	c.Add("a", 1)
+	value, found := c.Get("a")
+	assert.True(t, found)
+	assert.Equal(t, 1, value)
+}
+
+func TestDiskCache_AsL2(t *testing.T) {
+	l2 := openDiskCache(t, t.TempDir(), 100)
+	l1 := NewLRUCache(2)
+	l1.SubscribeFunc(func(e Event) {
+		if e.Kind == EventEvict {
+			l2.Add(e.Key, e.Value)
+		}
+	})
+	get := func(key string) (any, bool) {
+		if value, ok := l1.Get(key); ok {
+			return value, true
+		}
+		value, ok := l2.Get(key)
+		if ok {
+			l2.Remove(key)
+			l1.Add(key, value)
+		}
+		return value, ok
+	}
+
+	l1.Add("a", 1)
+	l1.Add("b", 2)
+	l1.Add("c", 3) // "a" is demoted to the disk
+	assert.Equal(t, 1, l2.Len())
+
+	value, found := get("a") // "a" is promoted, "b" is demoted
+	assert.True(t, found)
+	assert.Equal(t, 1, value)
+	_, found = l2.Peek("b")
+	assert.True(t, found)
+	_, found = l2.Peek("a")
+	assert.False(t, found)
+}
+
+func TestDiskCache_TTL(t *testing.T) {
+	dir := t.TempDir()
+	c, err := OpenDiskCache(dir, 3)
+	require.NoError(t, err)
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	c.SetClock(clock)
+	c.Add("a", 1)
+	c.SetTTL(20 * time.Millisecond)
+	c.Add("b", 2)
+	c.Add("c", 3)
+	var events []EventKind
+	c.SubscribeFunc(func(e Event) { events = append(events, e.Kind) })
+
+	clock.Advance(30 * time.Millisecond)
+	_, found := c.Get("b")
+	assert.False(t, found)
+	assert.Equal(t, []EventKind{EventExpire, EventMiss}, events)
+	require.NoError(t, c.Close())
+
+	// the expiration times are recovered, the reopened cache telling the wall time
+	c = openDiskCache(t, dir, 3)
+	assert.Equal(t, 1, c.Len())
+	value, found := c.Get("a")
+	assert.True(t, found)
+	assert.Equal(t, 1, value)
+}
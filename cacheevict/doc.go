@@ -1,6 +1,8 @@
 // Package cacheevict provides some cache eviction policy algorithms.
 package cacheevict
 
+import "time"
+
 // Cache defines the interface for a cache.
 type Cache interface {
 	// Add adds a key-value pair to the cache.
@@ -9,11 +11,70 @@ type Cache interface {
 	Get(string) (any, bool)
 }
 
+// Inspectable is a Cache which can also be inspected and administered,
+// as all the caches of this package are. The AdminHandler serves them.
+type Inspectable interface {
+	Cache
+	// Peek retrieves the value associated with the given key
+	// without updating its position in the eviction order or the stats.
+	Peek(string) (any, bool)
+	// Remove deletes the given key from the cache and reports whether it was present.
+	Remove(string) bool
+	// Len returns the number of entries in the cache.
+	Len() int
+	// Purge removes all entries from the cache.
+	Purge()
+	// Resize changes the capacity of the cache and returns the number of evicted entries.
+	Resize(int) int
+	// Range calls fn for each entry, starting from the one the policy would evict last,
+	// until fn returns false. fn must not call back into the cache.
+	Range(fn func(key string, value any) bool)
+	// Stats returns a snapshot of the cache counters.
+	Stats() Stats
+	// Subscribe returns a subscription delivering the cache events on a buffered channel,
+	// dropping them when it is full if dropOnFull is true.
+	Subscribe(buffer int, dropOnFull bool) *Subscription
+	// SubscribeFunc returns a subscription calling fn for each cache event.
+	SubscribeFunc(fn func(Event)) *Subscription
+	// SetTTL sets the time-to-live of the entries added from now on, they never expire by default.
+	SetTTL(ttl time.Duration)
+}
+
+// Stats is a snapshot of the counters of a cache.
+type Stats struct {
+	Len         int    `json:"len"`
+	Capacity    int    `json:"capacity"`
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	Evictions   uint64 `json:"evictions"`
+	Expirations uint64 `json:"expirations"`
+	// Rejections is the number of insertions rejected by the doorkeeper, if any.
+	Rejections uint64 `json:"rejections"`
+}
+
 type cacheItem struct {
 	key   string
 	value any
+	// expireAt is the time the item expires, zero if it never expires.
+	expireAt time.Time
+}
+
+// expired reports whether the item has expired at now.
+func (i *cacheItem) expired(now time.Time) bool {
+	return !i.expireAt.IsZero() && now.After(i.expireAt)
+}
+
+// Clock tells the time to the caches, for the expiration of the entries
+// and the time of the events. It lets tests control the time.
+type Clock interface {
+	Now() time.Time
 }
 
+// realClock is the default Clock, telling the wall time.
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
 // Policy is a type for cache eviction policies.
 type Policy string
 
@@ -22,11 +83,19 @@ const (
 	LRU  Policy = "lru"
 	LFU  Policy = "lfu"
 	ARC  Policy = "arc"
+	// LECAR adapts online between LRU and LFU, see LeCaRCache.
+	LECAR Policy = "lecar"
 )
 
 type builder struct {
 	policy   Policy
 	capacity int
+
+	ttl   time.Duration
+	clock Clock
+
+	doorkeeperWindow            int
+	doorkeeperFalsePositiveRate []float64
 }
 
 // Builder returns a new builder for building a cache.
@@ -46,17 +115,46 @@ func (b *builder) Capacity(capacity int) *builder {
 	return b
 }
 
+// TTL sets the time-to-live of the entries, counted from their last Add, see Inspectable.SetTTL.
+// Expired entries are dropped lazily, when they are looked up.
+func (b *builder) TTL(ttl time.Duration) *builder {
+	b.ttl = ttl
+	return b
+}
+
+// Clock sets the clock of the cache, the wall clock by default.
+func (b *builder) Clock(clock Clock) *builder {
+	b.clock = clock
+	return b
+}
+
+// Doorkeeper enables an admission doorkeeper, a key is only cached on its
+// second insertion within the window, see DoorkeeperCache.
+func (b *builder) Doorkeeper(window int, falsePositiveRate ...float64) *builder {
+	b.doorkeeperWindow = window
+	b.doorkeeperFalsePositiveRate = falsePositiveRate
+	return b
+}
+
 // Build builds a new cache with the given policy and capacity.
-func (b *builder) Build() Cache {
+func (b *builder) Build() Inspectable {
 	if b.policy == "" || b.capacity <= 0 {
 		panic("unspecified policy or capacity")
 	}
 
-	return New(b.policy, b.capacity)
+	c := New(b.policy, b.capacity)
+	c.SetTTL(b.ttl)
+	if b.clock != nil {
+		c.(interface{ SetClock(Clock) }).SetClock(b.clock)
+	}
+	if b.doorkeeperWindow != 0 {
+		c = NewDoorkeeperCache(c, b.doorkeeperWindow, b.doorkeeperFalsePositiveRate...)
+	}
+	return c
 }
 
 // New creates a new cache with the given policy and capacity.
-func New(policy Policy, capacity int) Cache {
+func New(policy Policy, capacity int) Inspectable {
 	switch policy {
 	case FIFO:
 		return NewFIFOCache(capacity)
@@ -66,6 +164,8 @@ func New(policy Policy, capacity int) Cache {
 		return NewLFUCache(capacity)
 	case ARC:
 		return NewARCCache(capacity)
+	case LECAR:
+		return NewLeCaRCache(capacity)
 	default:
 		panic("unsupported policy: " + policy)
 	}
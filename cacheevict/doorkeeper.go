@@ -0,0 +1,101 @@
+package cacheevict
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/hedon954/devkit-go/datastructure"
+)
+
+// defaultDoorkeeperFalsePositiveRate is the false positive rate of the doorkeeper
+// Bloom filters when none is given.
+const defaultDoorkeeperFalsePositiveRate = 0.01
+
+// DoorkeeperCache wraps an Inspectable cache with an admission doorkeeper: a new key is only
+// admitted the second time it is added within a window, so that keys requested
+// exactly once never push useful entries out of the cache.
+// Keys already cached are always updated.
+//
+// The doorkeeper remembers the added keys in two rotating Bloom filters.
+// Once the current one has recorded window keys it becomes the previous one,
+// and the oldest generation is forgotten, so a key is remembered for
+// window to 2*window insertions.
+type DoorkeeperCache struct {
+	Inspectable
+
+	mu         sync.Mutex
+	window     int
+	recorded   int
+	current    *datastructure.BloomFilter
+	previous   *datastructure.BloomFilter
+	rejections atomic.Uint64
+}
+
+// NewDoorkeeperCache wraps the cache with a doorkeeper remembering window keys per
+// generation with the given false positive rate, which defaults to 1%.
+// It panics if the window is less than or equal to 0.
+func NewDoorkeeperCache(c Inspectable, window int, falsePositiveRate ...float64) *DoorkeeperCache {
+	if window <= 0 {
+		panic("window must be greater than 0")
+	}
+	rate := defaultDoorkeeperFalsePositiveRate
+	if len(falsePositiveRate) > 0 {
+		rate = falsePositiveRate[0]
+	}
+	return &DoorkeeperCache{
+		Inspectable: c,
+		window:      window,
+		current:     datastructure.NewBloomFilter(window, rate),
+		previous:    datastructure.NewBloomFilter(window, rate),
+	}
+}
+
+// Add adds the key-value pair to the underlying cache if the key is already
+// cached or has been seen by the doorkeeper, otherwise the insertion is rejected
+// and the key is recorded.
+func (d *DoorkeeperCache) Add(key string, value any) {
+	if _, ok := d.Inspectable.Peek(key); ok || d.admit(key) {
+		d.Inspectable.Add(key, value)
+		return
+	}
+	d.rejections.Add(1)
+}
+
+// Purge removes all entries from the underlying cache and resets the doorkeeper.
+func (d *DoorkeeperCache) Purge() {
+	d.Inspectable.Purge()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.current.Reset()
+	d.previous.Reset()
+	d.recorded = 0
+}
+
+// Stats returns the stats of the underlying cache with the rejected insertions.
+func (d *DoorkeeperCache) Stats() Stats {
+	s := d.Inspectable.Stats()
+	s.Rejections = d.rejections.Load()
+	return s
+}
+
+// admit reports whether the key has been seen within the window,
+// recording it if not.
+func (d *DoorkeeperCache) admit(key string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	data := []byte(key)
+	if d.current.Contains(data) || d.previous.Contains(data) {
+		return true
+	}
+
+	d.current.Add(data)
+	d.recorded++
+	if d.recorded >= d.window {
+		d.current, d.previous = d.previous, d.current
+		d.current.Reset()
+		d.recorded = 0
+	}
+	return false
+}
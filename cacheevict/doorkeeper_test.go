@@ -0,0 +1,85 @@
+package cacheevict
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDoorkeeperCache(t *testing.T) {
+	assert.Panics(t, func() { NewDoorkeeperCache(NewLRUCache(1), 0) })
+	assert.Panics(t, func() { Builder().Policy(LRU).Capacity(1).Doorkeeper(-1).Build() })
+
+	c := Builder().Policy(LRU).Capacity(2).Doorkeeper(10, 0.001).Build()
+	assert.IsType(t, &DoorkeeperCache{}, c)
+	assert.IsType(t, &LRUCache{}, c.(*DoorkeeperCache).Inspectable)
+	assert.IsType(t, &LRUCache{}, Builder().Policy(LRU).Capacity(2).Build())
+}
+
+func TestDoorkeeperCache_AdmitsOnSecondInsertion(t *testing.T) {
+	c := Builder().Policy(LRU).Capacity(2).Doorkeeper(10).Build()
+
+	c.Add("a", 1)
+	_, found := c.Get("a")
+	assert.False(t, found, "Expected 'a' to be rejected on its first insertion")
+
+	c.Add("a", 1)
+	value, found := c.Get("a")
+	assert.True(t, found, "Expected 'a' to be admitted on its second insertion")
+	assert.Equal(t, 1, value)
+
+	// cached keys are updated without going through the doorkeeper
+	c.Add("a", 10)
+	value, _ = c.Get("a")
+	assert.Equal(t, 10, value)
+
+	assert.Equal(t, Stats{Len: 1, Capacity: 2, Hits: 2, Misses: 1, Rejections: 1}, c.Stats())
+}
+
+func TestDoorkeeperCache_OneHitWondersKeepHotEntries(t *testing.T) {
+	c := Builder().Policy(LRU).Capacity(2).Doorkeeper(100).Build()
+	c.Add("hot", 1)
+	c.Add("hot", 1)
+
+	for i := 0; i < 50; i++ {
+		c.Add(fmt.Sprintf("once-%d", i), i)
+	}
+
+	_, found := c.Get("hot")
+	assert.True(t, found, "Expected one-hit wonders not to evict the hot key")
+	assert.Equal(t, uint64(51), c.Stats().Rejections)
+	assert.Equal(t, uint64(0), c.Stats().Evictions)
+}
+
+func TestDoorkeeperCache_WindowRotation(t *testing.T) {
+	c := NewDoorkeeperCache(NewLRUCache(10), 2)
+
+	c.Add("a", 1) // recorded in the current generation
+	c.Add("b", 2) // current generation is full and becomes the previous one
+	c.Add("c", 3) // recorded in the new current generation
+	c.Add("a", 1) // still remembered by the previous generation
+	_, found := c.Peek("a")
+	assert.True(t, found)
+
+	c.Add("d", 4) // the generation holding "a" is forgotten
+	c.Add("e", 5)
+	c.Add("b", 2)
+	_, found = c.Peek("b")
+	assert.False(t, found, "Expected 'b' to be forgotten after two rotations")
+}
+
+func TestDoorkeeperCache_Purge(t *testing.T) {
+	c := NewDoorkeeperCache(NewFIFOCache(2), 10)
+	c.Add("a", 1)
+	c.Add("a", 1)
+	c.Add("b", 2)
+
+	c.Purge()
+	assert.Equal(t, 0, c.Len())
+
+	// the doorkeeper has forgotten "b" as well
+	c.Add("b", 2)
+	_, found := c.Peek("b")
+	assert.False(t, found)
+}
@@ -0,0 +1,292 @@
+package cacheevict
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventKind is the kind of an Event emitted by a cache.
+type EventKind uint8
+
+const (
+	// EventHit is emitted when Get finds the key.
+	EventHit EventKind = iota + 1
+	// EventMiss is emitted when Get does not find the key.
+	EventMiss
+	// EventInsert is emitted when a new key is added.
+	EventInsert
+	// EventUpdate is emitted when the value of a cached key is replaced.
+	EventUpdate
+	// EventEvict is emitted when the policy evicts an entry to make room.
+	EventEvict
+	// EventExpire is emitted when an entry is dropped because its time-to-live elapsed.
+	EventExpire
+	// EventRemove is emitted when an entry is removed by Remove or Purge.
+	EventRemove
+)
+
+var eventKindNames = map[EventKind]string{
+	EventHit:    "hit",
+	EventMiss:   "miss",
+	EventInsert: "insert",
+	EventUpdate: "update",
+	EventEvict:  "evict",
+	EventExpire: "expire",
+	EventRemove: "remove",
+}
+
+func (k EventKind) String() string {
+	if name, ok := eventKindNames[k]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// Event is an operation performed by a cache.
+type Event struct {
+	Kind EventKind
+	Key  string
+	// Value is the value involved in the event, nil for a miss.
+	Value any
+	Time  time.Time
+}
+
+// Subscription receives the events of a cache until it is closed.
+type Subscription struct {
+	// C delivers the events of a channel subscription, it is closed by Close.
+	// It is nil for a callback subscription.
+	C <-chan Event
+
+	ch         chan Event
+	fn         func(Event)
+	dropOnFull bool
+	dropped    atomic.Uint64
+	done       chan struct{}
+	once       sync.Once
+	mu         sync.RWMutex // Held to send on ch, so that it is not closed meanwhile
+	base       *base
+}
+
+// Dropped returns the number of events dropped because the channel was full.
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close stops the delivery of events and closes C.
+// It unblocks a cache waiting for a slow consumer.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		close(s.done)
+		s.base.mu.Lock()
+		delete(s.base.subscribers, s)
+		s.base.mu.Unlock()
+		s.base.subscribed.Add(-1)
+		if s.ch != nil {
+			s.mu.Lock()
+			close(s.ch)
+			s.mu.Unlock()
+		}
+	})
+}
+
+func (s *Subscription) deliver(e Event) {
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+	if s.fn != nil {
+		s.fn(e)
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	select {
+	case <-s.done:
+		// closed before the lock was acquired, ch may be closed
+		return
+	default:
+	}
+	switch {
+	case s.dropOnFull:
+		select {
+		case s.ch <- e:
+		default:
+			s.dropped.Add(1)
+		}
+	default:
+		select {
+		case s.ch <- e:
+		case <-s.done:
+		}
+	}
+}
+
+// base holds the state shared by all cache policies:
+// the counters, the event subscribers and the time-to-live of the entries.
+// The operations observing events defer flush before locking the cache,
+// so that the events are delivered once it is unlocked.
+type base struct {
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	evictions   atomic.Uint64
+	expirations atomic.Uint64
+
+	mu          sync.RWMutex
+	subscribers map[*Subscription]struct{}
+	subscribed  atomic.Int32
+
+	// pending holds the events observed while the cache is locked, until flush delivers them
+	pendingMu  sync.Mutex
+	pending    []Event
+	delivering bool // Whether a goroutine is delivering the pending events
+
+	ttl   atomic.Int64 // The time-to-live of the entries, they do not expire if 0
+	clock Clock        // The clock of the cache, the wall clock if nil
+}
+
+// Subscribe returns a subscription delivering the events on a channel with
+// the given buffer size. If dropOnFull is true, events are dropped when the
+// buffer is full, so a slow consumer never blocks the cache; otherwise the
+// cache operations wait for the consumer, once the cache is unlocked.
+func (b *base) Subscribe(buffer int, dropOnFull bool) *Subscription {
+	ch := make(chan Event, buffer)
+	s := &Subscription{C: ch, ch: ch, dropOnFull: dropOnFull}
+	b.subscribe(s)
+	return s
+}
+
+// SubscribeFunc returns a subscription calling fn for each event.
+// fn is called synchronously by the cache operations once the cache is unlocked,
+// so it may call back into the cache, the events it causes being delivered after it returns.
+func (b *base) SubscribeFunc(fn func(Event)) *Subscription {
+	s := &Subscription{fn: fn}
+	b.subscribe(s)
+	return s
+}
+
+func (b *base) subscribe(s *Subscription) {
+	s.done = make(chan struct{})
+	s.base = b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subscribers == nil {
+		b.subscribers = make(map[*Subscription]struct{})
+	}
+	b.subscribers[s] = struct{}{}
+	b.subscribed.Add(1)
+}
+
+// observe updates the counters for the event and queues it for the subscribers,
+// it is delivered by flush once the cache is unlocked.
+func (b *base) observe(kind EventKind, key string, value any) {
+	switch kind {
+	case EventHit:
+		b.hits.Add(1)
+	case EventMiss:
+		b.misses.Add(1)
+	case EventEvict:
+		b.evictions.Add(1)
+	case EventExpire:
+		b.expirations.Add(1)
+	}
+
+	if b.subscribed.Load() == 0 {
+		return
+	}
+	e := Event{Kind: kind, Key: key, Value: value, Time: b.now()}
+	b.pendingMu.Lock()
+	b.pending = append(b.pending, e)
+	b.pendingMu.Unlock()
+}
+
+// flush delivers the pending events to the subscribers, in the order they were observed.
+// It must be called without the lock of the cache held, so that a slow subscriber does not
+// block the other operations and a callback may call back into the cache.
+// The events queued while another goroutine is delivering are delivered by that goroutine.
+func (b *base) flush() {
+	b.pendingMu.Lock()
+	if b.delivering {
+		b.pendingMu.Unlock()
+		return
+	}
+	b.delivering = true
+	for len(b.pending) > 0 {
+		events := b.pending
+		b.pending = nil
+		b.pendingMu.Unlock()
+		b.publish(events)
+		b.pendingMu.Lock()
+	}
+	b.delivering = false
+	b.pendingMu.Unlock()
+}
+
+// publish delivers the events to the current subscribers.
+func (b *base) publish(events []Event) {
+	b.mu.RLock()
+	subscribers := make([]*Subscription, 0, len(b.subscribers))
+	for s := range b.subscribers {
+		subscribers = append(subscribers, s)
+	}
+	b.mu.RUnlock()
+
+	for _, e := range events {
+		for _, s := range subscribers {
+			s.deliver(e)
+		}
+	}
+}
+
+// access observes a hit or a miss depending on found.
+func (b *base) access(key string, value any, found bool) {
+	if found {
+		b.observe(EventHit, key, value)
+	} else {
+		b.observe(EventMiss, key, nil)
+	}
+}
+
+// SetTTL sets the time-to-live of the entries added or updated from now on, counted from their last Add.
+// The entries expire lazily, when they are looked up, emitting an EventExpire.
+// They do not expire if ttl is less than or equal to 0, which is the default.
+func (b *base) SetTTL(ttl time.Duration) {
+	b.ttl.Store(int64(max(ttl, 0)))
+}
+
+// deadline returns the expiration time of an entry added now,
+// or the zero time if entries do not expire.
+func (b *base) deadline() time.Time {
+	ttl := time.Duration(b.ttl.Load())
+	if ttl == 0 {
+		return time.Time{}
+	}
+	return b.now().Add(ttl)
+}
+
+// SetClock sets the clock telling when the entries expire and when the events happen.
+// It must be called before the cache is used.
+func (b *base) SetClock(clock Clock) {
+	b.clock = clock
+}
+
+// now returns the current time of the cache clock.
+func (b *base) now() time.Time {
+	if b.clock == nil {
+		return time.Now()
+	}
+	return b.clock.Now()
+}
+
+func (b *base) snapshot(length, capacity int) Stats {
+	return Stats{
+		Len:         length,
+		Capacity:    capacity,
+		Hits:        b.hits.Load(),
+		Misses:      b.misses.Load(),
+		Evictions:   b.evictions.Load(),
+		Expirations: b.expirations.Load(),
+	}
+}
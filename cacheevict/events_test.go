@@ -0,0 +1,220 @@
+package cacheevict
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock is a Clock only moving forward when advanced.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func kinds(events []Event) []EventKind {
+	res := make([]EventKind, 0, len(events))
+	for _, e := range events {
+		res = append(res, e.Kind)
+	}
+	return res
+}
+
+func TestEventKind_String(t *testing.T) {
+	assert.Equal(t, "hit", EventHit.String())
+	assert.Equal(t, "remove", EventRemove.String())
+	assert.Equal(t, "unknown", EventKind(0).String())
+}
+
+func TestSubscribeFunc_AllPolicies(t *testing.T) {
+	for _, policy := range []Policy{LRU, FIFO, LFU, ARC, LECAR} {
+		t.Run(string(policy), func(t *testing.T) {
+			c := New(policy, 1)
+			var events []Event
+			sub := c.SubscribeFunc(func(e Event) { events = append(events, e) })
+
+			c.Add("a", 1)
+			c.Add("a", 2)
+			c.Get("a")
+			c.Get("b")
+			c.Add("b", 3)
+			c.Remove("b")
+
+			assert.Equal(t, []EventKind{
+				EventInsert, EventUpdate, EventHit, EventMiss, EventEvict, EventInsert, EventRemove,
+			}, kinds(events))
+			assert.Equal(t, Event{Kind: EventEvict, Key: "a", Value: 2, Time: events[4].Time}, events[4])
+			assert.False(t, events[0].Time.IsZero())
+
+			sub.Close()
+			c.Add("c", 4)
+			assert.Len(t, events, 7, "Expected no event after Close")
+		})
+	}
+}
+
+func TestSubscribeFunc_CallBackIntoCache(t *testing.T) {
+	for _, policy := range []Policy{LRU, FIFO, LFU, ARC, LECAR} {
+		t.Run(string(policy), func(t *testing.T) {
+			c := New(policy, 2)
+			var events []EventKind
+			c.SubscribeFunc(func(e Event) {
+				events = append(events, e.Kind)
+				if e.Kind == EventInsert {
+					c.Get(e.Key) // would deadlock if called with the cache locked
+				}
+			})
+
+			c.Add("a", 1)
+			c.Add("b", 2)
+			assert.Equal(t, []EventKind{EventInsert, EventHit, EventInsert, EventHit}, events)
+		})
+	}
+}
+
+func TestSubscribe_Channel(t *testing.T) {
+	c := NewLRUCache(2)
+	sub := c.Subscribe(4, false)
+
+	c.Add("a", 1)
+	c.Add("b", 2)
+	c.Purge()
+
+	assert.Equal(t, Event{Kind: EventInsert, Key: "a", Value: 1}, withoutTime(<-sub.C))
+	assert.Equal(t, Event{Kind: EventInsert, Key: "b", Value: 2}, withoutTime(<-sub.C))
+	assert.Equal(t, EventRemove, (<-sub.C).Kind)
+	assert.Equal(t, EventRemove, (<-sub.C).Kind)
+
+	sub.Close()
+	_, ok := <-sub.C
+	assert.False(t, ok, "Expected C to be closed")
+	assert.NotPanics(t, sub.Close)
+}
+
+func withoutTime(e Event) Event {
+	e.Time = time.Time{}
+	return e
+}
+
+func TestSubscribe_DropOnFull(t *testing.T) {
+	c := NewFIFOCache(10)
+	sub := c.Subscribe(2, true)
+	defer sub.Close()
+
+	for i := 0; i < 5; i++ {
+		c.Add(string(rune('a'+i)), i)
+	}
+
+	assert.Equal(t, uint64(3), sub.Dropped())
+	assert.Equal(t, "a", (<-sub.C).Key)
+	assert.Equal(t, "b", (<-sub.C).Key)
+}
+
+func TestSubscribe_CloseUnblocksCache(t *testing.T) {
+	c := NewLFUCache(10)
+	sub := c.Subscribe(0, false)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.Add("a", 1) // blocks until the event is received or the subscription closed
+	}()
+
+	e := <-sub.C
+	assert.Equal(t, "a", e.Key)
+	wg.Wait()
+
+	// the cache is not locked while waiting for the consumer
+	go c.Add("b", 1)
+	assert.Eventually(t, func() bool { return c.Len() == 2 }, time.Second, time.Millisecond)
+	assert.Equal(t, "b", (<-sub.C).Key)
+
+	done := make(chan struct{})
+	go func() {
+		c.Add("c", 2)
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	sub.Close()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected Close to unblock the cache")
+	}
+}
+
+func TestTTL_AllPolicies(t *testing.T) {
+	for _, policy := range []Policy{LRU, FIFO, LFU, ARC, LECAR} {
+		t.Run(string(policy), func(t *testing.T) {
+			clock := &fakeClock{now: time.Now()}
+			c := Builder().Policy(policy).Capacity(4).TTL(20 * time.Millisecond).Clock(clock).Build()
+			var events []EventKind
+			c.SubscribeFunc(func(e Event) { events = append(events, e.Kind) })
+
+			c.Add("a", 1)
+			c.Add("b", 2)
+			_, found := c.Get("a")
+			require.True(t, found)
+
+			clock.Advance(30 * time.Millisecond)
+
+			_, found = c.Peek("b")
+			assert.False(t, found, "Expected Peek to skip expired entries")
+			c.Range(func(key string, value any) bool {
+				t.Errorf("Expected Range to skip expired entry %q", key)
+				return true
+			})
+
+			_, found = c.Get("a")
+			assert.False(t, found)
+			assert.Equal(t, []EventKind{EventInsert, EventInsert, EventHit, EventExpire, EventMiss}, events)
+
+			stats := c.Stats()
+			assert.Equal(t, uint64(1), stats.Expirations)
+			assert.Equal(t, 1, stats.Len, "Expected expired entries to be dropped lazily")
+
+			// adding the key again starts a new time-to-live
+			c.Add("b", 3)
+			value, found := c.Get("b")
+			assert.True(t, found)
+			assert.Equal(t, 3, value)
+		})
+	}
+}
+
+func TestSetTTL(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	c := NewLRUCache(4)
+	c.SetClock(clock)
+	c.Add("a", 1)
+	c.SetTTL(10 * time.Millisecond)
+	c.Add("b", 2)
+	c.SetTTL(0)
+	c.Add("c", 3)
+
+	clock.Advance(20 * time.Millisecond)
+	_, found := c.Get("a")
+	assert.True(t, found, "Expected the entries added before SetTTL not to expire")
+	_, found = c.Get("b")
+	assert.False(t, found)
+	_, found = c.Get("c")
+	assert.True(t, found, "Expected the entries added after SetTTL(0) not to expire")
+	assert.Equal(t, uint64(1), c.Stats().Expirations)
+}
@@ -12,6 +12,7 @@ type FIFOCache struct {
 	count    int
 	hash     map[string]*list.Element
 	list     *list.List
+	base
 }
 
 // NewFIFOCache creates a new FIFOCache with the given capacity.
@@ -31,43 +32,172 @@ func NewFIFOCache(capacity int) *FIFOCache {
 // it updates the value and moves the item to the front of the list.
 // If the cache is at capacity, it evicts the oldest item.
 func (c *FIFOCache) Add(key string, value any) {
+	defer c.flush()
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	// if exists, update value and move to front
 	if elem, exists := c.hash[key]; exists {
-		elem.Value.(*cacheItem).value = value
+		item := elem.Value.(*cacheItem)
+		item.value = value
+		item.expireAt = c.deadline()
 		c.list.MoveToFront(elem)
+		c.observe(EventUpdate, key, value)
 		return
 	}
 
 	// if out of capacity, remove the last element
 	if c.count >= c.capacity {
-		backElem := c.list.Back()
-		backItem := backElem.Value.(*cacheItem)
-		delete(c.hash, backItem.key)
-		c.list.Remove(backElem)
-		c.count--
+		c.evict()
 	}
 
 	// add the new element to the front
 	item := &cacheItem{
-		key:   key,
-		value: value,
+		key:      key,
+		value:    value,
+		expireAt: c.deadline(),
 	}
 	elem := c.list.PushFront(item)
 	c.hash[key] = elem
 	c.count++
+	c.observe(EventInsert, key, value)
 }
 
 // Get retrieves the value associated with the given key from the cache.
 // It returns the value and a boolean indicating whether the key was found.
 func (c *FIFOCache) Get(key string) (any, bool) {
+	defer c.flush()
+	value, ok, expired := c.get(key)
+	if expired {
+		c.expire(key)
+		c.access(key, nil, false)
+	}
+	return value, ok
+}
+
+// get looks up the key under the read lock, recording the access
+// unless the entry has expired, which has to be removed under the write lock.
+func (c *FIFOCache) get(key string) (value any, ok, expired bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	v, ok := c.hash[key]
+	if ok && v.Value.(*cacheItem).expired(c.now()) {
+		return nil, false, true
+	}
+	if ok {
+		value = v.Value.(*cacheItem).value
+	}
+	c.access(key, value, ok)
+	return value, ok, false
+}
+
+// expire removes the key if it is still expired.
+func (c *FIFOCache) expire(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.hash[key]; ok && elem.Value.(*cacheItem).expired(c.now()) {
+		c.remove(elem, EventExpire)
+	}
+}
+
+// Peek retrieves the value associated with the given key without updating the stats.
+func (c *FIFOCache) Peek(key string) (any, bool) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	if v, ok := c.hash[key]; ok {
+	if v, ok := c.hash[key]; ok && !v.Value.(*cacheItem).expired(c.now()) {
 		return v.Value.(*cacheItem).value, true
 	}
 	return nil, false
 }
+
+// Remove deletes the key from the cache and reports whether it was present.
+func (c *FIFOCache) Remove(key string) bool {
+	defer c.flush()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.hash[key]
+	if !ok {
+		return false
+	}
+	c.remove(elem, EventRemove)
+	return true
+}
+
+// Len returns the number of entries in the cache.
+func (c *FIFOCache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.count
+}
+
+// Purge removes all entries from the cache.
+func (c *FIFOCache) Purge() {
+	defer c.flush()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for elem := c.list.Front(); elem != nil; elem = elem.Next() {
+		item := elem.Value.(*cacheItem)
+		c.observe(EventRemove, item.key, item.value)
+	}
+	c.hash = make(map[string]*list.Element)
+	c.list.Init()
+	c.count = 0
+}
+
+// Resize changes the capacity of the cache, evicting the oldest entries if needed.
+// It returns the number of evicted entries.
+func (c *FIFOCache) Resize(capacity int) int {
+	if capacity <= 0 {
+		panic("capacity must be greater than 0")
+	}
+	defer c.flush()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.capacity = capacity
+	evicted := 0
+	for c.count > c.capacity {
+		c.evict()
+		evicted++
+	}
+	return evicted
+}
+
+// Range iterates the entries from the newest to the oldest.
+func (c *FIFOCache) Range(fn func(key string, value any) bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := c.now()
+	for elem := c.list.Front(); elem != nil; elem = elem.Next() {
+		item := elem.Value.(*cacheItem)
+		if !item.expired(now) && !fn(item.key, item.value) {
+			return
+		}
+	}
+}
+
+// Stats returns a snapshot of the cache counters.
+func (c *FIFOCache) Stats() Stats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.snapshot(c.count, c.capacity)
+}
+
+// evict removes the oldest element from the cache.
+func (c *FIFOCache) evict() {
+	c.remove(c.list.Back(), EventEvict)
+}
+
+func (c *FIFOCache) remove(elem *list.Element, kind EventKind) {
+	item := elem.Value.(*cacheItem)
+	delete(c.hash, item.key)
+	c.list.Remove(elem)
+	c.count--
+	c.observe(kind, item.key, item.value)
+}
@@ -82,3 +82,44 @@ func TestFIFOCache_MoveToFront(t *testing.T) {
 		t.Errorf("expected value3, got %v", val)
 	}
 }
+
+func TestFIFOCache_PeekRemoveAndPurge(t *testing.T) {
+	cache := NewFIFOCache(2)
+	cache.Add("a", 1)
+	cache.Add("b", 2)
+
+	value, found := cache.Peek("a")
+	assert.True(t, found)
+	assert.Equal(t, 1, value)
+	assert.Equal(t, uint64(0), cache.Stats().Hits)
+
+	assert.True(t, cache.Remove("a"))
+	assert.False(t, cache.Remove("a"))
+	assert.Equal(t, 1, cache.Len())
+
+	cache.Purge()
+	assert.Equal(t, 0, cache.Len())
+	cache.Add("c", 3)
+	assert.Equal(t, 1, cache.Len())
+}
+
+func TestFIFOCache_ResizeAndRange(t *testing.T) {
+	cache := NewFIFOCache(4)
+	for i, k := range []string{"a", "b", "c", "d"} {
+		cache.Add(k, i)
+	}
+
+	assert.Panics(t, func() { cache.Resize(-1) })
+	assert.Equal(t, 2, cache.Resize(2))
+
+	var keys []string
+	cache.Range(func(key string, _ any) bool {
+		keys = append(keys, key)
+		return false
+	})
+	assert.Equal(t, []string{"d"}, keys)
+
+	_, found := cache.Get("b")
+	assert.False(t, found, "Expected 'b' to be evicted")
+	assert.Equal(t, Stats{Len: 2, Capacity: 2, Hits: 0, Misses: 1, Evictions: 2}, cache.Stats())
+}
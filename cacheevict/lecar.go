@@ -0,0 +1,361 @@
+package cacheevict
+
+import (
+	"container/list"
+	"math"
+	"math/rand/v2"
+	"sync"
+)
+
+const (
+	// lecarLRU and lecarLFU index the experts of a LeCaRCache.
+	lecarLRU = 0
+	lecarLFU = 1
+
+	// lecarLearningRate is the learning rate λ used to update the expert weights.
+	lecarLearningRate = 0.45
+	// lecarMinWeight keeps an expert from being ignored forever,
+	// so the cache can still follow the workload when it shifts again.
+	lecarMinWeight = 0.01
+)
+
+// LeCaRCache is a cache using the LeCaR (Learning Cache Replacement) algorithm.
+// It keeps an LRU and an LFU expert over the same entries. On eviction one of
+// them is picked at random according to its weight, and the victim is remembered
+// in that expert's ghost history. A miss on a key found in a ghost history is the
+// regret of the expert that evicted it, whose weight is then decreased, so the
+// cache moves online towards the policy that fits the current workload.
+// ref: https://www.usenix.org/conference/hotstorage18/presentation/vietri
+type LeCaRCache struct {
+	mu       sync.Mutex
+	capacity int
+
+	// time is a logical clock ticking on every request,
+	// used to discount the regret of entries that stayed long in a history.
+	time     uint64
+	discount float64
+	weights  [2]float64
+	rand     *rand.Rand
+
+	hash    map[string]*lecarEntry
+	recency *list.List         // LRU expert, most recently used at front
+	freq    map[int]*list.List // LFU expert, most recently used at front of each list
+	minFreq int
+	ghosts  [2]*lecarHistory
+
+	base
+}
+
+type lecarEntry struct {
+	cacheItem
+	freq        int
+	recencyElem *list.Element
+	freqElem    *list.Element
+}
+
+// lecarHistory is a bounded FIFO of the keys evicted by an expert.
+type lecarHistory struct {
+	list *list.List
+	hash map[string]*list.Element
+}
+
+type lecarGhost struct {
+	key       string
+	freq      int
+	evictedAt uint64
+}
+
+// NewLeCaRCache creates a new LeCaRCache with the given capacity.
+// It panics if the capacity is less than or equal to 0.
+func NewLeCaRCache(capacity int) *LeCaRCache {
+	if capacity <= 0 {
+		panic("capacity must be greater than 0")
+	}
+	c := &LeCaRCache{
+		weights: [2]float64{0.5, 0.5},
+		rand:    rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())), //nolint:gosec // eviction needs no secure source
+	}
+	c.reset(capacity)
+	return c
+}
+
+// Add inserts a key-value pair into the cache. If the key is in a ghost history,
+// the expert that evicted it is penalized and its frequency is restored.
+func (c *LeCaRCache) Add(key string, value any) {
+	defer c.flush()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.time++
+
+	if e, ok := c.hash[key]; ok {
+		e.value = value
+		e.expireAt = c.deadline()
+		c.touch(e)
+		c.observe(EventUpdate, key, value)
+		return
+	}
+
+	freq := 0
+	for i, h := range c.ghosts {
+		if g, ok := h.remove(key); ok {
+			c.learn(i, c.time-g.evictedAt)
+			freq = g.freq
+		}
+	}
+
+	if len(c.hash) >= c.capacity {
+		c.evict()
+	}
+
+	e := &lecarEntry{cacheItem: cacheItem{key: key, value: value, expireAt: c.deadline()}, freq: freq}
+	e.recencyElem = c.recency.PushFront(e)
+	c.hash[key] = e
+	c.bumpFreq(e)
+	c.observe(EventInsert, key, value)
+}
+
+// Get retrieves the value for a given key from the cache.
+func (c *LeCaRCache) Get(key string) (any, bool) {
+	defer c.flush()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.time++
+
+	e, ok := c.hash[key]
+	if ok && e.expired(c.now()) {
+		c.remove(e, EventExpire)
+		ok = false
+	}
+	if !ok {
+		c.access(key, nil, false)
+		return nil, false
+	}
+	c.touch(e)
+	c.access(key, e.value, true)
+	return e.value, true
+}
+
+// Peek retrieves the value for a given key without updating the experts.
+func (c *LeCaRCache) Peek(key string) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.hash[key]; ok && !e.expired(c.now()) {
+		return e.value, true
+	}
+	return nil, false
+}
+
+// Remove deletes the key from the cache and the ghost histories,
+// and reports whether it was cached.
+func (c *LeCaRCache) Remove(key string) bool {
+	defer c.flush()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, h := range c.ghosts {
+		h.remove(key)
+	}
+	e, ok := c.hash[key]
+	if !ok {
+		return false
+	}
+	c.remove(e, EventRemove)
+	return true
+}
+
+// Len returns the number of entries in the cache.
+func (c *LeCaRCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.hash)
+}
+
+// Purge removes all entries and ghost entries from the cache.
+// The learned weights are kept.
+func (c *LeCaRCache) Purge() {
+	defer c.flush()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for el := c.recency.Front(); el != nil; el = el.Next() {
+		e := el.Value.(*lecarEntry)
+		c.observe(EventRemove, e.key, e.value)
+	}
+	c.reset(c.capacity)
+}
+
+// Resize changes the capacity of the cache, letting the experts evict
+// the entries beyond it. It returns the number of evicted entries.
+func (c *LeCaRCache) Resize(capacity int) int {
+	if capacity <= 0 {
+		panic("capacity must be greater than 0")
+	}
+	defer c.flush()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.capacity = capacity
+	c.discount = lecarDiscount(capacity)
+	evicted := 0
+	for len(c.hash) > c.capacity {
+		c.evict()
+		evicted++
+	}
+	for _, h := range c.ghosts {
+		h.trim(c.capacity)
+	}
+	return evicted
+}
+
+// Range iterates the entries from the most to the least recently used.
+func (c *LeCaRCache) Range(fn func(key string, value any) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	for el := c.recency.Front(); el != nil; el = el.Next() {
+		e := el.Value.(*lecarEntry)
+		if !e.expired(now) && !fn(e.key, e.value) {
+			return
+		}
+	}
+}
+
+// Stats returns a snapshot of the cache counters.
+func (c *LeCaRCache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.snapshot(len(c.hash), c.capacity)
+}
+
+// Weights returns the current probabilities of evicting by LRU and by LFU.
+func (c *LeCaRCache) Weights() (lru, lfu float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.weights[lecarLRU], c.weights[lecarLFU]
+}
+
+// reset drops all entries and ghost entries, and sets the capacity.
+func (c *LeCaRCache) reset(capacity int) {
+	c.capacity = capacity
+	c.discount = lecarDiscount(capacity)
+	c.hash = make(map[string]*lecarEntry, capacity)
+	c.recency = list.New()
+	c.freq = make(map[int]*list.List)
+	c.minFreq = 0
+	for i := range c.ghosts {
+		c.ghosts[i] = &lecarHistory{list: list.New(), hash: make(map[string]*list.Element)}
+	}
+}
+
+// touch records an access to a cached entry in both experts.
+func (c *LeCaRCache) touch(e *lecarEntry) {
+	c.recency.MoveToFront(e.recencyElem)
+	c.bumpFreq(e)
+}
+
+// bumpFreq increments the frequency of an entry and moves it to the matching list.
+func (c *LeCaRCache) bumpFreq(e *lecarEntry) {
+	if e.freqElem != nil {
+		l := c.freq[e.freq]
+		l.Remove(e.freqElem)
+		if l.Len() == 0 {
+			delete(c.freq, e.freq)
+			if e.freq == c.minFreq {
+				c.minFreq++
+			}
+		}
+	}
+	e.freq++
+	if c.freq[e.freq] == nil {
+		c.freq[e.freq] = list.New()
+	}
+	e.freqElem = c.freq[e.freq].PushFront(e)
+	if c.minFreq == 0 || e.freq < c.minFreq {
+		c.minFreq = e.freq
+	}
+}
+
+// resetMinFreq recomputes the minimum frequency of the cached entries.
+func (c *LeCaRCache) resetMinFreq() {
+	c.minFreq = 0
+	for freq := range c.freq {
+		if c.minFreq == 0 || freq < c.minFreq {
+			c.minFreq = freq
+		}
+	}
+}
+
+// unlink removes an entry from the store and both experts.
+func (c *LeCaRCache) unlink(e *lecarEntry) {
+	c.recency.Remove(e.recencyElem)
+	l := c.freq[e.freq]
+	l.Remove(e.freqElem)
+	if l.Len() == 0 {
+		delete(c.freq, e.freq)
+	}
+	delete(c.hash, e.key)
+}
+
+// evict removes the victim of a randomly chosen expert. The victim is blamed on
+// that expert by adding it to its history, unless both experts agree on it.
+func (c *LeCaRCache) evict() {
+	lruVictim := c.recency.Back().Value.(*lecarEntry)
+	lfuVictim := c.freq[c.minFreq].Back().Value.(*lecarEntry)
+
+	expert, victim := lecarLFU, lfuVictim
+	if c.rand.Float64() < c.weights[lecarLRU] {
+		expert, victim = lecarLRU, lruVictim
+	}
+
+	c.remove(victim, EventEvict)
+	if lruVictim != lfuVictim {
+		c.ghosts[expert].add(lecarGhost{key: victim.key, freq: victim.freq, evictedAt: c.time}, c.capacity)
+	}
+}
+
+// remove removes an entry from the cache without remembering it in a history.
+func (c *LeCaRCache) remove(e *lecarEntry, kind EventKind) {
+	c.unlink(e)
+	c.resetMinFreq()
+	c.observe(kind, e.key, e.value)
+}
+
+// learn penalizes the expert whose evicted key was requested again,
+// the regret being discounted by the time the key spent in the history.
+func (c *LeCaRCache) learn(expert int, age uint64) {
+	regret := math.Pow(c.discount, float64(age))
+	c.weights[expert] *= math.Exp(-lecarLearningRate * regret)
+
+	sum := c.weights[lecarLRU] + c.weights[lecarLFU]
+	for i := range c.weights {
+		c.weights[i] = min(max(c.weights[i]/sum, lecarMinWeight), 1-lecarMinWeight)
+	}
+}
+
+// lecarDiscount returns the discount rate of the regret, such that
+// the regret of a key that stayed in a history for capacity requests is 0.005.
+func lecarDiscount(capacity int) float64 {
+	return math.Pow(0.005, 1/float64(capacity))
+}
+
+func (h *lecarHistory) add(g lecarGhost, capacity int) {
+	h.hash[g.key] = h.list.PushFront(g)
+	h.trim(capacity)
+}
+
+func (h *lecarHistory) remove(key string) (lecarGhost, bool) {
+	el, ok := h.hash[key]
+	if !ok {
+		return lecarGhost{}, false
+	}
+	h.list.Remove(el)
+	delete(h.hash, key)
+	return el.Value.(lecarGhost), true
+}
+
+// trim drops the oldest ghosts beyond the capacity.
+func (h *lecarHistory) trim(capacity int) {
+	for h.list.Len() > capacity {
+		el := h.list.Back()
+		h.list.Remove(el)
+		delete(h.hash, el.Value.(lecarGhost).key)
+	}
+}
@@ -0,0 +1,154 @@
+package cacheevict
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// replay requests the keys of the trace one by one, adding them on miss,
+// and returns the hit ratio of the cache over the trace.
+func replay(c Cache, trace []string) float64 {
+	hits := 0
+	for _, key := range trace {
+		if _, ok := c.Get(key); ok {
+			hits++
+			continue
+		}
+		c.Add(key, key)
+	}
+	return float64(hits) / float64(len(trace))
+}
+
+// frequencyTrace keeps requesting a small hot set, each key twice in a row,
+// while scanning keys that are requested only once.
+func frequencyTrace(rounds, hot, scan int) []string {
+	var trace []string
+	for r := 0; r < rounds; r++ {
+		for i := 0; i < hot; i++ {
+			key := fmt.Sprintf("hot-%d", i)
+			trace = append(trace, key, key)
+		}
+		for i := 0; i < scan; i++ {
+			trace = append(trace, fmt.Sprintf("scan-%d-%d", r, i))
+		}
+	}
+	return trace
+}
+
+// recencyTrace requests each new key a few times shortly after it first appears,
+// so the recently used keys are the ones worth keeping.
+func recencyTrace(keys, span int) []string {
+	var trace []string
+	for i := 0; i < keys; i++ {
+		for j := 0; j < span && j <= i; j++ {
+			trace = append(trace, fmt.Sprintf("new-%d", i-j))
+		}
+	}
+	return trace
+}
+
+func TestLeCaRCache_New(t *testing.T) {
+	assert.Panics(t, func() { NewLeCaRCache(0) })
+
+	c := NewLeCaRCache(2)
+	lru, lfu := c.Weights()
+	assert.Equal(t, 0.5, lru)
+	assert.Equal(t, 0.5, lfu)
+	assert.Equal(t, LECAR, Policy("lecar"))
+	assert.IsType(t, &LeCaRCache{}, New(LECAR, 2))
+}
+
+func TestLeCaRCache_AddAndGet(t *testing.T) {
+	c := NewLeCaRCache(2)
+	c.Add("a", 1)
+	c.Add("b", 2)
+	c.Add("a", 10)
+
+	value, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 10, value)
+	_, ok = c.Get("c")
+	assert.False(t, ok)
+
+	// "b" is both the least recently and the least frequently used,
+	// so it is evicted whichever expert is chosen, and no expert is blamed.
+	c.Add("c", 3)
+	_, ok = c.Peek("b")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.ghosts[lecarLRU].list.Len()+c.ghosts[lecarLFU].list.Len())
+	assert.Equal(t, Stats{Len: 2, Capacity: 2, Hits: 1, Misses: 1, Evictions: 1}, c.Stats())
+}
+
+func TestLeCaRCache_RegretUpdatesWeights(t *testing.T) {
+	c := NewLeCaRCache(2)
+	c.ghosts[lecarLRU].add(lecarGhost{key: "a", freq: 3}, c.capacity)
+
+	c.Add("a", 1)
+	lru, lfu := c.Weights()
+	assert.Less(t, lru, lfu, "LRU evicted 'a' by mistake and should be penalized")
+	assert.InDelta(t, 1, lru+lfu, 1e-9)
+	assert.Equal(t, 4, c.hash["a"].freq, "frequency should be restored from the history")
+	assert.Equal(t, 0, c.ghosts[lecarLRU].list.Len())
+}
+
+func TestLeCaRCache_RemovePurgeResizeAndRange(t *testing.T) {
+	c := NewLeCaRCache(4)
+	for i, key := range []string{"a", "b", "c", "d"} {
+		c.Add(key, i)
+	}
+	c.Get("a")
+
+	var keys []string
+	c.Range(func(key string, _ any) bool {
+		keys = append(keys, key)
+		return len(keys) < 2
+	})
+	assert.Equal(t, []string{"a", "d"}, keys)
+
+	assert.True(t, c.Remove("b"))
+	assert.False(t, c.Remove("b"))
+	assert.Equal(t, 3, c.Len())
+
+	assert.Panics(t, func() { c.Resize(0) })
+	assert.Equal(t, 2, c.Resize(1))
+	assert.Equal(t, 1, c.Len())
+	assert.LessOrEqual(t, c.ghosts[lecarLRU].list.Len(), 1)
+	assert.LessOrEqual(t, c.ghosts[lecarLFU].list.Len(), 1)
+
+	c.Purge()
+	assert.Equal(t, 0, c.Len())
+	c.Add("e", 5)
+	value, ok := c.Get("e")
+	assert.True(t, ok)
+	assert.Equal(t, 5, value)
+}
+
+func TestLeCaRCache_AdaptsToPhaseChanges(t *testing.T) {
+	const capacity = 20
+	c := NewLeCaRCache(capacity)
+	c.rand = rand.New(rand.NewPCG(1, 2)) //nolint:gosec // a fixed seed makes the test reproducible
+	lruCache := NewLRUCache(capacity)
+	lfuCache := NewLFUCache(capacity)
+
+	// frequency phase: LRU keeps evicting the hot keys to make room for the scan
+	trace := frequencyTrace(200, capacity/2, capacity)
+	lecarHits, lruHits, lfuHits := replay(c, trace), replay(lruCache, trace), replay(lfuCache, trace)
+	lru, lfu := c.Weights()
+	assert.Greater(t, lfu, 0.9, "LFU should be preferred on a frequency-heavy workload")
+	assert.Less(t, lru, 0.1)
+	assert.Greater(t, lecarHits, lruHits)
+	assert.InDelta(t, lfuHits, lecarHits, 0.05)
+
+	// recency phase: the old hot keys are never requested again,
+	// LFU keeps them and evicts the new keys that are about to be requested
+	trace = recencyTrace(2000, 3)
+	lecarHits, lruHits, lfuHits = replay(c, trace), replay(lruCache, trace), replay(lfuCache, trace)
+	lru, lfu = c.Weights()
+	assert.Greater(t, lru, 0.9, "LRU should be preferred on a recency-heavy workload")
+	assert.Less(t, lfu, 0.1)
+	assert.Greater(t, lecarHits, lfuHits)
+	assert.InDelta(t, lruHits, lecarHits, 0.05)
+}
@@ -2,6 +2,8 @@ package cacheevict
 
 import (
 	"container/list"
+	"maps"
+	"slices"
 	"sync"
 )
 
@@ -12,6 +14,7 @@ type LFUCache struct {
 	hash     map[string]*list.Element
 	freq     map[int]*list.List
 	minFreq  int
+	base
 }
 
 type lfuEntry struct {
@@ -37,6 +40,7 @@ func NewLFUCache(capacity int) *LFUCache {
 // If the key already exists, it updates the value and increments the frequency.
 // If the cache is full, it evicts the least frequently used item.
 func (c *LFUCache) Add(key string, value any) {
+	defer c.flush()
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -51,8 +55,9 @@ func (c *LFUCache) Add(key string, value any) {
 
 	entry := &lfuEntry{
 		cacheItem: cacheItem{
-			key:   key,
-			value: value,
+			key:      key,
+			value:    value,
+			expireAt: c.deadline(),
 		},
 		freq: 1,
 	}
@@ -63,28 +68,131 @@ func (c *LFUCache) Add(key string, value any) {
 	elem := c.freq[1].PushFront(entry)
 	c.hash[key] = elem
 	c.minFreq = 1
+	c.observe(EventInsert, key, value)
 }
 
 // Get retrieves the value for a given key from the cache.
 // It returns the value and true if the key exists, otherwise it returns nil and false.
 func (c *LFUCache) Get(key string) (any, bool) {
+	defer c.flush()
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if elem, ok := c.hash[key]; ok {
-		entry := elem.Value.(*lfuEntry)
-		c.incrementFreq(entry)
-		return entry.value, true
+	elem, ok := c.hash[key]
+	if ok && elem.Value.(*lfuEntry).expired(c.now()) {
+		c.remove(elem, EventExpire)
+		ok = false
 	}
+	if !ok {
+		c.access(key, nil, false)
+		return nil, false
+	}
+
+	entry := elem.Value.(*lfuEntry)
+	c.incrementFreq(entry)
+	c.access(key, entry.value, true)
+	return entry.value, true
+}
 
+// Peek retrieves the value for a given key without incrementing its frequency.
+func (c *LFUCache) Peek(key string) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.hash[key]; ok && !elem.Value.(*lfuEntry).expired(c.now()) {
+		return elem.Value.(*lfuEntry).value, true
+	}
 	return nil, false
 }
 
+// Remove deletes the key from the cache and reports whether it was present.
+func (c *LFUCache) Remove(key string) bool {
+	defer c.flush()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.hash[key]
+	if !ok {
+		return false
+	}
+	c.remove(elem, EventRemove)
+	return true
+}
+
+// Len returns the number of entries in the cache.
+func (c *LFUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.hash)
+}
+
+// Purge removes all entries from the cache.
+func (c *LFUCache) Purge() {
+	defer c.flush()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, elem := range c.hash {
+		c.observe(EventRemove, key, elem.Value.(*lfuEntry).value)
+	}
+	c.hash = make(map[string]*list.Element, c.capacity)
+	c.freq = make(map[int]*list.List)
+	c.minFreq = 0
+}
+
+// Resize changes the capacity of the cache, evicting the least frequently used
+// entries if needed. It returns the number of evicted entries.
+func (c *LFUCache) Resize(capacity int) int {
+	if capacity <= 0 {
+		panic("capacity must be greater than 0")
+	}
+	defer c.flush()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.capacity = capacity
+	evicted := 0
+	for len(c.hash) > c.capacity {
+		c.evict()
+		c.resetMinFreq()
+		evicted++
+	}
+	return evicted
+}
+
+// Range iterates the entries from the most to the least frequently used.
+// Entries with the same frequency are visited from the most recently used.
+func (c *LFUCache) Range(fn func(key string, value any) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	freqs := slices.Sorted(maps.Keys(c.freq))
+	slices.Reverse(freqs)
+	for _, freq := range freqs {
+		for elem := c.freq[freq].Front(); elem != nil; elem = elem.Next() {
+			entry := elem.Value.(*lfuEntry)
+			if !entry.expired(now) && !fn(entry.key, entry.value) {
+				return
+			}
+		}
+	}
+}
+
+// Stats returns a snapshot of the cache counters.
+func (c *LFUCache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.snapshot(len(c.hash), c.capacity)
+}
+
 // update updates the value of an existing entry and increments its frequency.
 func (c *LFUCache) update(elem *list.Element, value any) {
 	entry := elem.Value.(*lfuEntry)
 	entry.value = value
+	entry.expireAt = c.deadline()
 	c.incrementFreq(entry)
+	c.observe(EventUpdate, entry.key, value)
 }
 
 // incrementFreq increments the frequency of an entry and moves it to the appropriate frequency list.
@@ -122,5 +230,31 @@ func (c *LFUCache) evict() {
 		if l.Len() == 0 {
 			delete(c.freq, c.minFreq)
 		}
+		c.observe(EventEvict, entry.key, entry.value)
+	}
+}
+
+// remove removes an arbitrary entry from the cache.
+func (c *LFUCache) remove(elem *list.Element, kind EventKind) {
+	entry := elem.Value.(*lfuEntry)
+	l := c.freq[entry.freq]
+	l.Remove(elem)
+	delete(c.hash, entry.key)
+	if l.Len() == 0 {
+		delete(c.freq, entry.freq)
+		if entry.freq == c.minFreq {
+			c.resetMinFreq()
+		}
+	}
+	c.observe(kind, entry.key, entry.value)
+}
+
+// resetMinFreq recomputes the minimum frequency after an arbitrary entry was removed.
+func (c *LFUCache) resetMinFreq() {
+	c.minFreq = 0
+	for freq := range c.freq {
+		if c.minFreq == 0 || freq < c.minFreq {
+			c.minFreq = freq
+		}
 	}
 }
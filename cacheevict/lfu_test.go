@@ -87,3 +87,54 @@ func TestLFUCache_UpdateFrequency(t *testing.T) {
 		t.Errorf("expected to get 3, got %v", val)
 	}
 }
+
+func TestLFUCache_PeekRemoveAndPurge(t *testing.T) {
+	cache := NewLFUCache(2)
+	cache.Add("a", 1)
+	cache.Add("b", 2)
+	cache.Get("b")
+
+	// peek should not increase the frequency of "a"
+	value, found := cache.Peek("a")
+	assert.True(t, found)
+	assert.Equal(t, 1, value)
+
+	// removing the only entry with the min frequency should keep eviction working
+	assert.True(t, cache.Remove("a"))
+	assert.False(t, cache.Remove("a"))
+	cache.Add("c", 3)
+	cache.Add("d", 4)
+	_, found = cache.Peek("c")
+	assert.False(t, found, "Expected 'c' to be evicted")
+	_, found = cache.Peek("b")
+	assert.True(t, found)
+
+	cache.Purge()
+	assert.Equal(t, 0, cache.Len())
+	cache.Add("e", 5)
+	assert.Equal(t, 1, cache.Len())
+}
+
+func TestLFUCache_ResizeAndRange(t *testing.T) {
+	cache := NewLFUCache(4)
+	for i, k := range []string{"a", "b", "c", "d"} {
+		cache.Add(k, i)
+	}
+	cache.Get("c")
+	cache.Get("c")
+	cache.Get("a")
+
+	assert.Panics(t, func() { cache.Resize(0) })
+	assert.Equal(t, 2, cache.Resize(2))
+
+	var keys []string
+	cache.Range(func(key string, _ any) bool {
+		keys = append(keys, key)
+		return true
+	})
+	assert.Equal(t, []string{"c", "a"}, keys)
+
+	cache.Add("e", 4)
+	assert.Equal(t, 2, cache.Len())
+	assert.Equal(t, Stats{Len: 2, Capacity: 2, Hits: 3, Misses: 0, Evictions: 3}, cache.Stats())
+}
@@ -9,6 +9,7 @@ import (
 type LRUCache struct {
 	mu       sync.Mutex
 	capacity int
+	base
 
 	// hash contains the cached values key and index mapper
 	hash map[string]*datastructure.DoublyLinkedNode[cacheItem]
@@ -17,7 +18,6 @@ type LRUCache struct {
 	link *datastructure.DoublyLinked[cacheItem]
 }
 
-
 func NewLRUCache(capacity int) *LRUCache {
 	if capacity <= 0 {
 		panic("capacity must be greater than 0")
@@ -30,36 +30,132 @@ func NewLRUCache(capacity int) *LRUCache {
 }
 
 func (lru *LRUCache) Add(k string, v any) {
+	defer lru.flush()
 	lru.mu.Lock()
 	defer lru.mu.Unlock()
 
 	node, exists := lru.hash[k]
 	if exists {
 		node.Value.value = v // update the value
+		node.Value.expireAt = lru.deadline()
 		lru.refresh(k, node)
+		lru.observe(EventUpdate, k, v)
 	} else {
 		if lru.link.Count() >= lru.capacity {
 			lru.evict()
 		}
 		lru.put(k, v)
+		lru.observe(EventInsert, k, v)
 	}
 }
 
 func (lru *LRUCache) Get(k string) (any, bool) {
+	defer lru.flush()
 	lru.mu.Lock()
 	defer lru.mu.Unlock()
 
-	if node, ok := lru.hash[k]; ok {
-		lru.refresh(k, node)
+	node, ok := lru.hash[k]
+	if ok && node.Value.expired(lru.now()) {
+		lru.remove(node, EventExpire)
+		ok = false
+	}
+	if !ok {
+		lru.access(k, nil, false)
+		return nil, false
+	}
+	lru.refresh(k, node)
+	lru.access(k, node.Value.value, true)
+	return node.Value.value, true
+}
+
+// Peek returns the value of the key without marking it as recently used.
+func (lru *LRUCache) Peek(k string) (any, bool) {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
+	if node, ok := lru.hash[k]; ok && !node.Value.expired(lru.now()) {
 		return node.Value.value, true
 	}
 	return nil, false
 }
 
+// Remove deletes the key from the cache and reports whether it was present.
+func (lru *LRUCache) Remove(k string) bool {
+	defer lru.flush()
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
+	node, ok := lru.hash[k]
+	if !ok {
+		return false
+	}
+	lru.remove(node, EventRemove)
+	return true
+}
+
+// Len returns the number of entries in the cache.
+func (lru *LRUCache) Len() int {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+	return lru.link.Count()
+}
+
+// Purge removes all entries from the cache.
+func (lru *LRUCache) Purge() {
+	defer lru.flush()
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
+	lru.link.Range(func(item cacheItem) bool {
+		lru.observe(EventRemove, item.key, item.value)
+		return true
+	})
+	lru.hash = make(map[string]*datastructure.DoublyLinkedNode[cacheItem], lru.capacity)
+	lru.link = datastructure.NewDoublyLinked[cacheItem]()
+}
+
+// Resize changes the capacity of the cache, evicting the least recently used
+// entries if needed. It returns the number of evicted entries.
+func (lru *LRUCache) Resize(capacity int) int {
+	if capacity <= 0 {
+		panic("capacity must be greater than 0")
+	}
+	defer lru.flush()
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
+	lru.capacity = capacity
+	evicted := 0
+	for lru.link.Count() > lru.capacity {
+		lru.evict()
+		evicted++
+	}
+	return evicted
+}
+
+// Range iterates the entries from the most to the least recently used.
+func (lru *LRUCache) Range(fn func(key string, value any) bool) {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
+	now := lru.now()
+	lru.link.ReverseRange(func(item cacheItem) bool {
+		return item.expired(now) || fn(item.key, item.value)
+	})
+}
+
+// Stats returns a snapshot of the cache counters.
+func (lru *LRUCache) Stats() Stats {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+	return lru.snapshot(lru.link.Count(), lru.capacity)
+}
+
 func (lru *LRUCache) put(k string, v any) {
 	lru.hash[k] = lru.link.AddToTail(cacheItem{
-		key:   k,
-		value: v,
+		key:      k,
+		value:    v,
+		expireAt: lru.deadline(),
 	})
 }
 
@@ -68,6 +164,11 @@ func (lru *LRUCache) refresh(k string, node *datastructure.DoublyLinkedNode[cach
 }
 
 func (lru *LRUCache) evict() {
-	node := lru.link.RemoveFromHead()
+	lru.remove(lru.link.Head(), EventEvict)
+}
+
+func (lru *LRUCache) remove(node *datastructure.DoublyLinkedNode[cacheItem], kind EventKind) {
+	lru.link.Remove(node)
 	delete(lru.hash, node.Value.key)
+	lru.observe(kind, node.Value.key, node.Value.value)
 }
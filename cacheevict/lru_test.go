@@ -178,3 +178,57 @@ func TestLRUCache_AddAndEvictMultipleTimes(t *testing.T) {
 	assert.True(t, found, "Expected to find key 'd'")
 	assert.Equal(t, 4, value, "Expected value 4 for key 'd'")
 }
+
+func TestLRUCache_PeekRemoveAndPurge(t *testing.T) {
+	cache := NewLRUCache(2)
+	cache.Add("a", 1)
+	cache.Add("b", 2)
+
+	// peek should not refresh "a", so "a" is still evicted first
+	value, found := cache.Peek("a")
+	assert.True(t, found)
+	assert.Equal(t, 1, value)
+	cache.Add("c", 3)
+	_, found = cache.Peek("a")
+	assert.False(t, found, "Expected 'a' to be evicted")
+
+	assert.True(t, cache.Remove("b"))
+	assert.False(t, cache.Remove("b"))
+	assert.Equal(t, 1, cache.Len())
+
+	cache.Purge()
+	assert.Equal(t, 0, cache.Len())
+	_, found = cache.Get("c")
+	assert.False(t, found)
+}
+
+func TestLRUCache_ResizeAndRange(t *testing.T) {
+	cache := NewLRUCache(4)
+	for i, k := range []string{"a", "b", "c", "d"} {
+		cache.Add(k, i)
+	}
+	cache.Get("a")
+
+	assert.Panics(t, func() { cache.Resize(0) })
+	assert.Equal(t, 2, cache.Resize(2))
+
+	var keys []string
+	cache.Range(func(key string, _ any) bool {
+		keys = append(keys, key)
+		return true
+	})
+	assert.Equal(t, []string{"a", "d"}, keys)
+
+	cache.Add("e", 4)
+	assert.Equal(t, 2, cache.Len())
+}
+
+func TestLRUCache_Stats(t *testing.T) {
+	cache := NewLRUCache(1)
+	cache.Add("a", 1)
+	cache.Get("a")
+	cache.Get("b")
+	cache.Add("b", 2)
+
+	assert.Equal(t, Stats{Len: 1, Capacity: 1, Hits: 1, Misses: 1, Evictions: 1}, cache.Stats())
+}
@@ -0,0 +1,71 @@
+package datastructure
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// BloomFilter is a space-efficient probabilistic set.
+// It may report that it contains data never added (false positive),
+// but never misses data that was added.
+type BloomFilter struct {
+	bits []uint64
+	m    uint64 // number of bits
+	k    uint64 // number of hash functions
+}
+
+// NewBloomFilter creates a BloomFilter sized to hold n elements with
+// the given false positive rate.
+// It panics if n is not positive or the rate is not in (0, 1).
+func NewBloomFilter(n int, falsePositiveRate float64) *BloomFilter {
+	if n <= 0 {
+		panic("n must be greater than 0")
+	}
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		panic("false positive rate must be in (0, 1)")
+	}
+
+	// m = -n*ln(p) / ln(2)^2, k = m/n * ln(2)
+	m := uint64(math.Ceil(-float64(n) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	k := uint64(max(1, math.Round(float64(m)/float64(n)*math.Ln2)))
+	return &BloomFilter{
+		bits: make([]uint64, (m+63)/64),
+		m:    m,
+		k:    k,
+	}
+}
+
+// Add adds the data to the filter.
+func (bf *BloomFilter) Add(data []byte) {
+	h1, h2 := bf.hash(data)
+	for i := uint64(0); i < bf.k; i++ {
+		idx := (h1 + i*h2) % bf.m
+		bf.bits[idx/64] |= 1 << (idx % 64)
+	}
+}
+
+// Contains reports whether the data may have been added to the filter.
+func (bf *BloomFilter) Contains(data []byte) bool {
+	h1, h2 := bf.hash(data)
+	for i := uint64(0); i < bf.k; i++ {
+		idx := (h1 + i*h2) % bf.m
+		if bf.bits[idx/64]&(1<<(idx%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Reset clears the filter.
+func (bf *BloomFilter) Reset() {
+	clear(bf.bits)
+}
+
+// hash derives the two hashes used to simulate the k hash functions
+// by double hashing: h(i) = h1 + i*h2.
+func (bf *BloomFilter) hash(data []byte) (h1, h2 uint64) {
+	h := fnv.New64a()
+	_, _ = h.Write(data)
+	sum := h.Sum64()
+	return sum & math.MaxUint32, sum>>32 | 1
+}
@@ -0,0 +1,49 @@
+package datastructure
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewBloomFilter(t *testing.T) {
+	t.Run("invalid args should panic", func(t *testing.T) {
+		assert.Panics(t, func() { NewBloomFilter(0, 0.01) })
+		assert.Panics(t, func() { NewBloomFilter(10, 0) })
+		assert.Panics(t, func() { NewBloomFilter(10, 1) })
+	})
+
+	t.Run("valid args should size the filter", func(t *testing.T) {
+		bf := NewBloomFilter(1000, 0.01)
+		assert.Equal(t, uint64(9586), bf.m)
+		assert.Equal(t, uint64(7), bf.k)
+		assert.Equal(t, 150, len(bf.bits))
+	})
+}
+
+func TestBloomFilter_AddAndContains(t *testing.T) {
+	const n = 1000
+	bf := NewBloomFilter(n, 0.01)
+
+	for i := 0; i < n; i++ {
+		bf.Add([]byte(strconv.Itoa(i)))
+	}
+
+	// no false negatives
+	for i := 0; i < n; i++ {
+		assert.True(t, bf.Contains([]byte(strconv.Itoa(i))))
+	}
+
+	// false positives stay around the expected rate
+	falsePositives := 0
+	for i := n; i < 11*n; i++ {
+		if bf.Contains([]byte(strconv.Itoa(i))) {
+			falsePositives++
+		}
+	}
+	assert.Less(t, float64(falsePositives)/(10*n), 0.02)
+
+	bf.Reset()
+	assert.False(t, bf.Contains([]byte("0")))
+}
@@ -124,3 +124,13 @@ func (d *DoublyLinked[T]) Range(fn func(T) bool) {
 		cur = cur.next
 	}
 }
+
+func (d *DoublyLinked[T]) ReverseRange(fn func(T) bool) {
+	cur := d.tail.prev
+	for cur != d.head {
+		if !fn(cur.Value) {
+			break
+		}
+		cur = cur.prev
+	}
+}
@@ -170,6 +170,21 @@ func TestDoublyLinked_RangeWithEarlyExit(t *testing.T) {
 	}
 }
 
+func TestDoublyLinked_ReverseRange(t *testing.T) {
+	dll := NewDoublyLinked[int]()
+	dll.AddToTail(1)
+	dll.AddToTail(2)
+	dll.AddToTail(3)
+
+	result := []int{}
+	dll.ReverseRange(func(val int) bool {
+		result = append(result, val)
+		return val != 2 // stop iteration early
+	})
+
+	assert.Equal(t, []int{3, 2}, result)
+}
+
 // Test for various edge cases when removing nodes
 func TestDoublyLinked_RemoveEdgeCases(t *testing.T) {
 	// Edge case: Remove from an empty list
@@ -0,0 +1,180 @@
+package ratelimiter
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Default limits of an AdaptiveLimiter.
+const (
+	defaultAdaptiveInitialLimit = 20
+	defaultAdaptiveMinLimit     = 1
+	defaultAdaptiveMaxLimit     = 1000
+)
+
+// Outcome is the outcome of a request released to an AdaptiveLimiter.
+type Outcome int
+
+const (
+	// OutcomeSuccess means the request completed, its latency is sampled.
+	OutcomeSuccess Outcome = iota
+	// OutcomeDropped means the request timed out or was rejected by an overloaded downstream.
+	OutcomeDropped
+	// OutcomeIgnored means the request failed for reasons unrelated to the load,
+	// such as a client error, and is not sampled.
+	OutcomeIgnored
+)
+
+// Sample is the measure of a completed request.
+type Sample struct {
+	// RTT is the latency of the request.
+	RTT time.Duration
+	// Inflight is the number of requests in flight when it was acquired, including itself.
+	Inflight int
+	// Dropped reports whether the request was dropped.
+	Dropped bool
+}
+
+// AdaptiveAlgorithm computes the concurrency limit of an AdaptiveLimiter from the samples of the requests.
+// It is called under the lock of the limiter, so it does not need to be safe for concurrent use.
+type AdaptiveAlgorithm interface {
+	// Update returns the new limit after the sample, given the current one.
+	Update(limit float64, s Sample) float64
+}
+
+// AdaptiveLimiter limits the number of requests in flight to a limit adjusted from their latency,
+// so that a slowing downstream is protected without a static limit.
+// Requests are acquired before being sent, and released with their outcome and latency.
+type AdaptiveLimiter struct {
+	mu        sync.Mutex
+	algorithm AdaptiveAlgorithm
+	limit     float64 // The limit computed by the algorithm, within [minLimit, maxLimit]
+	minLimit  int
+	maxLimit  int
+	inflight  int
+}
+
+// Permit is a request acquired from an AdaptiveLimiter, which must be released once done.
+type Permit struct {
+	limiter  *AdaptiveLimiter
+	inflight int
+	released bool
+}
+
+type adaptiveBuilder struct {
+	algorithm    AdaptiveAlgorithm
+	initialLimit int
+	minLimit     int
+	maxLimit     int
+}
+
+// AdaptiveBuilder returns a new builder for building an adaptive limiter with the algorithm.
+func AdaptiveBuilder(algorithm AdaptiveAlgorithm) *adaptiveBuilder {
+	return &adaptiveBuilder{
+		algorithm:    algorithm,
+		initialLimit: defaultAdaptiveInitialLimit,
+		minLimit:     defaultAdaptiveMinLimit,
+		maxLimit:     defaultAdaptiveMaxLimit,
+	}
+}
+
+// InitialLimit sets the limit before the first samples, it defaults to 20.
+func (b *adaptiveBuilder) InitialLimit(limit int) *adaptiveBuilder {
+	b.initialLimit = limit
+	return b
+}
+
+// MinLimit sets the minimum limit, it defaults to 1.
+func (b *adaptiveBuilder) MinLimit(limit int) *adaptiveBuilder {
+	b.minLimit = limit
+	return b
+}
+
+// MaxLimit sets the maximum limit, it defaults to 1000.
+func (b *adaptiveBuilder) MaxLimit(limit int) *adaptiveBuilder {
+	b.maxLimit = limit
+	return b
+}
+
+// Build builds the adaptive limiter.
+func (b *adaptiveBuilder) Build() *AdaptiveLimiter {
+	if b.algorithm == nil || b.minLimit <= 0 || b.maxLimit < b.minLimit {
+		panic("unspecified algorithm or invalid limits")
+	}
+	return &AdaptiveLimiter{
+		algorithm: b.algorithm,
+		limit:     float64(min(max(b.initialLimit, b.minLimit), b.maxLimit)),
+		minLimit:  b.minLimit,
+		maxLimit:  b.maxLimit,
+	}
+}
+
+// NewAdaptiveLimiter creates a new adaptive limiter with the algorithm and the default limits.
+func NewAdaptiveLimiter(algorithm AdaptiveAlgorithm) *AdaptiveLimiter {
+	return AdaptiveBuilder(algorithm).Build()
+}
+
+// Acquire acquires a request if fewer requests than the limit are in flight.
+// It returns false if the request must be rejected, with a nil permit whose Release does nothing,
+// so that the permit can be released in any case.
+func (l *AdaptiveLimiter) Acquire() (*Permit, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.inflight >= l.limitLocked() {
+		return nil, false
+	}
+	l.inflight++
+	return &Permit{limiter: l, inflight: l.inflight}, true
+}
+
+// Release releases the request with its outcome and latency, adjusting the limit.
+// Releasing a permit more than once, or a nil permit, does nothing.
+func (p *Permit) Release(outcome Outcome, rtt time.Duration) {
+	if p == nil {
+		return
+	}
+	l := p.limiter
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if p.released {
+		return
+	}
+	p.released = true
+	l.inflight--
+	if outcome == OutcomeIgnored {
+		return
+	}
+
+	limit := l.algorithm.Update(l.limit, Sample{RTT: rtt, Inflight: p.inflight, Dropped: outcome == OutcomeDropped})
+	l.limit = min(max(limit, float64(l.minLimit)), float64(l.maxLimit))
+}
+
+// Limit returns the current limit of requests in flight.
+func (l *AdaptiveLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limitLocked()
+}
+
+// Inflight returns the number of requests in flight.
+func (l *AdaptiveLimiter) Inflight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inflight
+}
+
+// Pressure returns the fraction of the limit in flight, so that a PriorityLimiter sheds requests
+// as the limiter saturates.
+func (l *AdaptiveLimiter) Pressure() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return min(float64(l.inflight)/float64(l.limitLocked()), 1)
+}
+
+// limitLocked returns the current limit rounded down, it must be called with the lock held.
+func (l *AdaptiveLimiter) limitLocked() int {
+	return int(math.Floor(l.limit))
+}
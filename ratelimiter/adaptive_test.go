@@ -0,0 +1,175 @@
+package ratelimiter
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// constantAlgorithm is an AdaptiveAlgorithm setting the limit to its value.
+type constantAlgorithm struct {
+	limit   float64
+	samples []Sample
+}
+
+func (c *constantAlgorithm) Update(_ float64, s Sample) float64 {
+	c.samples = append(c.samples, s)
+	return c.limit
+}
+
+func TestAdaptiveLimiter(t *testing.T) {
+	alg := &constantAlgorithm{limit: 3}
+	l := AdaptiveBuilder(alg).InitialLimit(2).MinLimit(1).MaxLimit(4).Build()
+	assert.Equal(t, 2, l.Limit())
+
+	p1, ok := l.Acquire()
+	assert.True(t, ok)
+	p2, ok := l.Acquire()
+	assert.True(t, ok)
+	p3, ok := l.Acquire()
+	assert.False(t, ok, "Expected the requests beyond the limit to be rejected")
+	assert.Nil(t, p3)
+	assert.NotPanics(t, func() { p3.Release(OutcomeSuccess, time.Second) }, "Expected a rejected permit to be released safely")
+	assert.Equal(t, 2, l.Inflight())
+
+	p1.Release(OutcomeIgnored, time.Second)
+	assert.Empty(t, alg.samples, "Expected the ignored requests not to be sampled")
+	assert.Equal(t, 1, l.Inflight())
+	p1.Release(OutcomeSuccess, time.Second)
+	assert.Equal(t, 1, l.Inflight(), "Expected a permit to be released once")
+
+	p2.Release(OutcomeDropped, time.Millisecond)
+	assert.Equal(t, []Sample{{RTT: time.Millisecond, Inflight: 2, Dropped: true}}, alg.samples)
+	assert.Equal(t, 3, l.Limit())
+
+	// the limit is kept within the bounds
+	alg.limit = 10
+	p, _ := l.Acquire()
+	p.Release(OutcomeSuccess, time.Millisecond)
+	assert.Equal(t, 4, l.Limit())
+	alg.limit = 0
+	p, _ = l.Acquire()
+	p.Release(OutcomeSuccess, time.Millisecond)
+	assert.Equal(t, 1, l.Limit())
+
+	assert.Equal(t, defaultAdaptiveInitialLimit, NewAdaptiveLimiter(alg).Limit())
+	assert.Panics(t, func() { NewAdaptiveLimiter(nil) })
+	assert.Panics(t, func() { AdaptiveBuilder(alg).MinLimit(5).MaxLimit(4).Build() })
+}
+
+func TestAIMD(t *testing.T) {
+	a := NewAIMD(100 * time.Millisecond)
+	assert.InDelta(t, 10.1, a.Update(10, Sample{RTT: time.Millisecond, Inflight: 10}), 1e-9)
+	assert.InDelta(t, 10.0, a.Update(10, Sample{RTT: time.Millisecond, Inflight: 4}), 1e-9, "Expected no growth when app-limited")
+
+	assert.InDelta(t, 9.0, a.Update(10, Sample{RTT: time.Second, Inflight: 10}), 1e-9)
+	assert.InDelta(t, 9.0, a.Update(9, Sample{Dropped: true}), 1e-9, "Expected one backoff per window")
+	for i := 0; i < 8; i++ {
+		a.Update(9, Sample{RTT: time.Millisecond, Inflight: 9})
+	}
+	assert.InDelta(t, 8.1, a.Update(9, Sample{Dropped: true}), 1e-9)
+
+	assert.Panics(t, func() { NewAIMD(0, 1) })
+}
+
+func TestVegas(t *testing.T) {
+	v := NewVegas(0)
+	assert.InDelta(t, 10.0, v.Update(10, Sample{RTT: 10 * time.Millisecond, Inflight: 10}), 1e-9)
+
+	// no queue, the limit grows by beta per window
+	assert.InDelta(t, 10.6, v.Update(10, Sample{RTT: 10 * time.Millisecond, Inflight: 10}), 1e-9)
+	// a queue below alpha, it grows by the threshold per window
+	assert.InDelta(t, 10.1, v.Update(10, Sample{RTT: 12 * time.Millisecond, Inflight: 10}), 1e-9)
+	// a queue between alpha and beta, it is kept
+	assert.InDelta(t, 10.0, v.Update(10, Sample{RTT: 15 * time.Millisecond, Inflight: 10}), 1e-9)
+	// a queue beyond beta, it decreases by the threshold per window
+	assert.InDelta(t, 9.9, v.Update(10, Sample{RTT: 40 * time.Millisecond, Inflight: 10}), 1e-9)
+	assert.InDelta(t, 9.4, v.Update(10, Sample{RTT: 10 * time.Millisecond, Dropped: true}), 1e-9)
+
+	// the probe halves the limit for two windows, then restores it
+	v = NewVegas(1)
+	for i := 0; i < 3; i++ {
+		assert.InDelta(t, 4.0, v.Update(4, Sample{RTT: 10 * time.Millisecond, Inflight: 1}), 1e-9)
+	}
+	assert.InDelta(t, 2.0, v.Update(4, Sample{RTT: 10 * time.Millisecond, Inflight: 1}), 1e-9)
+	for _, rtt := range []time.Duration{30, 20, 25, 40, 20, 30, 20} {
+		assert.InDelta(t, 2.0, v.Update(2, Sample{RTT: rtt * time.Millisecond}), 1e-9)
+	}
+	assert.InDelta(t, 4.0, v.Update(2, Sample{RTT: 30 * time.Millisecond}), 1e-9)
+	assert.Equal(t, 20*time.Millisecond, v.rttNoLoad)
+}
+
+func TestGradient2(t *testing.T) {
+	g := NewGradient2()
+	assert.InDelta(t, 10.08, g.Update(10, Sample{RTT: 10 * time.Millisecond, Inflight: 10}), 1e-9)
+	assert.Equal(t, 10*time.Millisecond, g.LongRTT())
+	assert.InDelta(t, 10.0, g.Update(10, Sample{RTT: 10 * time.Millisecond, Inflight: 1}), 1e-9)
+	assert.InDelta(t, 10.0, g.Update(10, Sample{}), 1e-9)
+
+	// the latency quadruples, beyond the tolerance
+	limit := g.Update(10, Sample{RTT: 40 * time.Millisecond, Inflight: 10})
+	assert.Less(t, limit, 10.0)
+	assert.Greater(t, g.LongRTT(), 10*time.Millisecond)
+	assert.InDelta(t, 9.8, g.Update(10, Sample{RTT: 10 * time.Millisecond, Dropped: true}), 1e-9)
+}
+
+// simulate runs rounds of requests against a backend handling 'capacity' requests at once
+// in 'latency', queuing the requests beyond its capacity, and dropping the ones beyond twice
+// its capacity. Each round sends as many requests as allowed. It returns the limit after each round.
+func simulate(l *AdaptiveLimiter, capacity int, latency time.Duration, rounds int) []int {
+	limits := make([]int, 0, rounds)
+	for r := 0; r < rounds; r++ {
+		var permits []*Permit
+		for {
+			p, ok := l.Acquire()
+			if !ok {
+				break
+			}
+			permits = append(permits, p)
+		}
+		rtt := latency * time.Duration(max(len(permits), capacity)) / time.Duration(capacity)
+		for i, p := range permits {
+			if i < 2*capacity {
+				p.Release(OutcomeSuccess, rtt)
+			} else {
+				p.Release(OutcomeDropped, rtt)
+			}
+		}
+		limits = append(limits, l.Limit())
+	}
+	return limits
+}
+
+// TestAdaptiveLimiter_Simulation checks that the limit converges around the capacity of the backend,
+// and converges again when the backend slows down, then recovers.
+func TestAdaptiveLimiter_Simulation(t *testing.T) {
+	const rounds = 1000
+	for name, algorithm := range map[string]func() AdaptiveAlgorithm{
+		"aimd":      func() AdaptiveAlgorithm { return NewAIMD(30 * time.Millisecond) },
+		"vegas":     func() AdaptiveAlgorithm { return NewVegas() },
+		"gradient2": func() AdaptiveAlgorithm { return NewGradient2() },
+	} {
+		t.Run(name, func(t *testing.T) {
+			l := NewAdaptiveLimiter(algorithm())
+			for _, phase := range []struct {
+				capacity int
+				latency  time.Duration
+			}{
+				{40, 10 * time.Millisecond},
+				{10, 20 * time.Millisecond}, // the backend slows down
+				{40, 10 * time.Millisecond}, // and recovers
+			} {
+				limits := simulate(l, phase.capacity, phase.latency, rounds)
+				// the limit has converged once it stays around the capacity in the last rounds,
+				// except while Vegas probes the latency
+				last := slices.Clone(limits[rounds-rounds/10:])
+				slices.Sort(last)
+				assert.GreaterOrEqual(t, last[len(last)/2], phase.capacity, "Expected the capacity of the backend to be used")
+				// the requests beyond twice the capacity are dropped, the limit backs off from the first one
+				assert.LessOrEqual(t, last[len(last)-1], 2*phase.capacity+1, "Expected the limit to protect the backend")
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package ratelimiter
+
+import "time"
+
+// defaultAIMDBackoffRatio is the ratio the limit of AIMD is multiplied by on drops by default.
+const defaultAIMDBackoffRatio = 0.9
+
+// AIMD is an AdaptiveAlgorithm increasing the limit additively while the requests succeed,
+// and decreasing it multiplicatively once they are dropped or time out, like TCP Reno.
+// The limit grows by one per window of 'limit' requests, and backs off at most once per window.
+type AIMD struct {
+	backoffRatio float64
+	timeout      time.Duration
+	window       int // The samples left before the limit may back off again
+}
+
+// NewAIMD creates a new AIMD algorithm considering the requests slower than the timeout as dropped,
+// a zero timeout meaning that only the dropped requests make the limit back off.
+// If no backoff ratio is provided, the limit is multiplied by 0.9 on drops.
+func NewAIMD(timeout time.Duration, backoffRatio ...float64) *AIMD {
+	a := &AIMD{backoffRatio: defaultAIMDBackoffRatio, timeout: timeout}
+	if len(backoffRatio) > 0 {
+		a.backoffRatio = backoffRatio[0]
+	}
+	if a.backoffRatio <= 0 || a.backoffRatio >= 1 {
+		panic("backoff ratio must be between 0 and 1")
+	}
+	return a
+}
+
+// Update backs the limit off if the request was dropped or timed out,
+// or increases it by 1/limit if the limit is used.
+func (a *AIMD) Update(limit float64, s Sample) float64 {
+	if a.window > 0 {
+		a.window--
+	}
+	if s.Dropped || (a.timeout > 0 && s.RTT > a.timeout) {
+		if a.window > 0 {
+			return limit
+		}
+		a.window = int(limit)
+		return limit * a.backoffRatio
+	}
+	if appLimited(limit, s) {
+		return limit
+	}
+	return limit + 1/limit
+}
+
+// appLimited reports whether the requests in flight are too few for the sample to tell
+// anything about a higher limit, so that an idle limiter does not grow unbounded.
+func appLimited(limit float64, s Sample) bool {
+	return float64(s.Inflight)*2 < limit
+}
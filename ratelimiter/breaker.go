@@ -0,0 +1,381 @@
+package ratelimiter
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Defaults of a CircuitBreaker.
+const (
+	defaultBreakerConsecutiveFailures = 5
+	defaultBreakerOpenTimeout         = time.Minute
+	defaultBreakerWindow              = 10 * time.Second
+	defaultBreakerBuckets             = 10
+)
+
+// ErrCircuitOpen is returned by CircuitBreaker.Allow when the circuit is open,
+// or half-open with all its probes in flight.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerState is the state of a CircuitBreaker.
+type BreakerState int
+
+const (
+	// StateClosed lets the requests through, counting their failures.
+	StateClosed BreakerState = iota
+	// StateOpen rejects the requests until the open timeout is over.
+	StateOpen
+	// StateHalfOpen lets a few probe requests through, closing the circuit if they all succeed.
+	StateHalfOpen
+)
+
+// String returns the name of the state.
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreaker stops sending requests to a failing dependency, which rate limiting alone does not.
+//
+// The circuit is closed at first, and opens once too many requests fail: after a number of
+// consecutive failures, or once the failure rate over a sliding window reaches a threshold.
+// The requests are rejected while the circuit is open. After the open timeout, the circuit is
+// half-open and lets a few probe requests through: it closes once they all succeed, and opens
+// again as soon as one fails, or once a probe has not reported its outcome within the probe timeout,
+// so that a probe whose done function is never called does not keep the circuit half-open.
+//
+// The outcomes are counted in buckets spanning the window, like the requests of a SlidingWindowCount.
+type CircuitBreaker struct {
+	mu                  sync.Mutex
+	state               BreakerState
+	generation          uint64 // The number of state changes, to ignore the outcomes of the requests of a former state
+	window              outcomeWindow
+	consecutiveFailures int
+	maxFailures         int     // The consecutive failures opening the circuit, none if 0
+	failureRate         float64 // The failure rate opening the circuit, none if 0
+	minRequests         int     // The requests in the window before the failure rate is considered
+	openTimeout         time.Duration
+	openedAt            time.Time
+	probes              int           // The probe requests allowed in the half-open state
+	probing             int           // The probe requests let through in the half-open state
+	succeeded           int           // The probe requests succeeded in the half-open state
+	probeTimeout        time.Duration // How long the probe requests may take to report their outcome
+	probedAt            time.Time     // The time the last probe request was let through
+	onStateChange       func(from, to BreakerState)
+	changes             []stateChange // The state changes to notify once the lock is released
+	notifying           bool          // Whether a goroutine is notifying the state changes
+	clock               Clock
+}
+
+// stateChange is a change of the state of a CircuitBreaker.
+type stateChange struct {
+	from, to BreakerState
+}
+
+// outcomeWindow counts the successes and failures in buckets spanning a sliding window.
+type outcomeWindow struct {
+	bucketRing[outcomeCount]
+}
+
+// outcomeCount is the number of successes and failures of a bucket.
+type outcomeCount struct {
+	successes, failures int
+}
+
+type breakerBuilder struct {
+	maxFailures   int
+	failureRate   float64
+	minRequests   int
+	window        time.Duration
+	buckets       int
+	openTimeout   time.Duration
+	probes        int
+	probeTimeout  time.Duration
+	onStateChange func(from, to BreakerState)
+	clock         Clock
+}
+
+// BreakerBuilder returns a new builder for building a circuit breaker.
+func BreakerBuilder() *breakerBuilder {
+	return &breakerBuilder{
+		window:      defaultBreakerWindow,
+		buckets:     defaultBreakerBuckets,
+		openTimeout: defaultBreakerOpenTimeout,
+		probes:      1,
+	}
+}
+
+// ConsecutiveFailures sets the number of consecutive failures opening the circuit.
+// It defaults to 5 if no failure rate is set either.
+func (b *breakerBuilder) ConsecutiveFailures(n int) *breakerBuilder {
+	b.maxFailures = n
+	return b
+}
+
+// FailureRate sets the failure rate over the window opening the circuit,
+// once the window holds at least minRequests outcomes.
+func (b *breakerBuilder) FailureRate(rate float64, minRequests int) *breakerBuilder {
+	b.failureRate = rate
+	b.minRequests = minRequests
+	return b
+}
+
+// Window sets the sliding window of the failure rate and the number of buckets it is divided into,
+// it defaults to 10 seconds in 10 buckets.
+func (b *breakerBuilder) Window(window time.Duration, buckets int) *breakerBuilder {
+	b.window = window
+	b.buckets = buckets
+	return b
+}
+
+// OpenTimeout sets how long the circuit stays open before letting probe requests through,
+// it defaults to 1 minute.
+func (b *breakerBuilder) OpenTimeout(timeout time.Duration) *breakerBuilder {
+	b.openTimeout = timeout
+	return b
+}
+
+// HalfOpenRequests sets the number of probe requests let through in the half-open state,
+// which must all succeed to close the circuit. It defaults to 1.
+func (b *breakerBuilder) HalfOpenRequests(n int) *breakerBuilder {
+	b.probes = n
+	return b
+}
+
+// ProbeTimeout sets how long a probe request may take to report its outcome, the circuit opening
+// again once it is over, as if the probe had failed. It defaults to the open timeout.
+func (b *breakerBuilder) ProbeTimeout(timeout time.Duration) *breakerBuilder {
+	b.probeTimeout = timeout
+	return b
+}
+
+// OnStateChange sets the function called when the state of the circuit changes.
+// It is called without the lock of the breaker held, once at a time and in the order of the changes,
+// by the goroutine changing the state or the one notifying the former changes meanwhile.
+func (b *breakerBuilder) OnStateChange(f func(from, to BreakerState)) *breakerBuilder {
+	b.onStateChange = f
+	return b
+}
+
+// Clock sets the clock of the breaker, it defaults to the time package.
+func (b *breakerBuilder) Clock(clock Clock) *breakerBuilder {
+	b.clock = clock
+	return b
+}
+
+// Build builds a new circuit breaker.
+func (b *breakerBuilder) Build() *CircuitBreaker {
+	if b.maxFailures < 0 || b.failureRate < 0 || b.failureRate > 1 {
+		panic("consecutive failures must not be negative, and failure rate must be within [0, 1]")
+	}
+	if b.window <= 0 || b.buckets <= 0 || b.openTimeout <= 0 || b.probes <= 0 || b.probeTimeout < 0 {
+		panic("window, buckets, open timeout and half-open requests must be greater than 0, and probe timeout not negative")
+	}
+	if b.window/time.Duration(b.buckets) <= 0 {
+		panic("window must be at least the number of buckets in nanoseconds")
+	}
+	probeTimeout := b.probeTimeout
+	if probeTimeout == 0 {
+		probeTimeout = b.openTimeout
+	}
+	maxFailures := b.maxFailures
+	if maxFailures == 0 && b.failureRate == 0 {
+		maxFailures = defaultBreakerConsecutiveFailures
+	}
+	clock := b.clock
+	if clock == nil {
+		clock = realClock{}
+	}
+	return &CircuitBreaker{
+		window:        outcomeWindow{newBucketRing[outcomeCount](b.buckets, b.window/time.Duration(b.buckets), clock.Now())},
+		maxFailures:   maxFailures,
+		failureRate:   b.failureRate,
+		minRequests:   b.minRequests,
+		openTimeout:   b.openTimeout,
+		probes:        b.probes,
+		probeTimeout:  probeTimeout,
+		onStateChange: b.onStateChange,
+		clock:         clock,
+	}
+}
+
+// NewCircuitBreaker creates a new circuit breaker opening after 'failures' consecutive failures,
+// for the open timeout.
+func NewCircuitBreaker(failures int, openTimeout time.Duration) *CircuitBreaker {
+	if failures <= 0 {
+		panic("failures must be greater than 0")
+	}
+	return BreakerBuilder().ConsecutiveFailures(failures).OpenTimeout(openTimeout).Build()
+}
+
+// Allow reports whether a request may be sent, returning ErrCircuitOpen if not.
+// If it may, the outcome of the request must be reported by calling done once it completes.
+func (b *CircuitBreaker) Allow() (done func(success bool), err error) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	now := b.clock.Now()
+	b.expire(now)
+	switch b.state {
+	case StateOpen:
+		return nil, ErrCircuitOpen
+	case StateHalfOpen:
+		if b.probing >= b.probes {
+			return nil, ErrCircuitOpen
+		}
+		b.probing++
+		b.probedAt = now
+	}
+
+	generation := b.generation
+	var once sync.Once
+	return func(success bool) {
+		once.Do(func() { b.report(generation, success) })
+	}, nil
+}
+
+// Execute sends the request by calling fn if the circuit allows it, and reports it as failed
+// if fn returns an error. It returns ErrCircuitOpen without calling fn if the request is rejected.
+func (b *CircuitBreaker) Execute(fn func() error) error {
+	done, err := b.Allow()
+	if err != nil {
+		return err
+	}
+	err = fn()
+	done(err == nil)
+	return err
+}
+
+// State returns the state of the circuit.
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.unlock()
+	b.expire(b.clock.Now())
+	return b.state
+}
+
+// report counts the outcome of a request let through in the given generation,
+// ignoring it if the state has changed since.
+func (b *CircuitBreaker) report(generation uint64, success bool) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	now := b.clock.Now()
+	b.expire(now)
+	if generation != b.generation {
+		return
+	}
+	switch b.state {
+	case StateClosed:
+		b.window.add(now, success)
+		if success {
+			b.consecutiveFailures = 0
+			return
+		}
+		b.consecutiveFailures++
+		if b.tripped(now) {
+			b.setState(StateOpen, now)
+		}
+	case StateHalfOpen:
+		if !success {
+			b.setState(StateOpen, now)
+			return
+		}
+		b.succeeded++
+		if b.succeeded >= b.probes {
+			b.setState(StateClosed, now)
+		}
+	}
+}
+
+// tripped reports whether the failures open the circuit. It must be called with the lock held.
+func (b *CircuitBreaker) tripped(now time.Time) bool {
+	if b.maxFailures > 0 && b.consecutiveFailures >= b.maxFailures {
+		return true
+	}
+	if b.failureRate == 0 {
+		return false
+	}
+	successes, failures := b.window.count(now)
+	total := successes + failures
+	return total > 0 && total >= b.minRequests && float64(failures)/float64(total) >= b.failureRate
+}
+
+// expire makes the open circuit half-open once the open timeout is over, and the half-open circuit
+// open once the probe timeout of the last probe is over while probes have not reported their outcome,
+// the earlier probes having had longer. It must be called with the lock held.
+func (b *CircuitBreaker) expire(now time.Time) {
+	switch {
+	case b.state == StateOpen && now.Sub(b.openedAt) >= b.openTimeout:
+		b.setState(StateHalfOpen, now)
+	case b.state == StateHalfOpen && b.probing > b.succeeded && now.Sub(b.probedAt) >= b.probeTimeout:
+		b.setState(StateOpen, now)
+	}
+}
+
+// setState changes the state of the circuit, starting over the counts of the requests.
+// It must be called with the lock held.
+func (b *CircuitBreaker) setState(state BreakerState, now time.Time) {
+	b.changes = append(b.changes, stateChange{from: b.state, to: state})
+	b.state = state
+	b.generation++
+	b.consecutiveFailures, b.probing, b.succeeded = 0, 0, 0
+	b.window.reset(now)
+	if state == StateOpen {
+		b.openedAt = now
+	}
+}
+
+// unlock releases the lock, then notifies the state changes made while it was held.
+// The changes made while another goroutine is notifying are notified by that goroutine,
+// so that they are notified in order.
+func (b *CircuitBreaker) unlock() {
+	if b.onStateChange == nil {
+		b.changes = nil
+	}
+	if len(b.changes) == 0 || b.notifying {
+		b.mu.Unlock()
+		return
+	}
+	b.notifying = true
+	for len(b.changes) > 0 {
+		changes := b.changes
+		b.changes = nil
+		b.mu.Unlock()
+		for _, c := range changes {
+			b.onStateChange(c.from, c.to)
+		}
+		b.mu.Lock()
+	}
+	b.notifying = false
+	b.mu.Unlock()
+}
+
+// add counts an outcome in the current bucket.
+func (w *outcomeWindow) add(now time.Time, success bool) {
+	w.advance(now)
+	if success {
+		w.buckets[w.lastIndex].successes++
+	} else {
+		w.buckets[w.lastIndex].failures++
+	}
+}
+
+// count returns the successes and failures in the window.
+func (w *outcomeWindow) count(now time.Time) (successes, failures int) {
+	w.advance(now)
+	for _, c := range w.buckets {
+		successes += c.successes
+		failures += c.failures
+	}
+	return successes, failures
+}
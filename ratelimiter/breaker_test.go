@@ -0,0 +1,169 @@
+package ratelimiter
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// sendRequests reports the outcomes of requests let through by the breaker.
+func sendRequests(t *testing.T, b *CircuitBreaker, outcomes ...bool) {
+	t.Helper()
+	for _, success := range outcomes {
+		done, err := b.Allow()
+		if assert.NoError(t, err) {
+			done(success)
+		}
+	}
+}
+
+func TestCircuitBreaker_ConsecutiveFailures(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	var changes []string
+	b := BreakerBuilder().
+		ConsecutiveFailures(3).
+		OpenTimeout(time.Second).
+		HalfOpenRequests(2).
+		OnStateChange(func(from, to BreakerState) { changes = append(changes, from.String()+" -> "+to.String()) }).
+		Clock(clock).
+		Build()
+
+	sendRequests(t, b, false, false, true, false, false)
+	assert.Equal(t, StateClosed, b.State(), "Expected a success to reset the consecutive failures")
+	stale, err := b.Allow()
+	assert.NoError(t, err)
+	sendRequests(t, b, false)
+	assert.Equal(t, StateOpen, b.State())
+	_, err = b.Allow()
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	called := false
+	assert.ErrorIs(t, b.Execute(func() error { called = true; return nil }), ErrCircuitOpen)
+	assert.False(t, called)
+
+	// the outcomes of the requests let through before the circuit opened are ignored
+	clock.Advance(time.Second - time.Millisecond)
+	stale(true)
+	stale(false)
+	assert.Equal(t, StateOpen, b.State())
+
+	// a failed probe opens the circuit again
+	clock.Advance(time.Millisecond)
+	assert.Equal(t, StateHalfOpen, b.State())
+	done1, err := b.Allow()
+	assert.NoError(t, err)
+	done2, err := b.Allow()
+	assert.NoError(t, err)
+	_, err = b.Allow()
+	assert.ErrorIs(t, err, ErrCircuitOpen, "Expected the requests beyond the probes to be rejected")
+	done1(true)
+	done2(false)
+	assert.Equal(t, StateOpen, b.State())
+
+	// the probes all succeeding close the circuit
+	clock.Advance(time.Second)
+	sendRequests(t, b, true, true)
+	assert.Equal(t, StateClosed, b.State())
+	assert.Equal(t, []string{
+		"closed -> open",
+		"open -> half-open",
+		"half-open -> open",
+		"open -> half-open",
+		"half-open -> closed",
+	}, changes)
+}
+
+func TestCircuitBreaker_StateChangesInOrder(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	var mu sync.Mutex
+	var changes []string
+	entered, release := make(chan struct{}), make(chan struct{})
+	b := BreakerBuilder().
+		ConsecutiveFailures(1).
+		OpenTimeout(time.Second).
+		HalfOpenRequests(1).
+		OnStateChange(func(from, to BreakerState) {
+			mu.Lock()
+			changes = append(changes, from.String()+" -> "+to.String())
+			mu.Unlock()
+			if to == StateOpen {
+				close(entered)
+				<-release
+			}
+		}).
+		Clock(clock).
+		Build()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sendRequests(t, b, false)
+	}()
+	<-entered
+
+	// the changes made while the first one is notified wait for it
+	clock.Advance(time.Second)
+	sendRequests(t, b, true)
+	assert.Equal(t, StateClosed, b.State())
+	mu.Lock()
+	assert.Equal(t, []string{"closed -> open"}, changes)
+	mu.Unlock()
+
+	close(release)
+	<-done
+	assert.Equal(t, []string{"closed -> open", "open -> half-open", "half-open -> closed"}, changes)
+}
+
+func TestCircuitBreaker_FailureRate(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	b := BreakerBuilder().FailureRate(0.5, 4).Window(time.Second, 10).Clock(clock).Build()
+
+	sendRequests(t, b, false, false, false)
+	assert.Equal(t, StateClosed, b.State(), "Expected the failure rate to be ignored below the minimum requests")
+
+	// the failures slide out of the window
+	clock.Advance(time.Second)
+	sendRequests(t, b, true, true, true, false, false)
+	assert.Equal(t, StateClosed, b.State())
+	sendRequests(t, b, false)
+	assert.Equal(t, StateOpen, b.State())
+
+	clock.Advance(time.Minute)
+	errBackend := errors.New("backend")
+	assert.ErrorIs(t, b.Execute(func() error { return errBackend }), errBackend)
+	assert.Equal(t, StateOpen, b.State())
+}
+
+func TestCircuitBreaker_ProbeTimeout(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	b := BreakerBuilder().ConsecutiveFailures(1).OpenTimeout(time.Second).ProbeTimeout(100 * time.Millisecond).Clock(clock).Build()
+
+	sendRequests(t, b, false)
+	clock.Advance(time.Second)
+	lost, err := b.Allow()
+	assert.NoError(t, err)
+	clock.Advance(99 * time.Millisecond)
+	assert.Equal(t, StateHalfOpen, b.State())
+
+	// the probe never reporting its outcome opens the circuit again, as if it had failed
+	clock.Advance(time.Millisecond)
+	assert.Equal(t, StateOpen, b.State())
+	lost(true)
+	clock.Advance(time.Second)
+	sendRequests(t, b, true)
+	assert.Equal(t, StateClosed, b.State())
+}
+
+func TestCircuitBreaker_Build(t *testing.T) {
+	assert.Panics(t, func() { NewCircuitBreaker(0, time.Second) })
+	assert.Panics(t, func() { NewCircuitBreaker(1, 0) })
+	assert.Panics(t, func() { BreakerBuilder().FailureRate(1.5, 1).Build() })
+	assert.Panics(t, func() { BreakerBuilder().HalfOpenRequests(0).Build() })
+	assert.Panics(t, func() { BreakerBuilder().Window(5, 10).Build() })
+	assert.Panics(t, func() { BreakerBuilder().ProbeTimeout(-1).Build() })
+	assert.Equal(t, time.Minute, BreakerBuilder().Build().probeTimeout)
+	assert.Equal(t, 5, BreakerBuilder().Build().maxFailures)
+	assert.Equal(t, "unknown", BreakerState(-1).String())
+}
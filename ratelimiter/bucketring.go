@@ -0,0 +1,56 @@
+package ratelimiter
+
+import "time"
+
+// bucketRing is a ring of buckets spanning a sliding window, such as the request counts of a
+// SlidingWindowCount or the outcomes of a CircuitBreaker. The current bucket is the last one
+// of the window, the buckets older than the window being cleared as it slides.
+type bucketRing[T any] struct {
+	buckets        []T
+	bucketInterval time.Duration // The duration of each bucket
+	lastTime       time.Time     // The start time of the current bucket
+	lastIndex      int           // Index of the current bucket
+}
+
+// newBucketRing returns a ring of n empty buckets of the given duration, the current one starting at now.
+func newBucketRing[T any](n int, bucketInterval time.Duration, now time.Time) bucketRing[T] {
+	return bucketRing[T]{buckets: make([]T, n), bucketInterval: bucketInterval, lastTime: now}
+}
+
+// advance moves to the bucket of the given time, clearing the buckets passed since the current one,
+// and returns the number of buckets passed.
+func (r *bucketRing[T]) advance(now time.Time) int {
+	passed := r.bucketPassed(now)
+	if passed == 0 {
+		return 0
+	}
+	var zero T
+	for i := 1; i <= min(passed, len(r.buckets)); i++ {
+		r.buckets[(r.lastIndex+i)%len(r.buckets)] = zero
+	}
+	r.lastTime = r.lastTime.Add(time.Duration(passed) * r.bucketInterval)
+	r.lastIndex = (r.lastIndex + passed) % len(r.buckets)
+	return passed
+}
+
+// reset clears the buckets, the current one starting at now.
+func (r *bucketRing[T]) reset(now time.Time) {
+	clear(r.buckets)
+	r.lastTime = now
+	r.lastIndex = 0
+}
+
+// bucketPassed returns the number of whole buckets between the current one and the given time.
+func (r *bucketRing[T]) bucketPassed(now time.Time) int {
+	return max(int(now.Sub(r.lastTime)/r.bucketInterval), 0)
+}
+
+// offset returns the number of buckets between the current one and the bucket starting at the given time.
+func (r *bucketRing[T]) offset(at time.Time) int {
+	return int(at.Sub(r.lastTime) / r.bucketInterval)
+}
+
+// index returns the index of the bucket 'age' buckets before the current one.
+func (r *bucketRing[T]) index(age int) int {
+	return (r.lastIndex - age%len(r.buckets) + len(r.buckets)) % len(r.buckets)
+}
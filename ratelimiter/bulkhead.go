@@ -0,0 +1,256 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// defaultBulkheadRetryAfter is how long a request rejected by a Bulkhead is told to back off by default.
+const defaultBulkheadRetryAfter = time.Second
+
+// Errors returned by Bulkhead.Acquire when the request gives up waiting.
+var (
+	ErrBulkheadFull    = errors.New("bulkhead queue full")
+	ErrBulkheadTimeout = errors.New("bulkhead wait timed out")
+)
+
+// Bulkhead caps the weight of the operations in flight, such as the concurrent calls to a dependency,
+// so that a slow dependency cannot take up all the resources of its callers. The rate limiters cap how
+// often the operations start, the bulkhead how many run at once.
+//
+// It is a weighted semaphore whose acquisitions are served in FIFO order, a heavy operation waiting
+// first not being overtaken by the lighter ones. The acquisitions waiting for room are bounded in
+// number and in time, if so configured.
+type Bulkhead struct {
+	mu         sync.Mutex
+	size       int // The maximum weight of the operations in flight
+	inflight   int // The weight of the operations in flight
+	waiters    []*bulkheadWaiter
+	maxQueue   int           // The maximum number of waiting acquisitions, unbounded if 0
+	timeout    time.Duration // The maximum time an acquisition waits, unbounded if 0
+	retryAfter time.Duration // How long the rejected requests are told to back off
+	clock      Clock
+}
+
+// bulkheadWaiter is an acquisition waiting for room in the bulkhead.
+type bulkheadWaiter struct {
+	n     int
+	ready chan struct{} // Closed once the weight is acquired
+}
+
+type bulkheadBuilder struct {
+	size       int
+	maxQueue   int
+	timeout    time.Duration
+	retryAfter time.Duration
+	clock      Clock
+}
+
+// BulkheadBuilder returns a new builder for building a bulkhead capping the weight in flight to size.
+func BulkheadBuilder(size int) *bulkheadBuilder {
+	return &bulkheadBuilder{size: size, retryAfter: defaultBulkheadRetryAfter}
+}
+
+// MaxQueue sets the maximum number of acquisitions waiting for room, it is unbounded by default.
+func (b *bulkheadBuilder) MaxQueue(n int) *bulkheadBuilder {
+	b.maxQueue = n
+	return b
+}
+
+// Timeout sets how long an acquisition waits for room at most, it is unbounded by default.
+func (b *bulkheadBuilder) Timeout(timeout time.Duration) *bulkheadBuilder {
+	b.timeout = timeout
+	return b
+}
+
+// RetryAfter sets how long the requests rejected by Decide are told to back off,
+// as the bulkhead cannot tell when room is released. It defaults to 1 second.
+func (b *bulkheadBuilder) RetryAfter(d time.Duration) *bulkheadBuilder {
+	b.retryAfter = d
+	return b
+}
+
+// Clock sets the clock of the bulkhead timing out the acquisitions, it defaults to the time package.
+func (b *bulkheadBuilder) Clock(clock Clock) *bulkheadBuilder {
+	b.clock = clock
+	return b
+}
+
+// Build builds a new bulkhead.
+func (b *bulkheadBuilder) Build() *Bulkhead {
+	if b.size <= 0 {
+		panic("size must be greater than 0")
+	}
+	if b.maxQueue < 0 || b.timeout < 0 || b.retryAfter < 0 {
+		panic("max queue, timeout and retry after must not be negative")
+	}
+	clock := b.clock
+	if clock == nil {
+		clock = realClock{}
+	}
+	return &Bulkhead{size: b.size, maxQueue: b.maxQueue, timeout: b.timeout, retryAfter: b.retryAfter, clock: clock}
+}
+
+// NewBulkhead creates a new bulkhead capping the weight of the operations in flight to size,
+// whose acquisitions wait for room without bound.
+func NewBulkhead(size int) *Bulkhead {
+	return BulkheadBuilder(size).Build()
+}
+
+// Acquire blocks until the weight n is acquired, in FIFO order, and must be followed by Release(n)
+// once the operation is done.
+// It returns ErrLimitExceeded if n exceeds the size, ErrBulkheadFull without waiting if the queue is full,
+// ErrBulkheadTimeout if the timeout is over, or the error of the context if it is done first.
+// It panics if n is not positive.
+func (b *Bulkhead) Acquire(ctx context.Context, n int) error {
+	checkWeight(n)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	w, err := b.enqueue(n)
+	if w == nil {
+		return err
+	}
+
+	var timeout <-chan time.Time
+	if b.timeout > 0 {
+		timer := b.clock.NewTimer(b.timeout)
+		defer timer.Stop()
+		timeout = timer.C()
+	}
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		return b.abandon(w, ctx.Err())
+	case <-timeout:
+		return b.abandon(w, ErrBulkheadTimeout)
+	}
+}
+
+// enqueue acquires the weight n if there is room and no acquisition waiting before it,
+// or returns the waiter of the acquisition queued.
+func (b *Bulkhead) enqueue(n int) (*bulkheadWaiter, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case n > b.size:
+		return nil, ErrLimitExceeded
+	case len(b.waiters) == 0 && b.inflight+n <= b.size:
+		b.inflight += n
+		return nil, nil
+	case b.maxQueue > 0 && len(b.waiters) >= b.maxQueue:
+		return nil, ErrBulkheadFull
+	}
+	w := &bulkheadWaiter{n: n, ready: make(chan struct{})}
+	b.waiters = append(b.waiters, w)
+	return w, nil
+}
+
+// abandon gives up a waiting acquisition, releasing its weight if it was acquired meanwhile.
+func (b *Bulkhead) abandon(w *bulkheadWaiter, err error) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		b.inflight -= w.n
+	default:
+		for i, waiter := range b.waiters {
+			if waiter == w {
+				b.waiters = append(b.waiters[:i], b.waiters[i+1:]...)
+				break
+			}
+		}
+	}
+	// the acquisitions behind may fit now
+	b.grant()
+	return err
+}
+
+// TryAcquire acquires the weight n without waiting, and reports whether it did.
+// It panics if n is not positive.
+func (b *Bulkhead) TryAcquire(n int) bool {
+	return b.Decide(n).Allowed
+}
+
+// Decide reports whether the weight n may be acquired now, acquiring it if so, along with the
+// remaining room. The room is not available to a new acquisition while others are waiting.
+// The rejected requests are told to retry after the RetryAfter of the bulkhead, or InfDuration
+// if n exceeds the size. It panics if n is not positive.
+func (b *Bulkhead) Decide(n int) Decision {
+	checkWeight(n)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.clock.Now()
+	d := Decision{Limit: b.size, ResetAt: now, now: now}
+	switch {
+	case n > b.size:
+		d.RetryAfter = InfDuration
+	case len(b.waiters) == 0 && b.inflight+n <= b.size:
+		d.Allowed = true
+		b.inflight += n
+	default:
+		d.RetryAfter = b.retryAfter
+	}
+	if len(b.waiters) == 0 {
+		d.Remaining = b.size - b.inflight
+	}
+	if b.inflight > 0 {
+		d.ResetAt = now.Add(b.retryAfter)
+	}
+	return d
+}
+
+// Release releases the weight n of an operation done, letting the waiting acquisitions through in order.
+// It panics if n is not positive, or if more weight is released than acquired.
+func (b *Bulkhead) Release(n int) {
+	checkWeight(n)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n > b.inflight {
+		panic("bulkhead released more than acquired")
+	}
+	b.inflight -= n
+	b.grant()
+}
+
+// checkWeight panics if the weight n is not positive, as a weight of 0 would not hold the bulkhead
+// and a negative one would release the weight of the others.
+func checkWeight(n int) {
+	if n <= 0 {
+		panic("weight must be greater than 0")
+	}
+}
+
+// grant acquires the weights of the waiting acquisitions in order, while they fit.
+// It must be called with the lock held.
+func (b *Bulkhead) grant() {
+	for len(b.waiters) > 0 {
+		w := b.waiters[0]
+		if b.inflight+w.n > b.size {
+			return
+		}
+		b.inflight += w.n
+		close(w.ready)
+		b.waiters = b.waiters[1:]
+	}
+}
+
+// Inflight returns the weight of the operations in flight.
+func (b *Bulkhead) Inflight() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.inflight
+}
+
+// Waiting returns the number of acquisitions waiting for room.
+func (b *Bulkhead) Waiting() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.waiters)
+}
@@ -0,0 +1,101 @@
+package ratelimiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// acquire acquires the weight n from the bulkhead in a goroutine, once the acquisitions
+// already waiting are queued, and returns the channel of its error.
+func acquire(t *testing.T, ctx context.Context, b *Bulkhead, n int) <-chan error {
+	t.Helper()
+	waiting := b.Waiting()
+	errs := make(chan error, 1)
+	go func() { errs <- b.Acquire(ctx, n) }()
+	waitFor(t, func() bool { return b.Waiting() == waiting+1 })
+	return errs
+}
+
+func TestBulkhead_FIFO(t *testing.T) {
+	b := NewBulkhead(3)
+	assert.NoError(t, b.Acquire(context.Background(), 2))
+
+	heavy := acquire(t, context.Background(), b, 2)
+	// the room left is kept for the acquisition waiting first
+	d := b.Decide(1)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, 0, d.Remaining)
+	assert.Equal(t, 3, d.Limit)
+	assert.Equal(t, time.Second, d.RetryAfter)
+	light := acquire(t, context.Background(), b, 1)
+
+	b.Release(2)
+	assert.NoError(t, <-heavy)
+	assert.NoError(t, <-light)
+	assert.Equal(t, 3, b.Inflight())
+	assert.Equal(t, 0, b.Waiting())
+
+	b.Release(3)
+	d = b.Decide(3)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 0, d.Remaining)
+	assert.True(t, d.ResetAt.After(time.Now()))
+	b.Release(3)
+	assert.True(t, b.TryAcquire(1))
+	b.Release(1)
+
+	assert.Equal(t, InfDuration, b.Decide(4).RetryAfter)
+	assert.ErrorIs(t, b.Acquire(context.Background(), 4), ErrLimitExceeded)
+	assert.Panics(t, func() { b.Release(1) })
+}
+
+func TestBulkhead_QueueAndTimeout(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	b := BulkheadBuilder(1).MaxQueue(1).Timeout(time.Second).Clock(clock).Build()
+	assert.NoError(t, b.Acquire(context.Background(), 1))
+
+	errs := acquire(t, context.Background(), b, 1)
+	assert.ErrorIs(t, b.Acquire(context.Background(), 1), ErrBulkheadFull)
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	assert.ErrorIs(t, <-errs, ErrBulkheadTimeout)
+	assert.Equal(t, 0, b.Waiting())
+	assert.Equal(t, 1, b.Inflight())
+}
+
+func TestBulkhead_Cancel(t *testing.T) {
+	b := NewBulkhead(2)
+	assert.NoError(t, b.Acquire(context.Background(), 1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	heavy := acquire(t, ctx, b, 2)
+	light := acquire(t, context.Background(), b, 1)
+
+	// the acquisition behind the canceled one fits
+	cancel()
+	assert.ErrorIs(t, <-heavy, context.Canceled)
+	assert.NoError(t, <-light)
+	assert.Equal(t, 2, b.Inflight())
+	assert.ErrorIs(t, b.Acquire(ctx, 1), context.Canceled)
+}
+
+func TestBulkhead_Build(t *testing.T) {
+	assert.Panics(t, func() { NewBulkhead(0) })
+	assert.Panics(t, func() { BulkheadBuilder(1).MaxQueue(-1).Build() })
+	assert.Panics(t, func() { BulkheadBuilder(1).Timeout(-time.Second).Build() })
+}
+
+func TestBulkhead_InvalidWeight(t *testing.T) {
+	b := NewBulkhead(2)
+	for _, n := range []int{0, -1} {
+		assert.Panics(t, func() { _ = b.Acquire(context.Background(), n) })
+		assert.Panics(t, func() { b.TryAcquire(n) })
+		assert.Panics(t, func() { b.Decide(n) })
+		assert.Panics(t, func() { b.Release(n) })
+	}
+	assert.Equal(t, 0, b.Inflight())
+}
@@ -0,0 +1,212 @@
+package ratelimiter
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time and creates the timers and tickers used by the limiters.
+// It can be replaced by a FakeClock to test time-dependent behavior without sleeping.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// NewTimer creates a timer sending the time on its channel after d.
+	NewTimer(d time.Duration) Timer
+	// NewTicker creates a ticker sending the time on its channel every d.
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer is the timer created by a Clock.
+type Timer interface {
+	// C returns the channel on which the time is delivered.
+	C() <-chan time.Time
+	// Stop prevents the timer from firing and reports whether it was active.
+	Stop() bool
+}
+
+// Ticker is the ticker created by a Clock.
+type Ticker interface {
+	// C returns the channel on which the ticks are delivered.
+	C() <-chan time.Time
+	// Stop turns off the ticker.
+	Stop()
+}
+
+// realClock is the Clock of the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{t: time.NewTimer(d)}
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{t: time.NewTicker(d)}
+}
+
+type realTimer struct {
+	t *time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.t.C
+}
+
+func (t realTimer) Stop() bool {
+	return t.t.Stop()
+}
+
+type realTicker struct {
+	t *time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.t.C
+}
+
+func (t realTicker) Stop() {
+	t.t.Stop()
+}
+
+// FakeClock is a Clock whose time only changes when it is advanced manually.
+// Its timers and tickers fire while it is advanced.
+type FakeClock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+// fakeWaiter is a timer, or a ticker if it has a period.
+type fakeWaiter struct {
+	clock  *FakeClock
+	at     time.Time
+	period time.Duration
+	ch     chan time.Time
+}
+
+// NewFakeClock creates a FakeClock set to the given time.
+func NewFakeClock(now time.Time) *FakeClock {
+	c := &FakeClock{now: now}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now returns the current time of the clock.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTimer creates a timer firing once the clock has been advanced by d.
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	return fakeTimer{c.add(d, 0)}
+}
+
+// NewTicker creates a ticker firing each time the clock has been advanced by d.
+// Like time.Ticker, it drops the ticks for slow receivers.
+// It panics if d is less than or equal to 0.
+func (c *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	return fakeTicker{c.add(d, d)}
+}
+
+// Advance moves the clock forward by d, firing the timers and tickers
+// due in the meantime in chronological order.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	end := c.now.Add(d)
+	for {
+		var next *fakeWaiter
+		for _, w := range c.waiters {
+			if !w.at.After(end) && (next == nil || w.at.Before(next.at)) {
+				next = w
+			}
+		}
+		if next == nil {
+			break
+		}
+
+		c.now = next.at
+		select {
+		case next.ch <- c.now:
+		default:
+		}
+		if next.period > 0 {
+			next.at = next.at.Add(next.period)
+		} else {
+			c.remove(next)
+		}
+	}
+	c.now = end
+}
+
+// BlockUntil blocks until at least n timers and tickers are waiting for the clock,
+// so that goroutines can be synchronized with the clock before advancing it.
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+}
+
+func (c *FakeClock) add(d, period time.Duration) *fakeWaiter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	w := &fakeWaiter{clock: c, at: c.now.Add(d), period: period, ch: make(chan time.Time, 1)}
+	if d <= 0 {
+		w.ch <- c.now
+		return w
+	}
+	c.waiters = append(c.waiters, w)
+	c.cond.Broadcast()
+	return w
+}
+
+// remove removes the waiter and reports whether it was waiting.
+func (c *FakeClock) remove(w *fakeWaiter) bool {
+	for i, waiter := range c.waiters {
+		if waiter == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			c.cond.Broadcast()
+			return true
+		}
+	}
+	return false
+}
+
+func (w *fakeWaiter) C() <-chan time.Time {
+	return w.ch
+}
+
+func (w *fakeWaiter) stop() bool {
+	w.clock.mu.Lock()
+	defer w.clock.mu.Unlock()
+	return w.clock.remove(w)
+}
+
+type fakeTimer struct {
+	*fakeWaiter
+}
+
+func (t fakeTimer) Stop() bool {
+	return t.stop()
+}
+
+type fakeTicker struct {
+	*fakeWaiter
+}
+
+func (t fakeTicker) Stop() {
+	t.stop()
+}
@@ -0,0 +1,72 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeClock_Timer(t *testing.T) {
+	start := time.Now()
+	clock := NewFakeClock(start)
+	assert.Equal(t, start, clock.Now())
+
+	timer := clock.NewTimer(time.Second)
+	clock.Advance(time.Second / 2)
+	assert.Equal(t, start.Add(time.Second/2), clock.Now())
+	assert.Empty(t, timer.C(), "Expected the timer not to fire before its duration")
+
+	clock.Advance(time.Second)
+	assert.Equal(t, start.Add(time.Second), <-timer.C(), "Expected the timer to fire at its time")
+	assert.False(t, timer.Stop(), "Expected a fired timer not to be active")
+
+	timer = clock.NewTimer(time.Second)
+	assert.True(t, timer.Stop())
+	clock.Advance(time.Second)
+	assert.Empty(t, timer.C(), "Expected a stopped timer not to fire")
+
+	timer = clock.NewTimer(0)
+	assert.Len(t, timer.C(), 1, "Expected a timer of no duration to fire immediately")
+}
+
+func TestFakeClock_Ticker(t *testing.T) {
+	start := time.Now()
+	clock := NewFakeClock(start)
+	assert.Panics(t, func() { clock.NewTicker(0) })
+
+	ticker := clock.NewTicker(time.Second)
+	clock.Advance(time.Second)
+	assert.Equal(t, start.Add(time.Second), <-ticker.C())
+
+	// the ticks are dropped for slow receivers
+	clock.Advance(3 * time.Second)
+	assert.Equal(t, start.Add(2*time.Second), <-ticker.C())
+	assert.Empty(t, ticker.C())
+
+	ticker.Stop()
+	clock.Advance(time.Second)
+	assert.Empty(t, ticker.C(), "Expected a stopped ticker not to tick")
+}
+
+func TestFakeClock_AdvanceInOrder(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	late := clock.NewTimer(2 * time.Second)
+	early := clock.NewTimer(time.Second)
+
+	clock.Advance(3 * time.Second)
+	assert.True(t, (<-early.C()).Before(<-late.C()))
+}
+
+func TestFakeClock_BlockUntil(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	done := make(chan struct{})
+	go func() {
+		<-clock.NewTimer(time.Second).C()
+		close(done)
+	}()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	<-done
+}
@@ -0,0 +1,42 @@
+package ratelimiter
+
+import "time"
+
+// Decision is the outcome of Decide, telling clients how long to back off.
+type Decision struct {
+	// Allowed reports whether the requests may happen now.
+	Allowed bool
+	// Remaining is the number of requests that may still happen now.
+	Remaining int
+	// Limit is the maximum number of requests that may happen at once.
+	Limit int
+	// ResetAt is the time the full limit is available again.
+	ResetAt time.Time
+	// RetryAfter is how long to wait before the rejected requests may happen,
+	// zero if they are allowed, or InfDuration if they never are.
+	RetryAfter time.Duration
+
+	// now is the time of the decision, told by the clock of the limiter.
+	now time.Time
+}
+
+// quota is the state of a limiter reported by a Decision.
+type quota struct {
+	limit     int
+	remaining int
+	// resetAt is the time the full limit is available again.
+	resetAt time.Time
+}
+
+// newDecision returns the decision made at now, given the reservation of the requests
+// not waiting for them, and the quota of the limiter after it.
+func newDecision(now time.Time, r *Reservation, q quota) Decision {
+	d := Decision{Allowed: r.OK(), Remaining: q.remaining, Limit: q.limit, ResetAt: q.resetAt, now: now}
+	if !d.Allowed {
+		d.RetryAfter = InfDuration
+		if !r.timeToAct.IsZero() {
+			d.RetryAfter = r.timeToAct.Sub(now)
+		}
+	}
+	return d
+}
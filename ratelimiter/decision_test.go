@@ -0,0 +1,79 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecide(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	for _, tt := range []struct {
+		algorithm  Algorithm
+		resetAt    time.Duration
+		retryAfter time.Duration
+	}{
+		{AlgorithmTokenBucket, 2 * time.Second, time.Second},
+		{AlgorithmFixedWindows, time.Second, time.Second},
+		{AlgorithmSlidingWindowLog, time.Second, time.Second},
+		{AlgorithmSlidingWindowCount, time.Second, time.Second},
+		{AlgorithmLeakyBucket, 2 * time.Second, time.Second},
+		{AlgorithmGCRA, 2 * time.Second, time.Second},
+	} {
+		t.Run(string(tt.algorithm), func(t *testing.T) {
+			l := Builder().Algorithm(tt.algorithm).Limit(1).Burst(2).Clock(clock).Build()
+			d := l.Decide(0)
+			assert.True(t, d.Allowed)
+			assert.Equal(t, d.Limit, d.Remaining)
+			assert.Equal(t, clock.Now(), d.ResetAt)
+			assert.Zero(t, d.RetryAfter)
+
+			d = l.Decide(d.Limit)
+			assert.True(t, d.Allowed)
+			assert.Equal(t, 0, d.Remaining)
+			assert.Equal(t, tt.resetAt, d.ResetAt.Sub(clock.Now()))
+
+			d = l.Decide(1)
+			assert.False(t, d.Allowed)
+			assert.Equal(t, tt.retryAfter, d.RetryAfter)
+			assert.Equal(t, InfDuration, l.Decide(d.Limit+1).RetryAfter)
+
+			// the leaky bucket leaks out in the background
+			clock.Advance(tt.retryAfter)
+			waitFor(t, func() bool { return l.Decide(1).Allowed })
+		})
+	}
+}
+
+func TestDecide_RemainingCounts(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	tb := NewTokenBucket(1, 5, time.Second).WithClock(clock)
+	assert.Equal(t, 3, tb.Decide(2).Remaining)
+	assert.Equal(t, 2, tb.Decide(1).Remaining)
+
+	// the window has been reserved, nothing remains before it starts
+	fw := NewFixedWindows(2, time.Second).WithClock(clock)
+	assert.True(t, fw.ReserveN(2).OK())
+	assert.True(t, fw.Reserve().OK())
+	d := fw.Decide(1)
+	assert.Equal(t, 0, d.Remaining)
+	assert.Equal(t, 2*time.Second, d.ResetAt.Sub(clock.Now()))
+
+	// the oldest log entry leaves the window first
+	sw := NewSlidingWindowLog(2, time.Second).WithClock(clock)
+	assert.True(t, sw.Allow())
+	clock.Advance(300 * time.Millisecond)
+	d = sw.Decide(2)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, 1, d.Remaining)
+	assert.Equal(t, 700*time.Millisecond, d.RetryAfter)
+	assert.Equal(t, 700*time.Millisecond, d.ResetAt.Sub(clock.Now()))
+
+	swc := NewSlidingWindowCount(4, time.Second, 4).WithClock(clock)
+	assert.Equal(t, 1, swc.Decide(3).Remaining)
+	clock.Advance(250 * time.Millisecond)
+	d = swc.Decide(2)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, 750*time.Millisecond, d.RetryAfter)
+}
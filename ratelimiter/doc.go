@@ -1,2 +1,189 @@
 // Package ratelimiter provides a collection of rate limiters.
 package ratelimiter
+
+import (
+	"context"
+	"time"
+)
+
+// Limiter defines the interface shared by the rate limiters.
+type Limiter interface {
+	// Allow reports whether a request may happen now.
+	Allow() bool
+	// AllowN reports whether n requests may happen now.
+	AllowN(n int) bool
+	// Wait blocks until a request is allowed or the context is done.
+	Wait(ctx context.Context) error
+	// WaitN blocks until n requests are allowed. It returns an error without
+	// waiting if they would be allowed after the context deadline.
+	WaitN(ctx context.Context, n int) error
+	// Reserve reserves a request and returns a Reservation telling
+	// how long the caller must wait before acting.
+	Reserve() *Reservation
+	// ReserveN reserves n requests like Reserve.
+	ReserveN(n int) *Reservation
+	// Decide reports whether n requests may happen now like AllowN,
+	// along with the remaining quota and how long to back off if they may not.
+	Decide(n int) Decision
+}
+
+// Reconfigurable is implemented by the limiters whose limit can be changed while in use,
+// which are all the limiters built by Builder.
+type Reconfigurable interface {
+	// SetLimit changes the number of requests allowed per interval,
+	// keeping the requests already counted.
+	SetLimit(limit int)
+	// SetInterval changes the interval of the limit, keeping the requests already counted.
+	SetInterval(interval time.Duration)
+}
+
+// Burster is implemented by the limiters telling the most requests they allow at once,
+// which are all the limiters built by Builder.
+type Burster interface {
+	// Burst returns the most requests allowed at once.
+	Burst() int
+}
+
+// BurstReconfigurable is implemented by the reconfigurable limiters having a burst,
+// which are the token bucket, the leaky bucket and GCRA.
+type BurstReconfigurable interface {
+	Reconfigurable
+	// SetBurst changes the number of requests allowed at once.
+	SetBurst(burst int)
+}
+
+// Algorithm is a type for rate limiting algorithms.
+type Algorithm string
+
+const (
+	AlgorithmTokenBucket        Algorithm = "token_bucket"
+	AlgorithmLeakyBucket        Algorithm = "leaky_bucket"
+	AlgorithmFixedWindows       Algorithm = "fixed_windows"
+	AlgorithmSlidingWindowLog   Algorithm = "sliding_window_log"
+	AlgorithmSlidingWindowCount Algorithm = "sliding_window_count"
+	AlgorithmGCRA               Algorithm = "gcra"
+)
+
+// defaultSlidingWindowBuckets is the number of buckets of a sliding window count
+// limiter built without Buckets.
+const defaultSlidingWindowBuckets = 10
+
+type builder struct {
+	algorithm Algorithm
+	limit     int
+	burst     int
+	interval  time.Duration
+	buckets   int
+	warmUp    time.Duration
+	clock     Clock
+}
+
+// Builder returns a new builder for building a limiter.
+func Builder() *builder {
+	return &builder{}
+}
+
+// Algorithm sets the algorithm of the limiter.
+func (b *builder) Algorithm(algorithm Algorithm) *builder {
+	b.algorithm = algorithm
+	return b
+}
+
+// Limit sets the number of requests allowed per interval.
+func (b *builder) Limit(limit int) *builder {
+	b.limit = limit
+	return b
+}
+
+// Burst sets the capacity of the token and leaky buckets and the burst of GCRA, it defaults to the limit.
+func (b *builder) Burst(burst int) *builder {
+	b.burst = burst
+	return b
+}
+
+// Interval sets the interval of the limit, it defaults to 1 second.
+func (b *builder) Interval(interval time.Duration) *builder {
+	b.interval = interval
+	return b
+}
+
+// Buckets sets the number of buckets of a sliding window count limiter, it defaults to 10.
+func (b *builder) Buckets(buckets int) *builder {
+	b.buckets = buckets
+	return b
+}
+
+// WarmUp makes a token bucket start cold and ramp up to its rate over the period,
+// building a WarmUpBucket, which has no burst.
+func (b *builder) WarmUp(period time.Duration) *builder {
+	b.warmUp = period
+	return b
+}
+
+// Clock sets the clock of the limiter, it defaults to the time package.
+func (b *builder) Clock(clock Clock) *builder {
+	b.clock = clock
+	return b
+}
+
+// Build builds a new limiter with the given algorithm and limit.
+func (b *builder) Build() Limiter {
+	if b.algorithm == "" || b.limit <= 0 {
+		panic("unspecified algorithm or limit")
+	}
+
+	interval, burst, buckets := b.defaults()
+
+	var l Limiter
+	switch b.algorithm {
+	case AlgorithmTokenBucket:
+		if b.warmUp > 0 {
+			l = NewWarmUpBucket(float64(b.limit), b.warmUp, interval)
+		} else {
+			l = NewTokenBucket(float64(b.limit), burst, interval)
+		}
+	case AlgorithmLeakyBucket:
+		l = NewLeakyBucket(b.limit, burst, interval)
+	case AlgorithmFixedWindows:
+		l = NewFixedWindows(b.limit, interval)
+	case AlgorithmSlidingWindowLog:
+		l = NewSlidingWindowLog(b.limit, interval)
+	case AlgorithmSlidingWindowCount:
+		l = NewSlidingWindowCount(b.limit, interval, buckets)
+	case AlgorithmGCRA:
+		l = NewGCRA(b.limit, burst, interval)
+	default:
+		panic("unsupported algorithm: " + b.algorithm)
+	}
+	if b.clock != nil {
+		l.(interface{ setClock(Clock) }).setClock(b.clock)
+	}
+	return l
+}
+
+// defaults returns the interval, burst and number of buckets, or their defaults if unset.
+func (b *builder) defaults() (interval time.Duration, burst, buckets int) {
+	interval = time.Second
+	if b.interval > 0 {
+		interval = b.interval
+	}
+	burst = b.limit
+	if b.burst > 0 {
+		burst = b.burst
+	}
+	buckets = defaultSlidingWindowBuckets
+	if b.buckets > 0 {
+		buckets = b.buckets
+	}
+	return interval, burst, buckets
+}
+
+// New creates a new limiter with the given algorithm allowing limit requests per interval.
+// If no interval is provided, it defaults to 1 second.
+func New(algorithm Algorithm, limit int, interval ...time.Duration) Limiter {
+	b := Builder().Algorithm(algorithm).Limit(limit)
+	if len(interval) > 0 {
+		b.Interval(interval[0])
+	}
+	return b.Build()
+}
@@ -0,0 +1,121 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	assert.IsType(t, &TokenBucket{}, New(AlgorithmTokenBucket, 10))
+	assert.IsType(t, &LeakyBucket{}, New(AlgorithmLeakyBucket, 10))
+	assert.IsType(t, &FixedWindows{}, New(AlgorithmFixedWindows, 10))
+	assert.IsType(t, &SlidingWindowLog{}, New(AlgorithmSlidingWindowLog, 10))
+	assert.IsType(t, &SlidingWindowCount{}, New(AlgorithmSlidingWindowCount, 10))
+	assert.IsType(t, &GCRA{}, New(AlgorithmGCRA, 10))
+
+	assert.Panics(t, func() { New("unknown", 10) })
+	assert.Panics(t, func() { New(AlgorithmTokenBucket, 0) })
+	assert.Panics(t, func() { Builder().Limit(10).Build() })
+}
+
+func TestBuilder(t *testing.T) {
+	tb := Builder().Algorithm(AlgorithmTokenBucket).Limit(10).Burst(20).Interval(time.Minute).Build().(*TokenBucket)
+	assert.Equal(t, float64(10), tb.Rate())
+	assert.Equal(t, 20, tb.Capacity())
+	assert.Equal(t, time.Minute, tb.Interval())
+
+	tb = New(AlgorithmTokenBucket, 10).(*TokenBucket)
+	assert.Equal(t, 10, tb.Capacity())
+	assert.Equal(t, time.Second, tb.Interval())
+
+	sw := Builder().Algorithm(AlgorithmSlidingWindowCount).Limit(10).Buckets(4).Build().(*SlidingWindowCount)
+	assert.Len(t, sw.buckets, 4)
+	assert.Len(t, New(AlgorithmSlidingWindowCount, 10, time.Minute).(*SlidingWindowCount).buckets, defaultSlidingWindowBuckets)
+
+	fw := New(AlgorithmFixedWindows, 5, time.Minute).(*FixedWindows)
+	assert.Equal(t, 5, fw.size)
+	assert.Equal(t, time.Minute, fw.interval)
+}
+
+func TestLimiter_AllAlgorithms(t *testing.T) {
+	for _, algorithm := range []Algorithm{
+		AlgorithmTokenBucket,
+		AlgorithmLeakyBucket,
+		AlgorithmFixedWindows,
+		AlgorithmSlidingWindowLog,
+		AlgorithmSlidingWindowCount,
+		AlgorithmGCRA,
+	} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			l := New(algorithm, 2, 20*time.Millisecond)
+
+			r := l.Reserve()
+			assert.True(t, r.OK())
+			assert.True(t, l.AllowN(1))
+			assert.False(t, l.AllowN(3), "Expected requests beyond the limit to be rejected")
+
+			start := time.Now()
+			assert.NoError(t, l.Wait(context.Background()))
+			assert.Less(t, time.Since(start), time.Second)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			assert.ErrorIs(t, l.Wait(ctx), context.Canceled)
+		})
+	}
+}
+
+func TestLimiter_Reconfigure(t *testing.T) {
+	for _, algorithm := range []Algorithm{
+		AlgorithmTokenBucket,
+		AlgorithmLeakyBucket,
+		AlgorithmFixedWindows,
+		AlgorithmSlidingWindowLog,
+		AlgorithmSlidingWindowCount,
+		AlgorithmGCRA,
+	} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			clock := NewFakeClock(time.Now())
+			l := Builder().Algorithm(algorithm).Limit(10).Interval(time.Second).Clock(clock).Build()
+
+			// the limits change while requests are decided
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 100; j++ {
+						l.Decide(1)
+					}
+				}()
+			}
+			setBurst := func(int) {}
+			if b, ok := l.(BurstReconfigurable); ok {
+				setBurst = b.SetBurst
+			}
+			r := l.(Reconfigurable)
+			for i := 1; i <= 20; i++ {
+				r.SetLimit(i)
+				setBurst(i)
+				r.SetInterval(time.Duration(i) * 100 * time.Millisecond)
+				clock.Advance(10 * time.Millisecond)
+			}
+			wg.Wait()
+
+			r.SetLimit(5)
+			setBurst(5)
+			r.SetInterval(time.Second)
+			// a tick at a time, the ticks being dropped while the leaky bucket is leaking
+			waitFor(t, func() bool {
+				clock.Advance(time.Second)
+				return l.Decide(0).Remaining == 5
+			})
+			assert.True(t, l.Decide(5).Allowed)
+			assert.False(t, l.Decide(1).Allowed, "Expected the new limit to apply")
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrQueueFull is returned by FairQueue.Wait when the queue of the flow is full.
+var ErrQueueFull = errors.New("queue full")
+
+// FairQueue shares a limiter fairly between flows, such as tenants, so that a noisy
+// flow saturating the limiter does not starve the others.
+// The requests wait in a bounded queue per flow, and are admitted one at a time by
+// drawing their permits from the limiter, the flows being served by deficit round robin:
+// each round, a flow may be admitted up to its weight times the quantum of permits,
+// its unused share being carried over to the next round while it has queued requests.
+type FairQueue[K comparable] struct {
+	mu      sync.Mutex
+	limiter Limiter
+	depth   int
+	quantum int
+	weight  func(K) int
+	flows   map[K]*flow[K]
+	active  []*flow[K] // The flows having queued requests, in the order they are served
+	running bool       // Whether the requests are being admitted
+	closed  bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+// flow is the queue of the requests of a key.
+type flow[K comparable] struct {
+	key     K
+	queue   []*fairRequest[K]
+	deficit int  // The permits the flow may still be admitted this round
+	visited bool // Whether the flow has been given its share this round
+}
+
+// fairRequest is a request waiting in the queue of a flow.
+type fairRequest[K comparable] struct {
+	ctx    context.Context
+	n      int
+	flow   *flow[K] // The flow queueing the request, nil once dequeued
+	result chan error
+}
+
+type fairQueueBuilder[K comparable] struct {
+	limiter Limiter
+	depth   int
+	quantum int
+	weight  func(K) int
+}
+
+// FairQueueBuilder returns a new builder for building a fair queue drawing its permits from the limiter.
+func FairQueueBuilder[K comparable](limiter Limiter) *fairQueueBuilder[K] {
+	return &fairQueueBuilder[K]{limiter: limiter, quantum: 1}
+}
+
+// Depth sets the maximum number of requests queued per flow.
+func (b *fairQueueBuilder[K]) Depth(depth int) *fairQueueBuilder[K] {
+	b.depth = depth
+	return b
+}
+
+// Quantum sets the permits a flow of weight 1 may be admitted each round, it defaults to 1.
+func (b *fairQueueBuilder[K]) Quantum(quantum int) *fairQueueBuilder[K] {
+	b.quantum = quantum
+	return b
+}
+
+// Weight sets the function returning the weight of a flow when it starts queueing requests,
+// the flows being admitted permits in proportion to their weights. It defaults to 1 for every flow.
+func (b *fairQueueBuilder[K]) Weight(weight func(K) int) *fairQueueBuilder[K] {
+	b.weight = weight
+	return b
+}
+
+// Build builds a new fair queue.
+func (b *fairQueueBuilder[K]) Build() *FairQueue[K] {
+	if b.limiter == nil || b.depth <= 0 {
+		panic("unspecified limiter or depth")
+	}
+	if b.quantum <= 0 {
+		panic("quantum must be greater than 0")
+	}
+	weight := b.weight
+	if weight == nil {
+		weight = func(K) int { return 1 }
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &FairQueue[K]{
+		limiter: b.limiter,
+		depth:   b.depth,
+		quantum: b.quantum,
+		weight:  weight,
+		flows:   make(map[K]*flow[K]),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// NewFairQueue creates a new fair queue drawing its permits from the limiter,
+// queueing up to depth requests per flow and serving the flows equally.
+func NewFairQueue[K comparable](limiter Limiter, depth int) *FairQueue[K] {
+	return FairQueueBuilder[K](limiter).Depth(depth).Build()
+}
+
+// Wait blocks until a request of the key is admitted, see WaitN.
+func (q *FairQueue[K]) Wait(ctx context.Context, key K) error {
+	return q.WaitN(ctx, key, 1)
+}
+
+// WaitN queues n requests of the key and blocks until they are admitted by the limiter
+// or the context is done.
+// It returns ErrQueueFull without waiting if the queue of the key is full,
+// ErrLimiterClosed if the queue is closed, and the errors of Limiter.WaitN.
+func (q *FairQueue[K]) WaitN(ctx context.Context, key K, n int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r, err := q.push(ctx, key, n)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case err := <-r.result:
+		return err
+	case <-ctx.Done():
+		q.mu.Lock()
+		if r.flow != nil {
+			q.remove(r)
+			q.mu.Unlock()
+			return ctx.Err()
+		}
+		q.mu.Unlock()
+		// the request is being admitted, the limiter gives up waiting as the context is done
+		return <-r.result
+	}
+}
+
+// push queues n requests of the key, starting to admit the requests if needed.
+func (q *FairQueue[K]) push(ctx context.Context, key K, n int) (*fairRequest[K], error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil, ErrLimiterClosed
+	}
+
+	f, ok := q.flows[key]
+	if !ok {
+		f = &flow[K]{key: key}
+		q.flows[key] = f
+	}
+	if len(f.queue) >= q.depth {
+		return nil, ErrQueueFull
+	}
+	if len(f.queue) == 0 {
+		q.active = append(q.active, f)
+	}
+	r := &fairRequest[K]{ctx: ctx, n: n, flow: f, result: make(chan error, 1)}
+	f.queue = append(f.queue, r)
+
+	if !q.running {
+		q.running = true
+		go q.dispatch()
+	}
+	return r, nil
+}
+
+// remove takes a request out of the queue of its flow. It must be called with the lock held.
+func (q *FairQueue[K]) remove(r *fairRequest[K]) {
+	f := r.flow
+	r.flow = nil
+	for i, queued := range f.queue {
+		if queued == r {
+			f.queue = append(f.queue[:i], f.queue[i+1:]...)
+			break
+		}
+	}
+	if len(f.queue) == 0 {
+		q.deactivate(f)
+	}
+}
+
+// deactivate forgets a flow having no queued requests. It must be called with the lock held.
+func (q *FairQueue[K]) deactivate(f *flow[K]) {
+	for i, active := range q.active {
+		if active == f {
+			q.active = append(q.active[:i], q.active[i+1:]...)
+			break
+		}
+	}
+	delete(q.flows, f.key)
+}
+
+// dispatch admits the queued requests one at a time, until there are none left.
+func (q *FairQueue[K]) dispatch() {
+	for {
+		q.mu.Lock()
+		r := q.next()
+		if r == nil {
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		q.mu.Unlock()
+		r.result <- q.admit(r)
+	}
+}
+
+// next dequeues the next request to admit by deficit round robin, or returns nil if there are none.
+// It must be called with the lock held.
+func (q *FairQueue[K]) next() *fairRequest[K] {
+	for len(q.active) > 0 {
+		f := q.active[0]
+		if !f.visited {
+			f.deficit += q.quantum * max(q.weight(f.key), 1)
+			f.visited = true
+		}
+		if r := f.queue[0]; r.n <= f.deficit {
+			f.deficit -= r.n
+			r.flow = nil
+			f.queue = f.queue[1:]
+			if len(f.queue) == 0 {
+				q.deactivate(f)
+			}
+			return r
+		}
+		// the flow has spent its share, the next one is served
+		f.visited = false
+		q.active = append(q.active[1:], f)
+	}
+	return nil
+}
+
+// admit waits for the permits of a dequeued request, until the context of the request is done
+// or the queue is closed.
+func (q *FairQueue[K]) admit(r *fairRequest[K]) error {
+	ctx, cancel := context.WithCancel(r.ctx)
+	defer cancel()
+	stop := context.AfterFunc(q.ctx, cancel)
+	defer stop()
+
+	err := q.limiter.WaitN(ctx, r.n)
+	if err != nil && q.ctx.Err() != nil {
+		return ErrLimiterClosed
+	}
+	return err
+}
+
+// Len returns the number of queued requests, not counting the one being admitted.
+func (q *FairQueue[K]) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var n int
+	for _, f := range q.active {
+		n += len(f.queue)
+	}
+	return n
+}
+
+// Close closes the queue: the queued requests and the later ones return ErrLimiterClosed,
+// and the request being admitted stops waiting for the limiter.
+func (q *FairQueue[K]) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	q.closed = true
+	q.cancel()
+	for _, f := range q.active {
+		for _, r := range f.queue {
+			r.flow = nil
+			r.result <- ErrLimiterClosed
+		}
+	}
+	q.active = nil
+	q.flows = make(map[K]*flow[K])
+}
@@ -0,0 +1,97 @@
+package ratelimiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFairQueue_Weights(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	l := NewTokenBucket(1, 1, 100*time.Millisecond).WithClock(clock)
+	q := FairQueueBuilder[string](l).Depth(3).Weight(func(key string) int {
+		if key == "noisy" {
+			return 2
+		}
+		return 1
+	}).Build()
+
+	admitted := make(chan string, 10)
+	enqueue := func(key string, queued int) {
+		go func() {
+			assert.NoError(t, q.Wait(context.Background(), key))
+			admitted <- key
+		}()
+		waitFor(t, func() bool { return q.Len() == queued })
+	}
+
+	// the first request is admitted at once, the second one waits for the limiter
+	enqueue("noisy", 0)
+	assert.Equal(t, "noisy", <-admitted)
+	enqueue("noisy", 0)
+	waitFor(t, func() bool { return waiters(clock) == 1 })
+
+	for i := 1; i <= 3; i++ {
+		enqueue("noisy", i)
+	}
+	assert.ErrorIs(t, q.Wait(context.Background(), "noisy"), ErrQueueFull)
+	for i := 1; i <= 3; i++ {
+		enqueue("quiet", 3+i)
+	}
+
+	var order []string
+	for range 7 {
+		clock.BlockUntil(1)
+		clock.Advance(100 * time.Millisecond)
+		order = append(order, <-admitted)
+	}
+	// the noisy flow is admitted twice as many requests per round as the quiet one
+	assert.Equal(t, []string{"noisy", "noisy", "noisy", "quiet", "noisy", "quiet", "quiet"}, order)
+	waitFor(t, func() bool { return waiters(clock) == 0 })
+}
+
+func TestFairQueue_Cancel(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	q := NewFairQueue[string](NewTokenBucket(1, 1, 100*time.Millisecond).WithClock(clock), 1)
+
+	assert.ErrorIs(t, q.WaitN(context.Background(), "a", 2), ErrLimitExceeded)
+	assert.NoError(t, q.Wait(context.Background(), "a"))
+
+	// a request waiting for the limiter, and two queued ones
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	defer cancel1()
+	errs1 := make(chan error)
+	go func() { errs1 <- q.Wait(ctx1, "a") }()
+	waitFor(t, func() bool { return waiters(clock) == 1 })
+	errs := make(chan error)
+	go func() { errs <- q.Wait(context.Background(), "b") }()
+	waitFor(t, func() bool { return q.Len() == 1 })
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	errs2 := make(chan error)
+	go func() { errs2 <- q.Wait(ctx2, "a") }()
+	waitFor(t, func() bool { return q.Len() == 2 })
+
+	// the canceled requests leave the queue and the limiter
+	cancel2()
+	assert.ErrorIs(t, <-errs2, context.Canceled)
+	assert.Equal(t, 1, q.Len())
+	cancel1()
+	assert.ErrorIs(t, <-errs1, context.Canceled)
+	waitFor(t, func() bool { return q.Len() == 0 && waiters(clock) == 1 })
+
+	q.Close()
+	q.Close()
+	assert.ErrorIs(t, <-errs, ErrLimiterClosed)
+	waitFor(t, func() bool { return waiters(clock) == 0 })
+	assert.ErrorIs(t, q.Wait(context.Background(), "a"), ErrLimiterClosed)
+}
+
+func TestFairQueue_Build(t *testing.T) {
+	l := New(AlgorithmTokenBucket, 1)
+	assert.Panics(t, func() { NewFairQueue[string](nil, 1) })
+	assert.Panics(t, func() { NewFairQueue[string](l, 0) })
+	assert.Panics(t, func() { FairQueueBuilder[string](l).Depth(1).Quantum(0).Build() })
+	assert.NotPanics(t, func() { NewFairQueue[int](l, 1) })
+}
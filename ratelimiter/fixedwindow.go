@@ -1,6 +1,7 @@
 package ratelimiter
 
 import (
+	"context"
 	"sync"
 	"time"
 )
@@ -12,8 +13,10 @@ type FixedWindows struct {
 	size        int           // The maximum number of requests allowed in each fixed window interval
 	count       int           // The current count of requests in the current window
 	interval    time.Duration // The duration of each fixed window interval
-	lastTime    time.Time     // The last time a window reset occurred
+	lastTime    time.Time     // The start of the current window, in the future if the next window has been reserved
 	nextWinTime time.Time     // The start time of the next window
+	prevCount   int           // The count of the previous window, when the current one has been reserved
+	clock       Clock         // The clock telling the time
 }
 
 // NewFixedWindows creates a new FixedWindows rate limiter with a specified size and optional interval.
@@ -27,6 +30,7 @@ func NewFixedWindows(size int, interval ...time.Duration) *FixedWindows {
 		count:    0,
 		interval: time.Second,
 		lastTime: now,
+		clock:    realClock{},
 	}
 
 	if len(interval) > 0 {
@@ -46,21 +50,200 @@ func (fw *FixedWindows) Allow() bool {
 // AllowN checks if 'n' requests can be allowed in the current window.
 // It returns true if the requests are allowed, and false otherwise.
 func (fw *FixedWindows) AllowN(n int) bool {
+	return fw.reserveN(fw.clock.Now(), n, 0).OK()
+}
+
+// Wait blocks until a single request is allowed or the context is done.
+func (fw *FixedWindows) Wait(ctx context.Context) error {
+	return fw.WaitN(ctx, 1)
+}
+
+// WaitN blocks until 'n' requests are allowed.
+// It returns an error if 'n' exceeds the size, the context is done,
+// or the wait would exceed the context deadline.
+func (fw *FixedWindows) WaitN(ctx context.Context, n int) error {
+	return waitN(ctx, fw.clock, fw, n)
+}
+
+// Reserve reserves a single request in the current window if it is not full,
+// or in the next one.
+func (fw *FixedWindows) Reserve() *Reservation {
+	return fw.ReserveN(1)
+}
+
+// ReserveN reserves 'n' requests in the current window if it has room for them,
+// or in the next one. The reservation is not OK if 'n' exceeds the size.
+func (fw *FixedWindows) ReserveN(n int) *Reservation {
+	return fw.reserveN(fw.clock.Now(), n, InfDuration)
+}
+
+// reserveN counts 'n' requests in the current window, or in the next one if the
+// current one is full and the next one starts within maxWait.
+// The window may then start in the future, until which no request is allowed.
+func (fw *FixedWindows) reserveN(now time.Time, n int, maxWait time.Duration) *Reservation {
 	fw.mu.Lock()
 	defer fw.mu.Unlock()
+	return fw.reserve(now, n, maxWait)
+}
 
-	now := time.Now()
+// reserve is reserveN with the lock held.
+func (fw *FixedWindows) reserve(now time.Time, n int, maxWait time.Duration) *Reservation {
+	if n > fw.size {
+		return &Reservation{} // Reject the request(s) if it exceeds the limit
+	}
+
+	fw.advance(now)
+
+	start, count := fw.lastTime, fw.count
+	if count+n > fw.size {
+		start, count = fw.nextWinTime, 0
+	}
+	timeToAct := now
+	if start.After(now) {
+		timeToAct = start
+	}
+	if timeToAct.Sub(now) > maxWait {
+		return &Reservation{timeToAct: timeToAct}
+	}
+
+	if !start.Equal(fw.lastTime) {
+		fw.prevCount = fw.count
+		fw.lastTime = start
+		fw.nextWinTime = start.Add(fw.interval)
+	}
+	fw.count = count + n
+	return &Reservation{ok: true, tokens: n, timeToAct: timeToAct, limiter: fw, clock: fw.clock}
+}
+
+// cancel removes the reserved requests from their window if it is the latest one.
+// Once a reserved window is empty, the previous one becomes current again.
+func (fw *FixedWindows) cancel(r *Reservation, now time.Time) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	if r.tokens == 0 || !r.timeToAct.After(now) {
+		return
+	}
+	fw.uncount(r, now)
+}
+
+// refund removes the requests of the reservation from their window, whenever it acts.
+func (fw *FixedWindows) refund(r *Reservation) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if r.tokens > 0 {
+		fw.uncount(r, fw.clock.Now())
+	}
+}
+
+// uncount removes the requests of the reservation from their window if it is the latest one,
+// and marks the reservation as canceled. It must be called with the lock held.
+func (fw *FixedWindows) uncount(r *Reservation, now time.Time) {
+	n := r.tokens
+	r.tokens = 0
+	fw.advance(now)
+	if r.timeToAct.Before(fw.lastTime) {
+		return
+	}
+
+	fw.count = max(fw.count-n, 0)
+	if fw.count == 0 && fw.lastTime.After(now) {
+		fw.lastTime = fw.lastTime.Add(-fw.interval)
+		fw.nextWinTime = fw.lastTime.Add(fw.interval)
+		// the count of the window before is unknown, consider it full
+		fw.count, fw.prevCount = fw.prevCount, fw.size
+	}
+}
+
+// advance moves to the window of the given time if the current one has ended.
+func (fw *FixedWindows) advance(now time.Time) {
 	if now.After(fw.nextWinTime) {
 		timeWindows := now.Sub(fw.lastTime) / fw.interval
 		fw.count = 0
 		fw.lastTime = fw.lastTime.Add(timeWindows * fw.interval)
 		fw.nextWinTime = fw.lastTime.Add(fw.interval)
 	}
+}
+
+// Decide reports whether 'n' requests may happen now, counting them if so,
+// along with the requests remaining in the current window.
+func (fw *FixedWindows) Decide(n int) Decision {
+	_, d := fw.decide(fw.clock.Now(), n)
+	return d
+}
+
+// decide is Decide at now, also returning the reservation of the allowed requests.
+func (fw *FixedWindows) decide(now time.Time, n int) (*Reservation, Decision) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	r := fw.reserve(now, n, 0)
+	return r, newDecision(now, r, fw.quota(now))
+}
 
-	if fw.count+n > fw.size {
-		return false // Reject the request(s) if it exceeds the limit
+// quota returns the quota of the current window, which may have been reserved
+// and not started yet. It must be called with the lock held.
+func (fw *FixedWindows) quota(now time.Time) quota {
+	fw.advance(now)
+	q := quota{limit: fw.size, resetAt: fw.nextWinTime}
+	if !fw.lastTime.After(now) {
+		q.remaining = max(fw.size-fw.count, 0)
+		if fw.count == 0 {
+			q.resetAt = now
+		}
 	}
+	return q
+}
 
-	fw.count += n
-	return true
+// Burst returns the limit of a window, which is allowed at once.
+func (fw *FixedWindows) Burst() int {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	return fw.size
+}
+
+// WithClock sets the clock of the limiter, which defaults to the time package, and returns the limiter,
+// as in NewFixedWindows(10).WithClock(clock).
+func (fw *FixedWindows) WithClock(clock Clock) *FixedWindows {
+	fw.setClock(clock)
+	return fw
+}
+
+// setClock replaces the clock of the limiter, the current window starts at its current time.
+func (fw *FixedWindows) setClock(clock Clock) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	fw.clock = clock
+	fw.count = 0
+	fw.lastTime = clock.Now()
+	fw.nextWinTime = fw.lastTime.Add(fw.interval)
+}
+
+// currentClock returns the clock of the limiter.
+func (fw *FixedWindows) currentClock() Clock {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	return fw.clock
+}
+
+// SetLimit changes the number of requests allowed per window,
+// the requests of the current window still count.
+func (fw *FixedWindows) SetLimit(limit int) {
+	if limit <= 0 {
+		panic("limit must be greater than 0")
+	}
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	fw.size = limit
+}
+
+// SetInterval changes the duration of the windows, the current one ending one new interval after its start.
+func (fw *FixedWindows) SetInterval(interval time.Duration) {
+	if interval <= 0 {
+		panic("interval must be greater than 0")
+	}
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	fw.advance(fw.clock.Now())
+	fw.interval = interval
+	fw.nextWinTime = fw.lastTime.Add(interval)
 }
@@ -11,7 +11,8 @@ func TestFixedWindows_ShouldWork(t *testing.T) {
 	const size = 10
 	const interval = time.Millisecond
 
-	rl := NewFixedWindows(size, interval)
+	clock := NewFakeClock(time.Now())
+	rl := NewFixedWindows(size, interval).WithClock(clock)
 
 	// out of size, should be rejected
 	assert.False(t, rl.AllowN(size+1))
@@ -26,13 +27,73 @@ func TestFixedWindows_ShouldWork(t *testing.T) {
 		assert.False(t, rl.Allow())
 	}
 
-	// sleep for 1 interval to generate new tokens, should be allowed
-	time.Sleep(interval)
+	// advance 1 interval to generate new tokens, should be allowed
+	clock.Advance(interval)
 	for i := 0; i < size/2; i++ {
 		assert.True(t, rl.Allow())
 	}
-	time.Sleep(interval / 2)
+	clock.Advance(interval / 2)
 	for i := 0; i < size/2; i++ {
 		assert.True(t, rl.Allow())
 	}
 }
+
+func TestFixedWindows_Reserve(t *testing.T) {
+	const interval = 100 * time.Millisecond
+	rl := NewFixedWindows(2, interval)
+	now := rl.lastTime
+
+	assert.Equal(t, time.Duration(0), rl.reserveN(now, 2, InfDuration).DelayFrom(now))
+
+	// the current window is full, the next one is reserved
+	assert.False(t, rl.reserveN(now, 1, interval/2).OK())
+	r := rl.reserveN(now.Add(interval/4), 1, InfDuration)
+	assert.Equal(t, interval-interval/4, r.DelayFrom(now.Add(interval/4)))
+
+	// no request is allowed until the reserved window starts
+	assert.False(t, rl.reserveN(now.Add(interval/2), 1, 0).OK())
+	assert.Equal(t, interval, rl.reserveN(now, 1, InfDuration).DelayFrom(now))
+	assert.Equal(t, 2*interval, rl.reserveN(now, 1, InfDuration).DelayFrom(now))
+
+	assert.False(t, rl.reserveN(now, 3, InfDuration).OK())
+}
+
+func TestFixedWindows_Cancel(t *testing.T) {
+	const interval = 100 * time.Millisecond
+	rl := NewFixedWindows(2, interval)
+	now := rl.lastTime
+
+	rl.reserveN(now, 1, 0)
+	r1 := rl.reserveN(now, 2, InfDuration)
+	r2 := rl.reserveN(now, 2, InfDuration)
+	assert.Equal(t, 2*interval, r2.DelayFrom(now))
+
+	// the earlier window cannot be restored
+	r1.CancelAt(now)
+	assert.Equal(t, 3*interval, rl.reserveN(now, 2, InfDuration).DelayFrom(now), "Expected the window after r2")
+
+	rl = NewFixedWindows(2, interval)
+	now = rl.lastTime
+	rl.reserveN(now, 1, 0)
+	r := rl.reserveN(now, 2, InfDuration)
+	r.CancelAt(now)
+	assert.True(t, rl.reserveN(now, 1, 0).OK(), "Expected the current window to be restored")
+	assert.False(t, rl.reserveN(now, 1, 0).OK())
+}
+
+func TestFixedWindows_Reconfigure(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	fw := NewFixedWindows(2, time.Second).WithClock(clock)
+
+	assert.True(t, fw.AllowN(2))
+	fw.SetLimit(3)
+	assert.True(t, fw.Allow(), "Expected the current window to have room for the new limit")
+	assert.False(t, fw.Allow())
+
+	// the current window ends one new interval after its start
+	fw.SetInterval(100 * time.Millisecond)
+	clock.Advance(100*time.Millisecond + time.Nanosecond)
+	assert.True(t, fw.AllowN(3))
+	assert.False(t, fw.Allow())
+	assert.Panics(t, func() { fw.SetInterval(0) })
+}
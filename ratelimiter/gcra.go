@@ -0,0 +1,267 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// GCRA is a rate limiter based on the generic cell rate algorithm.
+// It behaves like a token bucket refilled continuously, but only stores
+// the theoretical arrival time of the next request: requests are spaced by an
+// emission interval, and may arrive early by up to 'burst' emission intervals.
+// This gives smooth rate enforcement and exact retry delays.
+type GCRA struct {
+	mu        sync.Mutex
+	interval  time.Duration // The interval 'rate' requests are allowed in
+	rate      int           // The number of requests allowed per interval
+	emission  time.Duration // The time between two requests at the sustained rate
+	tolerance time.Duration // How early requests may arrive, 'burst' emission intervals
+	burst     int           // The maximum number of requests allowed at once
+	tat       time.Time     // The theoretical arrival time of the next request
+	clock     Clock         // The clock telling the time
+}
+
+// NewGCRA creates a new GCRA limiter allowing 'rate' requests per interval,
+// and up to 'burst' requests at once.
+// If no interval is provided, it defaults to 1 second.
+// It panics if the interval is shorter than 'rate' nanoseconds, which leaves no time between the requests.
+func NewGCRA(rate, burst int, interval ...time.Duration) *GCRA {
+	if rate <= 0 || burst <= 0 {
+		panic("rate and burst must be greater than 0")
+	}
+
+	period := time.Second
+	if len(interval) > 0 {
+		period = interval[0]
+	}
+	emission := emissionInterval(period, rate)
+	return &GCRA{
+		interval:  period,
+		rate:      rate,
+		emission:  emission,
+		tolerance: emission * time.Duration(burst),
+		burst:     burst,
+		clock:     realClock{},
+	}
+}
+
+// Allow checks if a single request is allowed now.
+func (g *GCRA) Allow() bool {
+	return g.AllowN(1)
+}
+
+// AllowN checks if 'n' requests are allowed now.
+func (g *GCRA) AllowN(n int) bool {
+	return g.reserveN(g.clock.Now(), n, 0).OK()
+}
+
+// Wait blocks until a single request is allowed or the context is done.
+func (g *GCRA) Wait(ctx context.Context) error {
+	return g.WaitN(ctx, 1)
+}
+
+// WaitN blocks until 'n' requests are allowed.
+// It returns an error if 'n' exceeds the burst, the context is done,
+// or the wait would exceed the context deadline.
+func (g *GCRA) WaitN(ctx context.Context, n int) error {
+	return waitN(ctx, g.clock, g, n)
+}
+
+// Reserve reserves a single request at the time it conforms to the rate.
+func (g *GCRA) Reserve() *Reservation {
+	return g.ReserveN(1)
+}
+
+// ReserveN reserves 'n' requests at the time they conform to the rate.
+// The reservation is not OK if 'n' exceeds the burst.
+func (g *GCRA) ReserveN(n int) *Reservation {
+	return g.reserveN(g.clock.Now(), n, InfDuration)
+}
+
+// Decide reports whether 'n' requests may happen now, counting them if so,
+// along with the requests remaining in the burst.
+func (g *GCRA) Decide(n int) Decision {
+	_, d := g.decide(g.clock.Now(), n)
+	return d
+}
+
+// decide is Decide at now, also returning the reservation of the allowed requests.
+func (g *GCRA) decide(now time.Time, n int) (*Reservation, Decision) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	r := g.reserve(now, n, 0)
+	return r, newDecision(now, r, g.quota(now))
+}
+
+// reserveN moves the theoretical arrival time 'n' emission intervals forward
+// if the requests conform to the rate within maxWait.
+func (g *GCRA) reserveN(now time.Time, n int, maxWait time.Duration) *Reservation {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.reserve(now, n, maxWait)
+}
+
+// reserve is reserveN with the lock held.
+func (g *GCRA) reserve(now time.Time, n int, maxWait time.Duration) *Reservation {
+	if n > g.burst {
+		return &Reservation{}
+	}
+
+	tat := g.arrival(now).Add(time.Duration(n) * g.emission)
+	// the requests conform once they arrive at most 'tolerance' early
+	timeToAct := now
+	if allowAt := tat.Add(-g.tolerance); allowAt.After(now) {
+		timeToAct = allowAt
+	}
+	if timeToAct.Sub(now) > maxWait {
+		return &Reservation{timeToAct: timeToAct}
+	}
+
+	g.tat = tat
+	return &Reservation{ok: true, tokens: n, timeToAct: timeToAct, limiter: g, clock: g.clock}
+}
+
+// cancel moves the theoretical arrival time back by the emission intervals of the
+// reservation, except the ones the later reservations arrive in.
+func (g *GCRA) cancel(r *Reservation, now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if r.tokens == 0 || !r.timeToAct.After(now) {
+		return
+	}
+	// the reservation was delayed, so its theoretical arrival time was its time to act plus the tolerance
+	later := g.tat.Sub(r.timeToAct.Add(g.tolerance))
+	restore := time.Duration(r.tokens)*g.emission - later
+	r.tokens = 0
+	if restore > 0 {
+		g.tat = g.tat.Add(-restore)
+	}
+}
+
+// refund moves the theoretical arrival time back by the emission intervals of the reservation,
+// whenever it acts.
+func (g *GCRA) refund(r *Reservation) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.tat = g.tat.Add(-time.Duration(r.tokens) * g.emission)
+	r.tokens = 0
+}
+
+// quota returns the requests remaining in the burst, the limiter being reset
+// once the theoretical arrival time is reached.
+// It must be called with the lock held.
+func (g *GCRA) quota(now time.Time) quota {
+	tat := g.arrival(now)
+	early := tat.Sub(now)
+	return quota{
+		limit:     g.burst,
+		remaining: max(int((g.tolerance-early)/g.emission), 0),
+		resetAt:   tat,
+	}
+}
+
+// emissionInterval returns the time between two requests at 'rate' requests per interval.
+// It panics if it is not positive.
+func emissionInterval(interval time.Duration, rate int) time.Duration {
+	emission := interval / time.Duration(rate)
+	if emission <= 0 {
+		panic("interval must be at least 1ns per request")
+	}
+	return emission
+}
+
+// arrival returns the theoretical arrival time of the next request, not before now.
+func (g *GCRA) arrival(now time.Time) time.Time {
+	if g.tat.Before(now) {
+		return now
+	}
+	return g.tat
+}
+
+// Burst returns the number of requests allowed at once.
+func (g *GCRA) Burst() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.burst
+}
+
+// WithClock sets the clock of the limiter, which defaults to the time package, and returns the limiter,
+// as in NewGCRA(10, 5).WithClock(clock).
+func (g *GCRA) WithClock(clock Clock) *GCRA {
+	g.setClock(clock)
+	return g
+}
+
+// setClock replaces the clock of the limiter, forgetting the past requests.
+func (g *GCRA) setClock(clock Clock) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.clock = clock
+	g.tat = time.Time{}
+}
+
+// currentClock returns the clock of the limiter.
+func (g *GCRA) currentClock() Clock {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.clock
+}
+
+// TAT returns the theoretical arrival time of the next request,
+// which is the whole state of the limiter.
+func (g *GCRA) TAT() time.Time {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.tat
+}
+
+// SetLimit changes the number of requests allowed per interval.
+// The requests already counted keep delaying the next ones, at the new rate.
+// It panics if the interval is shorter than 'limit' nanoseconds.
+func (g *GCRA) SetLimit(limit int) {
+	if limit <= 0 {
+		panic("limit must be greater than 0")
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.setEmission(emissionInterval(g.interval, limit))
+	g.rate = limit
+}
+
+// SetBurst changes the number of requests allowed at once.
+func (g *GCRA) SetBurst(burst int) {
+	if burst <= 0 {
+		panic("burst must be greater than 0")
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.burst = burst
+	g.tolerance = g.emission * time.Duration(burst)
+}
+
+// SetInterval changes the interval the requests are allowed in.
+// The requests already counted keep delaying the next ones, at the new rate.
+// It panics if the interval is shorter than the rate in nanoseconds.
+func (g *GCRA) SetInterval(interval time.Duration) {
+	if interval <= 0 {
+		panic("interval must be greater than 0")
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.setEmission(emissionInterval(interval, g.rate))
+	g.interval = interval
+}
+
+// setEmission changes the emission interval, rescaling the time the theoretical arrival time
+// is ahead of now, which is the emission intervals of the requests not conforming yet.
+// It must be called with the lock held.
+func (g *GCRA) setEmission(emission time.Duration) {
+	now := g.clock.Now()
+	if ahead := g.tat.Sub(now); ahead > 0 {
+		g.tat = now.Add(time.Duration(float64(ahead) * float64(emission) / float64(g.emission)))
+	}
+	g.emission = emission
+	g.tolerance = emission * time.Duration(g.burst)
+}
@@ -0,0 +1,101 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewGCRA(t *testing.T) {
+	assert.Panics(t, func() { NewGCRA(0, 1) })
+	assert.Panics(t, func() { NewGCRA(1, 0) })
+
+	g := NewGCRA(10, 5)
+	assert.Equal(t, 100*time.Millisecond, g.emission)
+	assert.Equal(t, 500*time.Millisecond, g.tolerance)
+}
+
+func TestGCRA_ShouldWork(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	g := NewGCRA(10, 5, time.Second).WithClock(clock)
+
+	// the burst is allowed at once
+	assert.False(t, g.AllowN(6))
+	for i := 0; i < 5; i++ {
+		assert.True(t, g.Allow())
+	}
+	assert.False(t, g.Allow())
+	assert.Equal(t, clock.Now().Add(500*time.Millisecond), g.TAT())
+
+	// the requests are then allowed smoothly, one per emission interval
+	clock.Advance(50 * time.Millisecond)
+	assert.False(t, g.Allow())
+	clock.Advance(50 * time.Millisecond)
+	assert.True(t, g.Allow())
+	assert.False(t, g.Allow())
+
+	// the burst is restored once the theoretical arrival time is reached
+	clock.Advance(500 * time.Millisecond)
+	assert.True(t, g.AllowN(5))
+}
+
+func TestGCRA_Reserve(t *testing.T) {
+	g := NewGCRA(10, 2, time.Second)
+	now := time.Now()
+
+	assert.Equal(t, time.Duration(0), g.reserveN(now, 2, InfDuration).DelayFrom(now))
+	r1 := g.reserveN(now, 1, InfDuration)
+	assert.Equal(t, 100*time.Millisecond, r1.DelayFrom(now))
+	r2 := g.reserveN(now, 2, InfDuration)
+	assert.Equal(t, 300*time.Millisecond, r2.DelayFrom(now))
+
+	r := g.reserveN(now, 1, 200*time.Millisecond)
+	assert.False(t, r.OK())
+	assert.Equal(t, 400*time.Millisecond, r.timeToAct.Sub(now))
+	assert.Equal(t, ErrWaitExceedsDeadline, r.err())
+
+	// the intervals of r1 are taken by r2, nothing is restored
+	r1.CancelAt(now)
+	assert.Equal(t, now.Add(500*time.Millisecond), g.tat)
+
+	// the intervals of the latest reservation are restored
+	r2.CancelAt(now)
+	assert.Equal(t, now.Add(300*time.Millisecond), g.tat)
+	r2.CancelAt(now)
+	assert.Equal(t, now.Add(300*time.Millisecond), g.tat, "Expected a canceled reservation not to restore twice")
+}
+
+func TestGCRA_Reconfigure(t *testing.T) {
+	start := time.Now()
+	clock := NewFakeClock(start)
+	g := NewGCRA(10, 2).WithClock(clock)
+
+	assert.True(t, g.AllowN(2))
+	assert.Equal(t, start.Add(200*time.Millisecond), g.TAT())
+
+	// the requests counted delay the next ones at the new rate
+	g.SetLimit(20)
+	assert.Equal(t, start.Add(100*time.Millisecond), g.TAT())
+	d := g.Decide(1)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, 50*time.Millisecond, d.RetryAfter)
+
+	g.SetBurst(4)
+	assert.True(t, g.Allow())
+	assert.Equal(t, start.Add(150*time.Millisecond), g.TAT())
+
+	g.SetInterval(2 * time.Second)
+	assert.Equal(t, start.Add(300*time.Millisecond), g.TAT())
+	assert.True(t, g.Allow())
+	assert.False(t, g.Allow())
+	assert.Panics(t, func() { g.SetBurst(0) })
+
+	// no time would be left between the requests
+	assert.Panics(t, func() { g.SetLimit(3e9) })
+	assert.Panics(t, func() { g.SetInterval(time.Nanosecond) })
+	assert.Equal(t, 20, g.rate, "Expected a rejected change to keep the rate")
+	assert.Equal(t, 2*time.Second, g.interval)
+	assert.Panics(t, func() { NewGCRA(10, 1, 5*time.Nanosecond) })
+	assert.Panics(t, func() { NewGCRA(10, 1, 0) })
+}
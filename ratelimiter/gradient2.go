@@ -0,0 +1,90 @@
+package ratelimiter
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Default parameters of Gradient2.
+const (
+	defaultGradient2Tolerance  = 1.5
+	defaultGradient2Smoothing  = 0.2
+	defaultGradient2LongWindow = 600
+	defaultGradient2QueueSize  = 4
+	// gradient2MinGradient bounds how much the limit decreases at once.
+	gradient2MinGradient = 0.5
+	// gradient2DriftRatio is the ratio of the long-term latency over the sample latency above which
+	// the long-term latency decays, so that it recovers from a transient latency spike.
+	gradient2DriftRatio = 2
+	gradient2DriftDecay = 0.95
+)
+
+// Gradient2 is an AdaptiveAlgorithm adjusting the limit by the gradient between the long-term
+// average latency and the sample latency: the limit decreases when the latency grows beyond
+// the tolerated ratio of the long-term average, and otherwise grows by a small queue size.
+// A dropped request decreases the limit at once, as much as a window of slow requests.
+// Since the long-term average follows the latency, the limit converges once it stops adding latency.
+type Gradient2 struct {
+	tolerance  float64
+	smoothing  float64
+	longWindow float64
+	queueSize  float64
+	mu         sync.Mutex // Guards longRTT, read by LongRTT outside the lock of the limiter
+	longRTT    float64    // The exponential average of the latency over about 'longWindow' samples, in nanoseconds
+}
+
+// NewGradient2 creates a new Gradient2 algorithm tolerating a latency 1.5 times the long-term average,
+// averaged over 600 samples, and smoothing the limit changes by 0.2.
+func NewGradient2() *Gradient2 {
+	return &Gradient2{
+		tolerance:  defaultGradient2Tolerance,
+		smoothing:  defaultGradient2Smoothing,
+		longWindow: defaultGradient2LongWindow,
+		queueSize:  defaultGradient2QueueSize,
+	}
+}
+
+// Update adjusts the limit by the gradient between the long-term and the sample latency.
+func (g *Gradient2) Update(limit float64, s Sample) float64 {
+	if s.RTT <= 0 {
+		return limit
+	}
+	rtt := float64(s.RTT)
+	longRTT := g.updateLongRTT(rtt)
+	if appLimited(limit, s) && !s.Dropped {
+		return limit
+	}
+
+	if s.Dropped {
+		// the downstream is overloaded, a drop applies the whole smoothed decrease at once
+		target := limit*gradient2MinGradient + g.queueSize
+		return limit + (target-limit)*g.smoothing
+	}
+	gradient := max(gradient2MinGradient, min(1, g.tolerance*longRTT/rtt))
+	// each sample applies 1/limit of the smoothed change, so that the limit changes once per window
+	target := limit*gradient + g.queueSize
+	return limit + (target-limit)*g.smoothing/limit
+}
+
+// updateLongRTT averages the latency into the long-term one, and returns it.
+func (g *Gradient2) updateLongRTT(rtt float64) float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.longRTT == 0 {
+		g.longRTT = rtt
+	} else {
+		g.longRTT += (rtt - g.longRTT) / g.longWindow
+	}
+	if g.longRTT/rtt > gradient2DriftRatio {
+		g.longRTT *= gradient2DriftDecay
+	}
+	return g.longRTT
+}
+
+// LongRTT returns the long-term average latency.
+func (g *Gradient2) LongRTT() time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return time.Duration(math.Round(g.longRTT))
+}
@@ -0,0 +1,287 @@
+package ratelimiter
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// classSeparator separates the names of the classes in the path of a class of a Hierarchy.
+const classSeparator = "/"
+
+// Errors returned when managing the classes of a Hierarchy.
+var (
+	ErrUnknownClass = errors.New("unknown class")
+	ErrClassExists  = errors.New("class already exists")
+	ErrRootClass    = errors.New("root class cannot be removed")
+)
+
+// Hierarchy is a hierarchical limiter whose classes form a tree, such as tenants, their users
+// and the endpoints they call, like the classes of the Linux HTB queuing discipline.
+//
+// Each class is guaranteed a rate, and may borrow from its parent up to a ceiling
+// once it exceeds it. A request of a class is allowed if the class is within its rate,
+// or if it is within its ceiling and its parent allows it to borrow, the parent itself
+// being within its rate or borrowing from its own parent. The requests count against the
+// class and all its ancestors, so the children borrow the rates their siblings leave unused.
+// The guaranteed rates are always honored, so the rates of the children of a class
+// should not add up to more than its rate.
+//
+// The classes refill continuously, up to their rate and ceiling at once.
+//
+// A class is named within its parent, and identified by its path: the names of its ancestors
+// below the root and its own, joined by slashes, such as "acme/alice". The root class has
+// the empty path, so the path of a class under the root is its name.
+type Hierarchy struct {
+	mu       sync.Mutex
+	interval time.Duration // The interval the rates are allowed in
+	root     *quotaClass
+	classes  map[string]*quotaClass // The classes by path
+	clock    Clock
+}
+
+// quotaClass is a class of a Hierarchy, with one bucket of tokens for its rate
+// and one for its ceiling. The buckets may be in debt once the requests of
+// the children count against them.
+type quotaClass struct {
+	path     string
+	parent   *quotaClass
+	children map[string]*quotaClass // The children by name
+	rate     float64                // The requests guaranteed per interval, and the capacity of tokens
+	ceil     float64                // The maximum requests per interval, borrowing included, and the capacity of ctokens
+	tokens   float64                // The tokens of the guaranteed rate
+	ctokens  float64                // The tokens of the ceiling
+	lastTime time.Time              // The time the buckets were last refilled
+}
+
+// NewHierarchy creates a new hierarchical limiter whose root class, named by the empty string,
+// allows 'rate' requests per interval. If no interval is provided, it defaults to 1 second.
+func NewHierarchy(rate int, interval ...time.Duration) *Hierarchy {
+	if rate <= 0 {
+		panic("rate must be greater than 0")
+	}
+	h := &Hierarchy{interval: time.Second, classes: make(map[string]*quotaClass), clock: realClock{}}
+	if len(interval) > 0 {
+		h.interval = interval[0]
+	}
+	if h.interval <= 0 {
+		panic("interval must be greater than 0")
+	}
+	h.root = newQuotaClass("", nil, rate, rate, h.clock.Now())
+	h.classes[""] = h.root
+	return h
+}
+
+func newQuotaClass(path string, parent *quotaClass, rate, ceil int, now time.Time) *quotaClass {
+	return &quotaClass{
+		path:     path,
+		parent:   parent,
+		children: make(map[string]*quotaClass),
+		rate:     float64(rate),
+		ceil:     float64(ceil),
+		tokens:   float64(rate),
+		ctokens:  float64(ceil),
+		lastTime: now,
+	}
+}
+
+// Add adds a class named 'name' under the parent class of the given path, guaranteed 'rate' requests
+// per interval and allowed up to 'ceil' requests per interval by borrowing from its parent,
+// and returns the path of the class.
+// It panics if the name is empty or contains a slash, if the rate is not positive
+// or if the ceiling is less than the rate.
+func (h *Hierarchy) Add(name, parent string, rate, ceil int) (string, error) {
+	if name == "" || strings.Contains(name, classSeparator) {
+		panic("name must not be empty nor contain a slash")
+	}
+	if rate <= 0 || ceil < rate {
+		panic("rate must be greater than 0, and ceil at least rate")
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	p, ok := h.classes[parent]
+	if !ok {
+		return "", ErrUnknownClass
+	}
+	if _, ok := p.children[name]; ok {
+		return "", ErrClassExists
+	}
+	path := name
+	if p != h.root {
+		path = parent + classSeparator + name
+	}
+	c := newQuotaClass(path, p, rate, ceil, h.clock.Now())
+	p.children[name] = c
+	h.classes[path] = c
+	return path, nil
+}
+
+// Remove removes the class of the given path and its descendants.
+func (h *Hierarchy) Remove(path string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	c, ok := h.classes[path]
+	switch {
+	case !ok:
+		return ErrUnknownClass
+	case c == h.root:
+		return ErrRootClass
+	}
+	delete(c.parent.children, path[strings.LastIndex(path, classSeparator)+1:])
+	h.remove(c)
+	return nil
+}
+
+// remove forgets the class and its descendants.
+func (h *Hierarchy) remove(c *quotaClass) {
+	delete(h.classes, c.path)
+	for _, child := range c.children {
+		h.remove(child)
+	}
+}
+
+// Len returns the number of classes, including the root class.
+func (h *Hierarchy) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.classes)
+}
+
+// Allow checks if a single request of the class of the given path is allowed now.
+func (h *Hierarchy) Allow(class string) bool {
+	return h.AllowN(class, 1)
+}
+
+// AllowN checks if 'n' requests of the class are allowed now, counting them if so.
+// It returns false if the class does not exist.
+func (h *Hierarchy) AllowN(class string, n int) bool {
+	d, err := h.Decide(class, n)
+	return err == nil && d.Allowed
+}
+
+// Decide reports whether 'n' requests of the class are allowed now, counting them if so,
+// along with the requests the class may still make now, borrowing included.
+// It returns ErrUnknownClass if the class does not exist.
+func (h *Hierarchy) Decide(class string, n int) (Decision, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	c, ok := h.classes[class]
+	if !ok {
+		return Decision{}, ErrUnknownClass
+	}
+	now := h.clock.Now()
+	var path []*quotaClass
+	for a := c; a != nil; a = a.parent {
+		a.refill(now, h.interval)
+		path = append(path, a)
+	}
+
+	d := Decision{Allowed: lend(path, float64(n)) >= 0, Limit: int(c.ceil), now: now}
+	if d.Allowed {
+		for _, a := range path {
+			a.charge(float64(n))
+		}
+	} else {
+		d.RetryAfter = h.retryAfter(path, float64(n))
+	}
+	d.Remaining = remaining(path)
+	d.ResetAt = now.Add(h.refilled(path))
+	return d, nil
+}
+
+// lend returns the index in the path, from the class up to the root, of the class lending
+// its tokens to the requests: the first one within its rate, the classes before it being
+// within their ceiling. It returns -1 if the requests are not allowed.
+func lend(path []*quotaClass, n float64) int {
+	for i, a := range path {
+		if a.ctokens < n {
+			return -1
+		}
+		if a.tokens >= n {
+			return i
+		}
+	}
+	return -1
+}
+
+// remaining returns the number of requests the first class of the path may make now,
+// the most any class of the path may lend.
+func remaining(path []*quotaClass) int {
+	best, ceil := 0.0, math.Inf(1)
+	for _, a := range path {
+		ceil = min(ceil, a.ctokens)
+		best = max(best, min(ceil, a.tokens))
+	}
+	return int(best)
+}
+
+// retryAfter returns how long until the requests are allowed, when a class of the path
+// has enough tokens to lend them and the classes before it have enough ceiling tokens.
+func (h *Hierarchy) retryAfter(path []*quotaClass, n float64) time.Duration {
+	retry, ceilWait := InfDuration, time.Duration(0)
+	for _, a := range path {
+		ceilWait = max(ceilWait, h.refillTime(a.ctokens, n, a.ceil))
+		retry = min(retry, max(ceilWait, h.refillTime(a.tokens, n, a.rate)))
+	}
+	return retry
+}
+
+// refilled returns how long until the buckets of the classes of the path are full.
+func (h *Hierarchy) refilled(path []*quotaClass) time.Duration {
+	var d time.Duration
+	for _, a := range path {
+		d = max(d, h.refillTime(a.tokens, a.rate, a.rate), h.refillTime(a.ctokens, a.ceil, a.ceil))
+	}
+	return d
+}
+
+// refillTime returns how long until a bucket refilled at 'rate' per interval holds 'n' tokens,
+// InfDuration if it never does.
+func (h *Hierarchy) refillTime(tokens, n, rate float64) time.Duration {
+	switch {
+	case tokens >= n:
+		return 0
+	case n > rate:
+		return InfDuration
+	}
+	return time.Duration(math.Ceil((n - tokens) / rate * float64(h.interval)))
+}
+
+// refill refills the buckets of the class up to now.
+func (c *quotaClass) refill(now time.Time, interval time.Duration) {
+	elapsed := float64(now.Sub(c.lastTime)) / float64(interval)
+	if elapsed <= 0 {
+		return
+	}
+	c.tokens = min(c.tokens+elapsed*c.rate, c.rate)
+	c.ctokens = min(c.ctokens+elapsed*c.ceil, c.ceil)
+	c.lastTime = now
+}
+
+// charge counts 'n' requests against the buckets of the class, whose debt is bounded by their capacity.
+func (c *quotaClass) charge(n float64) {
+	c.tokens = max(c.tokens-n, -c.rate)
+	c.ctokens = max(c.ctokens-n, -c.ceil)
+}
+
+// WithClock sets the clock of the limiter, which defaults to the time package, and returns the limiter,
+// as in NewHierarchy(100).WithClock(clock).
+func (h *Hierarchy) WithClock(clock Clock) *Hierarchy {
+	h.setClock(clock)
+	return h
+}
+
+// setClock replaces the clock of the limiter, refilling all the classes.
+func (h *Hierarchy) setClock(clock Clock) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clock = clock
+	for _, c := range h.classes {
+		c.tokens, c.ctokens, c.lastTime = c.rate, c.ceil, clock.Now()
+	}
+}
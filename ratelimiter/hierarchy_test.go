@@ -0,0 +1,102 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHierarchy_Borrowing(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	h := NewHierarchy(20).WithClock(clock)
+	acme, err := h.Add("acme", "", 10, 10)
+	assert.NoError(t, err)
+	_, err = h.Add("alice", acme, 4, 10)
+	assert.NoError(t, err)
+	_, err = h.Add("bob", acme, 6, 10)
+	assert.NoError(t, err)
+
+	// alice borrows the rate bob leaves unused
+	assert.True(t, h.AllowN("acme/alice", 10))
+	assert.False(t, h.Allow("acme/alice"), "Expected alice to be limited by her ceiling")
+
+	// bob is guaranteed his rate, but cannot borrow from the exhausted tenant
+	assert.True(t, h.AllowN("acme/bob", 6))
+	assert.False(t, h.Allow("acme/bob"))
+
+	d, err := h.Decide("acme/alice", 1)
+	assert.NoError(t, err)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, 0, d.Remaining)
+	assert.Equal(t, 10, d.Limit)
+	assert.Equal(t, 700*time.Millisecond, d.RetryAfter, "Expected alice to wait for the tenant to lend")
+
+	clock.Advance(d.RetryAfter)
+	assert.True(t, h.Allow("acme/alice"))
+	assert.False(t, h.Allow("acme/alice"))
+
+	// a tenant borrows from the root up to its ceiling
+	_, err = h.Add("initech", "", 2, 5)
+	assert.NoError(t, err)
+	carol, err := h.Add("carol", "initech", 2, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, "initech/carol", carol)
+	assert.False(t, h.AllowN(carol, 6), "Expected the requests beyond the ceiling to be rejected")
+	d, err = h.Decide(carol, 5)
+	assert.NoError(t, err)
+	assert.True(t, d.Allowed)
+	// carol repays her debt to the tenant before being reset
+	assert.Equal(t, 2*time.Second, d.ResetAt.Sub(clock.Now()))
+}
+
+func TestHierarchy_Classes(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	h := NewHierarchy(20).WithClock(clock)
+	acme, err := h.Add("acme", "", 10, 10)
+	assert.NoError(t, err)
+	_, err = h.Add("bob", acme, 6, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, h.Len())
+
+	_, err = h.Add("dave", "umbrella", 1, 1)
+	assert.ErrorIs(t, err, ErrUnknownClass)
+	_, err = h.Add("bob", "acme", 1, 1)
+	assert.ErrorIs(t, err, ErrClassExists)
+	assert.Panics(t, func() { _, _ = h.Add("dave", "acme", 0, 1) })
+	assert.Panics(t, func() { _, _ = h.Add("dave", "acme", 2, 1) })
+	assert.Panics(t, func() { _, _ = h.Add("", "acme", 1, 1) })
+	assert.Panics(t, func() { _, _ = h.Add("dave/eve", "acme", 1, 1) })
+	assert.Panics(t, func() { NewHierarchy(0) })
+	assert.Panics(t, func() { NewHierarchy(1, 0) })
+
+	// the classes are named within their parent
+	bob, err := h.Add("bob", "", 1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", bob)
+	assert.True(t, h.Allow(bob))
+	assert.False(t, h.Allow(bob), "Expected the class to be distinct from acme/bob")
+	assert.True(t, h.Allow("acme/bob"))
+	assert.NoError(t, h.Remove(bob))
+	clock.Advance(time.Second)
+
+	assert.NoError(t, h.Remove("acme/bob"))
+	assert.Equal(t, 2, h.Len())
+	_, err = h.Add("bob", "acme", 1, 1)
+	assert.NoError(t, err, "Expected the name of a removed class to be available")
+
+	assert.NoError(t, h.Remove("acme"))
+	assert.Equal(t, 1, h.Len(), "Expected the descendants to be removed")
+	assert.ErrorIs(t, h.Remove("acme/bob"), ErrUnknownClass)
+	assert.ErrorIs(t, h.Remove(""), ErrRootClass)
+	assert.False(t, h.Allow("acme/bob"))
+	_, err = h.Decide("acme/bob", 1)
+	assert.ErrorIs(t, err, ErrUnknownClass)
+
+	d, err := h.Decide("", 20)
+	assert.NoError(t, err)
+	assert.True(t, d.Allowed)
+	d, err = h.Decide("", 21)
+	assert.NoError(t, err)
+	assert.Equal(t, InfDuration, d.RetryAfter)
+}
@@ -0,0 +1,276 @@
+package ratelimiter
+
+import (
+	"context"
+	"hash/maphash"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hedon954/devkit-go/cacheevict"
+)
+
+// Sharding of a KeyedLimiter.
+const (
+	keyedShardCapacity = 1024 // The minimum number of keys per shard
+	maxKeyedShards     = 64
+)
+
+// KeyedLimiter rate-limits requests per key, such as a user ID or an IP.
+// It lazily creates a limiter for each key from a factory, and bounds its memory
+// by evicting the least valuable keys once full, according to a cache eviction policy,
+// as well as the keys idle for longer than the idle TTL, if any.
+// A key whose limiter has been evicted starts over with a new limiter.
+//
+// The idle keys are swept every idle TTL by a goroutine running while keys are kept,
+// so they are freed within twice the idle TTL even if they are never used again.
+//
+// The keys of a large keyed limiter are spread over shards locked independently,
+// each one holding a share of the capacity and evicting its own keys.
+type KeyedLimiter[K comparable] struct {
+	factory func(K) Limiter
+	idleTTL time.Duration
+	clock   Clock
+	seed    maphash.Seed
+	shards  []*keyedShard[K]
+
+	keys     atomic.Int64 // The number of keys kept by the shards
+	mu       sync.Mutex
+	sweeping bool // Whether the goroutine sweeping the idle keys is running
+}
+
+// keyedShard holds the limiters of a share of the keys.
+type keyedShard[K comparable] struct {
+	mu      sync.Mutex
+	entries map[K]*keyedEntry
+	// cache orders the ids of the keys for eviction, its values are the keys
+	cache  cacheevict.Inspectable
+	nextID uint64
+}
+
+// keyedEntry is the limiter of a key.
+type keyedEntry struct {
+	id       string // The key of the entry in the cache of its shard
+	limiter  Limiter
+	lastUsed time.Time
+}
+
+type keyedBuilder[K comparable] struct {
+	factory  func(K) Limiter
+	policy   cacheevict.Policy
+	capacity int
+	idleTTL  time.Duration
+	clock    Clock
+}
+
+// KeyedBuilder returns a new builder for building a keyed limiter creating
+// the limiter of each key with the factory.
+func KeyedBuilder[K comparable](factory func(K) Limiter) *keyedBuilder[K] {
+	return &keyedBuilder[K]{factory: factory, policy: cacheevict.LRU}
+}
+
+// Policy sets the eviction policy of the keys once the capacity is reached, it defaults to LRU.
+func (b *keyedBuilder[K]) Policy(policy cacheevict.Policy) *keyedBuilder[K] {
+	b.policy = policy
+	return b
+}
+
+// Capacity sets the maximum number of keys whose limiters are kept.
+func (b *keyedBuilder[K]) Capacity(capacity int) *keyedBuilder[K] {
+	b.capacity = capacity
+	return b
+}
+
+// IdleTTL sets how long the limiter of a key is kept since its last use.
+// Idle keys start over when they are used again, and are swept within twice the idle TTL.
+func (b *keyedBuilder[K]) IdleTTL(idleTTL time.Duration) *keyedBuilder[K] {
+	b.idleTTL = idleTTL
+	return b
+}
+
+// Clock sets the clock measuring the idle TTL, it defaults to the time package.
+func (b *keyedBuilder[K]) Clock(clock Clock) *keyedBuilder[K] {
+	b.clock = clock
+	return b
+}
+
+// Build builds a new keyed limiter.
+func (b *keyedBuilder[K]) Build() *KeyedLimiter[K] {
+	if b.factory == nil || b.capacity <= 0 {
+		panic("unspecified factory or capacity")
+	}
+	clock := b.clock
+	if clock == nil {
+		clock = realClock{}
+	}
+	kl := &KeyedLimiter[K]{factory: b.factory, idleTTL: b.idleTTL, clock: clock, seed: maphash.MakeSeed()}
+
+	shards := min(max(b.capacity/keyedShardCapacity, 1), maxKeyedShards)
+	for i := range shards {
+		// the first shards hold the rest of the capacity
+		capacity := b.capacity / shards
+		if i < b.capacity%shards {
+			capacity++
+		}
+		s := &keyedShard[K]{
+			entries: make(map[K]*keyedEntry),
+			cache:   cacheevict.Builder().Policy(b.policy).Capacity(capacity).Build(),
+		}
+		// the events are delivered before Add returns, with the lock of the shard held
+		s.cache.SubscribeFunc(func(e cacheevict.Event) {
+			if e.Kind == cacheevict.EventEvict {
+				delete(s.entries, e.Value.(K))
+				kl.keys.Add(-1)
+			}
+		})
+		kl.shards = append(kl.shards, s)
+	}
+	return kl
+}
+
+// NewKeyedLimiter creates a new keyed limiter keeping the limiters of up to capacity keys,
+// evicting the least recently used ones. If an idle TTL is provided, the keys idle for longer are evicted.
+func NewKeyedLimiter[K comparable](capacity int, factory func(K) Limiter, idleTTL ...time.Duration) *KeyedLimiter[K] {
+	b := KeyedBuilder(factory).Capacity(capacity)
+	if len(idleTTL) > 0 {
+		b.IdleTTL(idleTTL[0])
+	}
+	return b.Build()
+}
+
+// Limiter returns the limiter of the key, creating it if needed.
+func (kl *KeyedLimiter[K]) Limiter(key K) Limiter {
+	s := kl.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := kl.clock.Now()
+	e, ok := s.entries[key]
+	switch {
+	case !ok:
+		s.nextID++
+		e = &keyedEntry{id: strconv.FormatUint(s.nextID, 36), limiter: kl.factory(key)}
+		s.entries[key] = e
+		kl.keys.Add(1)
+		s.cache.Add(e.id, key)
+		if kl.idleTTL > 0 {
+			kl.startSweeping()
+		}
+	case kl.idleTTL > 0 && now.Sub(e.lastUsed) >= kl.idleTTL:
+		e.limiter = kl.factory(key)
+		s.cache.Get(e.id)
+	default:
+		s.cache.Get(e.id) // the use counts for the eviction policy
+	}
+	e.lastUsed = now
+	return e.limiter
+}
+
+// startSweeping starts the goroutine sweeping the idle keys every idle TTL,
+// until no key is kept, unless it is running.
+func (kl *KeyedLimiter[K]) startSweeping() {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+	if kl.sweeping {
+		return
+	}
+	kl.sweeping = true
+
+	ticker := kl.clock.NewTicker(kl.idleTTL)
+	go func() {
+		defer ticker.Stop()
+		for range ticker.C() {
+			if !kl.sweep() {
+				return
+			}
+		}
+	}()
+}
+
+// sweep evicts the keys idle for longer than the idle TTL.
+// It reports whether keys are still kept, otherwise the sweeping stops.
+func (kl *KeyedLimiter[K]) sweep() bool {
+	now := kl.clock.Now()
+	for _, s := range kl.shards {
+		s.mu.Lock()
+		for key, e := range s.entries {
+			if now.Sub(e.lastUsed) >= kl.idleTTL {
+				delete(s.entries, key)
+				kl.keys.Add(-1)
+				s.cache.Remove(e.id)
+			}
+		}
+		s.mu.Unlock()
+	}
+
+	// the lock orders the stop after the keys added meanwhile, which start the sweeping again
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+	if kl.keys.Load() > 0 {
+		return true
+	}
+	kl.sweeping = false
+	return false
+}
+
+// shard returns the shard of the key.
+func (kl *KeyedLimiter[K]) shard(key K) *keyedShard[K] {
+	if len(kl.shards) == 1 {
+		return kl.shards[0]
+	}
+	return kl.shards[maphash.Comparable(kl.seed, key)%uint64(len(kl.shards))]
+}
+
+// Allow reports whether a request of the key may happen now.
+func (kl *KeyedLimiter[K]) Allow(key K) bool {
+	return kl.Limiter(key).Allow()
+}
+
+// AllowN reports whether n requests of the key may happen now.
+func (kl *KeyedLimiter[K]) AllowN(key K, n int) bool {
+	return kl.Limiter(key).AllowN(n)
+}
+
+// Wait blocks until a request of the key is allowed or the context is done.
+func (kl *KeyedLimiter[K]) Wait(ctx context.Context, key K) error {
+	return kl.Limiter(key).Wait(ctx)
+}
+
+// WaitN blocks until n requests of the key are allowed, see Limiter.WaitN.
+func (kl *KeyedLimiter[K]) WaitN(ctx context.Context, key K, n int) error {
+	return kl.Limiter(key).WaitN(ctx, n)
+}
+
+// Decide reports whether n requests of the key may happen now, see Limiter.Decide.
+func (kl *KeyedLimiter[K]) Decide(key K, n int) Decision {
+	return kl.Limiter(key).Decide(n)
+}
+
+// Remove forgets the limiter of the key and reports whether it was kept.
+func (kl *KeyedLimiter[K]) Remove(key K) bool {
+	s := kl.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok {
+		return false
+	}
+	delete(s.entries, key)
+	kl.keys.Add(-1)
+	s.cache.Remove(e.id)
+	return true
+}
+
+// Len returns the number of keys whose limiters are kept, including the idle ones
+// not swept yet.
+func (kl *KeyedLimiter[K]) Len() int {
+	n := 0
+	for _, s := range kl.shards {
+		s.mu.Lock()
+		n += len(s.entries)
+		s.mu.Unlock()
+	}
+	return n
+}
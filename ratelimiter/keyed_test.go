@@ -0,0 +1,119 @@
+package ratelimiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hedon954/devkit-go/cacheevict"
+)
+
+func TestKeyedLimiter(t *testing.T) {
+	created := map[int]int{}
+	kl := NewKeyedLimiter(2, func(key int) Limiter {
+		created[key]++
+		return NewFixedWindows(2, time.Hour)
+	})
+
+	// each key has its own limit
+	assert.True(t, kl.AllowN(1, 2))
+	assert.False(t, kl.Allow(1))
+	assert.True(t, kl.Allow(2))
+	assert.NoError(t, kl.Wait(context.Background(), 2))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.ErrorIs(t, kl.WaitN(ctx, 2, 1), ErrWaitExceedsDeadline)
+	assert.Equal(t, 2, kl.Len())
+	assert.Same(t, kl.Limiter(1), kl.Limiter(1))
+
+	// the least recently used key is evicted and starts over
+	assert.True(t, kl.Allow(3))
+	assert.Equal(t, 2, kl.Len())
+	assert.True(t, kl.Allow(2), "Expected the evicted key to start over")
+	assert.Equal(t, 2, created[2])
+	assert.Equal(t, 1, created[1])
+
+	assert.True(t, kl.Remove(3))
+	assert.False(t, kl.Remove(3))
+	assert.Equal(t, 1, kl.Len())
+}
+
+func TestKeyedLimiter_IdleTTL(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	created := 0
+	kl := KeyedBuilder(func(string) Limiter {
+		created++
+		return NewTokenBucket(1, 1, time.Hour).WithClock(clock)
+	}).Capacity(10).IdleTTL(50 * time.Millisecond).Clock(clock).Build()
+
+	assert.True(t, kl.Allow("user"))
+	clock.Advance(30 * time.Millisecond)
+	assert.False(t, kl.Allow("user"), "Expected the used key to be kept within the idle TTL")
+	clock.Advance(30 * time.Millisecond)
+	assert.False(t, kl.Allow("user"), "Expected the use to restart the idle TTL")
+	assert.Equal(t, 1, created)
+
+	clock.Advance(50 * time.Millisecond)
+	assert.True(t, kl.Allow("user"), "Expected the idle key to start over")
+	assert.Equal(t, 2, created)
+	assert.Equal(t, 1, kl.Len())
+}
+
+func TestKeyedLimiter_IdleKeysAreSwept(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	kl := KeyedBuilder(func(string) Limiter {
+		return NewTokenBucket(1, 1, time.Hour).WithClock(clock)
+	}).Capacity(10).IdleTTL(50 * time.Millisecond).Clock(clock).Build()
+
+	assert.True(t, kl.Allow("idle"))
+	assert.True(t, kl.Allow("busy"))
+	clock.BlockUntil(1)
+	clock.Advance(30 * time.Millisecond)
+	kl.Allow("busy")
+	clock.Advance(20 * time.Millisecond)
+	assert.Eventually(t, func() bool { return kl.Len() == 1 }, time.Second, time.Millisecond,
+		"Expected the idle key to be swept without being used")
+
+	clock.Advance(50 * time.Millisecond)
+	assert.Eventually(t, func() bool { return kl.Len() == 0 }, time.Second, time.Millisecond)
+
+	// the sweeping starts again with the next key
+	assert.True(t, kl.Allow("idle"), "Expected the swept key to start over")
+	clock.BlockUntil(1)
+	clock.Advance(50 * time.Millisecond)
+	assert.Eventually(t, func() bool { return kl.Len() == 0 }, time.Second, time.Millisecond)
+}
+
+func TestKeyedLimiter_Keys(t *testing.T) {
+	// keys formatted alike are distinct
+	kl := NewKeyedLimiter(10, func(any) Limiter { return NewFixedWindows(1, time.Hour) })
+	assert.True(t, kl.Allow(1))
+	assert.True(t, kl.Allow("1"))
+	assert.False(t, kl.Allow(1))
+
+	// the keys of a large limiter are spread over shards sharing the capacity
+	capacity := 4*keyedShardCapacity + 3
+	sharded := NewKeyedLimiter(capacity, func(int) Limiter { return NewFixedWindows(1, time.Hour) })
+	assert.Len(t, sharded.shards, 4)
+	assert.Equal(t, keyedShardCapacity+1, sharded.shards[0].cache.Stats().Capacity)
+	assert.Equal(t, keyedShardCapacity, sharded.shards[3].cache.Stats().Capacity)
+	for i := range 2 * capacity {
+		assert.True(t, sharded.Allow(i))
+	}
+	assert.LessOrEqual(t, sharded.Len(), capacity)
+	for _, s := range sharded.shards {
+		assert.Equal(t, s.cache.Len(), len(s.entries), "Expected the evicted keys to be forgotten")
+	}
+}
+
+func TestKeyedBuilder(t *testing.T) {
+	kl := KeyedBuilder(func(string) Limiter { return New(AlgorithmTokenBucket, 1) }).
+		Policy(cacheevict.LFU).Capacity(5).Build()
+	assert.IsType(t, &cacheevict.LFUCache{}, kl.shards[0].cache)
+	assert.IsType(t, &cacheevict.LRUCache{}, NewKeyedLimiter(1, kl.factory).shards[0].cache)
+
+	assert.Panics(t, func() { KeyedBuilder[string](nil).Capacity(5).Build() })
+	assert.Panics(t, func() { NewKeyedLimiter(0, kl.factory) })
+}
@@ -1,20 +1,39 @@
 package ratelimiter
 
 import (
+	"context"
+	"errors"
 	"sync"
 	"time"
 )
 
+// ErrLimiterClosed is returned by Wait once the limiter is closed.
+var ErrLimiterClosed = errors.New("limiter closed")
+
 // LeakyBucket represents a rate limiter using the leaky bucket algorithm.
 // It controls the rate at which requests are allowed, ensuring they do not exceed the specified rate and capacity.
+// Requests are queued in the bucket and leak out at each interval,
+// so Allow and AllowN block until the requests leak out.
+//
+// By default, a goroutine leaks the queued requests at each interval. It only runs while
+// requests are queued, and stops for good once the bucket is closed. In virtual scheduling
+// mode, there is neither queue nor goroutine: the bucket computes the time each request
+// leaks out at, and the callers sleep until then.
 type LeakyBucket struct {
 	mu           sync.Mutex         // Mutex to protect shared state (currentLevel) across multiple goroutines
 	rate         int                // The maximum number of requests allowed per interval
 	capacity     int                // The maximum number of requests the bucket can hold at any given time
 	currentLevel int                // The current number of requests in the bucket
 	interval     time.Duration      // The time interval at which the bucket leaks requests
+	startTime    time.Time          // The time the bucket started leaking, the leaks happen every interval after it
 	queue        chan chan struct{} // A channel of channels to manage request notifications and their order
-	notifyPool   sync.Pool          // A pool to reuse channels, reducing the overhead of creating new channels frequently
+	clock        Clock              // The clock telling the time and ticking the leaks
+	done         chan struct{}      // Closed once the bucket is closed
+	stop         chan struct{}      // Closed to stop the leaking goroutine, nil if it is not running
+
+	virtual   bool      // Whether the requests are scheduled instead of queued
+	lastSlot  time.Time // The time the last scheduled request leaks out, in virtual scheduling mode
+	lastCount int       // The number of scheduled requests leaking out at lastSlot
 }
 
 // NewLeakyBucket creates a new LeakyBucket instance with a specified rate, capacity, and optional interval.
@@ -27,11 +46,8 @@ func NewLeakyBucket(rate, capacity int, interval ...time.Duration) *LeakyBucket
 		currentLevel: 0,
 		interval:     time.Second,                        // Default interval to 1 second if not specified
 		queue:        make(chan chan struct{}, capacity), // Buffered channel to handle up to 'capacity' requests
-		notifyPool: sync.Pool{
-			New: func() interface{} {
-				return make(chan struct{}) // Create a new channel when needed
-			},
-		},
+		clock:        realClock{},
+		done:         make(chan struct{}),
 	}
 
 	// Override the default interval if provided
@@ -39,61 +55,413 @@ func NewLeakyBucket(rate, capacity int, interval ...time.Duration) *LeakyBucket
 		l.interval = interval[0]
 	}
 
-	// Start the goroutine that will leak requests at a fixed rate
-	go l.start()
+	return l
+}
+
+type leakyBucketBuilder struct {
+	rate     int
+	capacity int
+	interval time.Duration
+	clock    Clock
+	virtual  bool
+	ctx      context.Context
+}
+
+// LeakyBucketBuilder returns a new builder for building a leaky bucket allowing 'rate' requests
+// per interval and holding up to 'capacity' requests.
+func LeakyBucketBuilder(rate, capacity int) *leakyBucketBuilder {
+	return &leakyBucketBuilder{rate: rate, capacity: capacity, interval: time.Second}
+}
 
+// Interval sets the interval at which the bucket leaks requests, it defaults to 1 second.
+func (b *leakyBucketBuilder) Interval(interval time.Duration) *leakyBucketBuilder {
+	b.interval = interval
+	return b
+}
+
+// Clock sets the clock of the bucket, it defaults to the time package.
+func (b *leakyBucketBuilder) Clock(clock Clock) *leakyBucketBuilder {
+	b.clock = clock
+	return b
+}
+
+// Virtual makes the bucket schedule the requests at the time they leak out,
+// without queue nor goroutine.
+func (b *leakyBucketBuilder) Virtual() *leakyBucketBuilder {
+	b.virtual = true
+	return b
+}
+
+// Context binds the bucket to the context, closing it once the context is done.
+func (b *leakyBucketBuilder) Context(ctx context.Context) *leakyBucketBuilder {
+	b.ctx = ctx
+	return b
+}
+
+// Build builds the leaky bucket.
+func (b *leakyBucketBuilder) Build() *LeakyBucket {
+	if b.rate <= 0 || b.capacity <= 0 || b.interval <= 0 {
+		panic("rate, capacity and interval must be greater than 0")
+	}
+	l := NewLeakyBucket(b.rate, b.capacity, b.interval)
+	if b.clock != nil {
+		l.clock = b.clock
+	}
+	if b.virtual {
+		l.virtual = true
+		l.queue = nil
+	}
+	if b.ctx != nil {
+		context.AfterFunc(b.ctx, l.Close)
+	}
 	return l
 }
 
-// start begins a goroutine that regularly leaks requests from the bucket at the defined interval and rate.
-func (l *LeakyBucket) start() {
-	ticker := time.NewTicker(l.interval)
-	for range ticker.C {
-		for i := 0; i < l.rate; i++ {
-			notify, ok := <-l.queue
-			if !ok {
-				break
+// start starts the goroutine that will leak requests at a fixed rate, from now,
+// until no request is queued. It must be called with the lock held.
+func (l *LeakyBucket) start(now time.Time) {
+	ticker := l.clock.NewTicker(l.interval)
+	stop := make(chan struct{})
+	l.startTime = now
+	l.stop = stop
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C():
+				if !l.release(stop) {
+					return
+				}
+			case <-stop:
+				return
+			case <-l.done:
+				return
 			}
-			notify <- struct{}{}
 		}
+	}()
+}
+
+// release notifies up to rate queued requests that they leaked out.
+// It reports whether the goroutine of the stop channel must keep leaking,
+// which it does while requests are queued, unless it has been replaced.
+func (l *LeakyBucket) release(stop chan struct{}) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.stop != stop {
+		return false
+	}
+	for i := 0; i < l.rate && l.currentLevel > 0; i++ {
+		notify := <-l.queue
+		notify <- struct{}{} // buffered, the request may have stopped waiting
+		l.currentLevel--
+	}
+	if l.currentLevel == 0 {
+		l.stop = nil
+		return false
+	}
+	return true
+}
+
+// Close stops the bucket: the requests are rejected from now on, and the callers
+// blocked in Allow and Wait return. Closing a bucket more than once does nothing.
+func (l *LeakyBucket) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.closed() {
+		close(l.done)
+	}
+}
+
+// closed reports whether the bucket is closed.
+func (l *LeakyBucket) closed() bool {
+	select {
+	case <-l.done:
+		return true
+	default:
+		return false
 	}
 }
 
 // Allow checks if a new request is allowed under the current rate and capacity constraints.
-// It returns true if the request is allowed, and false otherwise.
+// It blocks until the request leaks out and returns true, or returns false if the bucket is full.
 func (l *LeakyBucket) Allow() bool {
-	if !l.try() {
+	return l.AllowN(1)
+}
+
+// AllowN checks if 'n' new requests are allowed under the current rate and capacity constraints.
+// It blocks until the requests leak out and returns true, or returns false if the bucket is full
+// or closed before they leak out. It panics if n is negative.
+func (l *LeakyBucket) AllowN(n int) bool {
+	now := l.clock.Now()
+	r, notify := l.enqueue(now, n, InfDuration)
+	if !r.OK() {
 		return false
 	}
+	return l.await(context.Background(), now, r, notify) == nil
+}
 
-	ok := l.notifyPool.Get().(chan struct{})
-	l.queue <- ok
+// Schedule queues 'n' new requests without waiting for them to leak out, and returns how long
+// the caller must wait before they do, it is the non-blocking variant of AllowN.
+// It returns false if the bucket cannot hold them.
+func (l *LeakyBucket) Schedule(n int) (time.Duration, bool) {
+	now := l.clock.Now()
+	r, _ := l.enqueue(now, n, InfDuration)
+	return r.DelayFrom(now), r.OK()
+}
 
-	<-ok
-	l.leak()
-	l.notifyPool.Put(ok)
+// Wait blocks until a new request leaks out or the context is done.
+// It returns ErrLimitExceeded if the bucket is full.
+func (l *LeakyBucket) Wait(ctx context.Context) error {
+	return l.WaitN(ctx, 1)
+}
 
-	return true
+// WaitN blocks until 'n' new requests leak out.
+// It returns an error if the bucket is full or closed, the context is done,
+// or the requests would leak out after the context deadline.
+func (l *LeakyBucket) WaitN(ctx context.Context, n int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	now := l.clock.Now()
+	r, notify := l.enqueue(now, n, untilDeadline(ctx))
+	if err := r.err(); err != nil {
+		if l.closed() {
+			return ErrLimiterClosed
+		}
+		return err
+	}
+	return l.await(ctx, now, r, notify)
+}
+
+// await blocks until the queued requests leak out, their notifications being received
+// on notify, or until their scheduled time in virtual scheduling mode.
+func (l *LeakyBucket) await(ctx context.Context, now time.Time, r *Reservation, notify chan struct{}) error {
+	if l.virtual {
+		delay := r.DelayFrom(now)
+		if delay == 0 {
+			return nil
+		}
+		timer := l.clock.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C():
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-l.done:
+			return ErrLimiterClosed
+		}
+	}
+
+	for i := 0; i < r.tokens; i++ {
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-l.done:
+			return ErrLimiterClosed
+		}
+	}
+	return nil
+}
+
+// Reserve queues a new request without waiting for it to leak out,
+// the reservation delay is the time it is expected to leak out.
+func (l *LeakyBucket) Reserve() *Reservation {
+	return l.ReserveN(1)
+}
+
+// ReserveN queues 'n' new requests without waiting for them to leak out,
+// the reservation delay is the time they are expected to leak out.
+// The reservation is not OK if the bucket cannot hold them.
+// Queued requests cannot be taken back, so canceling the reservation does nothing.
+func (l *LeakyBucket) ReserveN(n int) *Reservation {
+	r, _ := l.enqueue(l.clock.Now(), n, InfDuration)
+	return r
 }
 
-// try attempts to increment the bucket's current level and checks if the request can be accommodated.
-// It returns true if the request is accepted, false if the bucket is full.
-func (l *LeakyBucket) try() bool {
+// enqueue queues 'n' requests if the bucket can hold them and they are expected
+// to leak out within maxWait. It returns the reservation and the channel
+// notified once for each request leaking out, nil if they are not queued
+// or in virtual scheduling mode.
+func (l *LeakyBucket) enqueue(now time.Time, n int, maxWait time.Duration) (*Reservation, chan struct{}) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	if l.currentLevel >= l.capacity {
-		return false
+	return l.push(now, n, maxWait)
+}
+
+// push is enqueue with the lock held.
+// It panics if n is negative, as a negative number of requests cannot be queued.
+func (l *LeakyBucket) push(now time.Time, n int, maxWait time.Duration) (*Reservation, chan struct{}) {
+	if n < 0 {
+		panic("n must not be negative")
 	}
-	l.currentLevel++
-	return true
+	level := l.level(now)
+	if level+n > l.capacity || l.rate <= 0 || l.closed() {
+		return &Reservation{}, nil
+	}
+	if level == 0 && n > 0 {
+		// the bucket starts leaking from now
+		if l.virtual {
+			l.startTime = now
+		} else {
+			l.start(now)
+		}
+	}
+
+	// the last request leaks out at the tick releasing its position in the queue
+	ticks := (level + n + l.rate - 1) / l.rate
+	timeToAct := l.nextTick(now).Add(time.Duration(ticks-1) * l.interval)
+	if timeToAct.Sub(now) > maxWait {
+		return &Reservation{timeToAct: timeToAct}, nil
+	}
+	r := &Reservation{ok: true, tokens: n, timeToAct: timeToAct, clock: l.clock}
+
+	if l.virtual {
+		l.lastSlot = timeToAct
+		l.lastCount = level + n - (ticks-1)*l.rate
+		return r, nil
+	}
+	l.currentLevel += n
+	notify := make(chan struct{}, n)
+	for i := 0; i < n; i++ {
+		l.queue <- notify
+	}
+	return r, notify
 }
 
-// leak decreases the current number of requests in the bucket by one.
-// This is called after a request has been processed and space in the bucket is freed.
-func (l *LeakyBucket) leak() {
+// level returns the number of requests in the bucket at now.
+// In virtual scheduling mode, they are the scheduled requests not leaked out yet:
+// they fill the ticks up to the last slot, 'rate' requests at each one.
+// It must be called with the lock held.
+func (l *LeakyBucket) level(now time.Time) int {
+	if !l.virtual {
+		return l.currentLevel
+	}
+	if !l.lastSlot.After(now) {
+		return 0
+	}
+	return int(l.lastSlot.Sub(l.nextTick(now))/l.interval)*l.rate + l.lastCount
+}
+
+// SetLimit changes the number of requests leaking out at each interval.
+// The requests in the bucket leak out at the new rate from the next tick.
+func (l *LeakyBucket) SetLimit(limit int) {
+	if limit <= 0 {
+		panic("limit must be greater than 0")
+	}
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	if l.currentLevel > 0 {
-		l.currentLevel--
+	now := l.clock.Now()
+	level := l.level(now)
+	l.rate = limit
+	l.reschedule(now, level)
+}
+
+// SetBurst changes the number of requests the bucket can hold.
+// The requests in excess stay in the bucket until they leak out.
+func (l *LeakyBucket) SetBurst(burst int) {
+	if burst <= 0 {
+		panic("burst must be greater than 0")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.capacity = burst
+	if l.virtual || cap(l.queue) == max(burst, len(l.queue)) {
+		return
+	}
+	queue := make(chan chan struct{}, max(burst, len(l.queue)))
+	for len(l.queue) > 0 {
+		queue <- <-l.queue
+	}
+	l.queue = queue
+}
+
+// SetInterval changes the interval at which the bucket leaks requests.
+// The ticks restart from now, the next leak happening one new interval later.
+func (l *LeakyBucket) SetInterval(interval time.Duration) {
+	if interval <= 0 {
+		panic("interval must be greater than 0")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	level := l.level(now)
+	l.interval = interval
+	if l.stop != nil {
+		close(l.stop)
+		l.start(now)
 	}
+	l.startTime = now
+	l.reschedule(now, level)
+}
+
+// reschedule schedules again the requests in the bucket, in virtual scheduling mode,
+// once the rate or the interval has changed: they fill the next ticks, 'rate' at each one.
+// It must be called with the lock held.
+func (l *LeakyBucket) reschedule(now time.Time, level int) {
+	if !l.virtual || level == 0 {
+		return
+	}
+	ticks := (level + l.rate - 1) / l.rate
+	l.lastSlot = l.nextTick(now).Add(time.Duration(ticks-1) * l.interval)
+	l.lastCount = level - (ticks-1)*l.rate
+}
+
+// Burst returns the number of requests the bucket can hold.
+func (l *LeakyBucket) Burst() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.capacity
+}
+
+// WithClock sets the clock of the limiter, which defaults to the time package, and returns the limiter,
+// as in NewLeakyBucket(10, 5).WithClock(clock). It must be called before any request is queued.
+func (l *LeakyBucket) WithClock(clock Clock) *LeakyBucket {
+	l.setClock(clock)
+	return l
+}
+
+// setClock replaces the clock of the limiter, which must not have started leaking.
+func (l *LeakyBucket) setClock(clock Clock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.clock = clock
+}
+
+// Decide reports whether the bucket can hold 'n' requests, queuing them if so, along with
+// the room remaining in the bucket. Unlike Allow, it does not wait for the requests to leak out:
+// the bucket meters the requests, which may happen at once, and RetryAfter tells when
+// enough queued requests have leaked out to make room for them.
+func (l *LeakyBucket) Decide(n int) Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	r, _ := l.push(now, n, InfDuration)
+	if !r.OK() && n <= l.capacity && l.rate > 0 && !l.closed() {
+		// the queued requests in excess leak out at the next ticks
+		ticks := (l.level(now) + n - l.capacity + l.rate - 1) / l.rate
+		r.timeToAct = l.nextTick(now).Add(time.Duration(ticks-1) * l.interval)
+	}
+	return newDecision(now, r, l.quota(now))
+}
+
+// quota returns the quota of the bucket, the requests leaving it as they leak out.
+// It must be called with the lock held.
+func (l *LeakyBucket) quota(now time.Time) quota {
+	level := l.level(now)
+	q := quota{limit: l.capacity, remaining: max(l.capacity-level, 0), resetAt: now}
+	if level > 0 && l.rate > 0 {
+		ticks := (level + l.rate - 1) / l.rate
+		q.resetAt = l.nextTick(now).Add(time.Duration(ticks-1) * l.interval)
+	}
+	return q
+}
+
+// nextTick returns the time of the first leak after now.
+func (l *LeakyBucket) nextTick(now time.Time) time.Time {
+	ticks := now.Sub(l.startTime)/l.interval + 1
+	return l.startTime.Add(ticks * l.interval)
 }
@@ -1,7 +1,7 @@
 package ratelimiter
 
 import (
-	"math"
+	"context"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -13,13 +13,12 @@ func TestLeakyBucket_RateLimiting(t *testing.T) {
 	rate := 5                          // Allows 5 requests per second
 	capacity := 10                     // Bucket capacity is 10
 	interval := 200 * time.Millisecond // Leaks once every 200ms
-	bucket := NewLeakyBucket(rate, capacity, interval)
+	clock := NewFakeClock(time.Now())
+	bucket := NewLeakyBucket(rate, capacity, interval).WithClock(clock)
 
 	var wg sync.WaitGroup
 	var processed atomic.Int64
 
-	start := time.Now()
-
 	// Simulate request rate
 	for i := 0; i < 10; i++ {
 		wg.Add(1)
@@ -32,13 +31,28 @@ func TestLeakyBucket_RateLimiting(t *testing.T) {
 			}
 		}()
 	}
+	waitFor(t, func() bool { return len(bucket.queue) == capacity })
 
+	// each interval leaks 'rate' requests
+	clock.Advance(interval)
+	waitFor(t, func() bool { return processed.Load() == int64(rate) })
+	clock.Advance(interval)
 	wg.Wait()
-	elapsed := time.Since(start)
 
-	if math.Abs(float64(elapsed.Milliseconds()-10/int64(rate)*interval.Milliseconds())) > 5 {
-		t.Errorf("Expected process %dms, got %dms, out of 5ms diff",
-			10/int64(rate)*interval.Milliseconds(), elapsed.Milliseconds())
+	if processed.Load() != 10 {
+		t.Errorf("Expected 10 requests processed after 2 intervals, got %d", processed.Load())
+	}
+}
+
+// waitFor waits for the condition to be satisfied by the goroutines under test.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Condition not satisfied within 1s")
+		}
+		time.Sleep(time.Millisecond)
 	}
 }
 
@@ -108,3 +122,294 @@ func TestLeakyBucket_RequestRejection(t *testing.T) {
 		t.Errorf("Rejected requests did not match expected: got %d, want %d", rejected.Load(), expectedRejected)
 	}
 }
+
+func TestLeakyBucket_AllowN(t *testing.T) {
+	interval := 20 * time.Millisecond
+	clock := NewFakeClock(time.Now())
+	bucket := NewLeakyBucket(2, 4, interval).WithClock(clock)
+
+	done := make(chan bool)
+	go func() { done <- bucket.AllowN(3) }()
+	clock.BlockUntil(1)
+	clock.Advance(interval)
+	select {
+	case <-done:
+		t.Fatal("Expected 3 requests not to leak out after 1 interval")
+	case <-time.After(10 * time.Millisecond):
+	}
+	clock.Advance(interval)
+	if !<-done {
+		t.Fatal("Expected 3 requests to leak out after 2 intervals")
+	}
+
+	if bucket.AllowN(5) {
+		t.Error("Expected more requests than the capacity to be rejected")
+	}
+	if !bucket.AllowN(0) {
+		t.Error("Expected 0 requests to be allowed")
+	}
+	if !panics(func() { bucket.AllowN(-1) }) {
+		t.Error("Expected a negative number of requests to panic")
+	}
+}
+
+func TestLeakyBucket_Reserve(t *testing.T) {
+	interval := 50 * time.Millisecond
+	clock := NewFakeClock(time.Now())
+	bucket := NewLeakyBucket(1, 3, interval).WithClock(clock)
+
+	var delays []time.Duration
+	for i := 0; i < 3; i++ {
+		delays = append(delays, bucket.Reserve().Delay())
+	}
+	if r := bucket.Reserve(); r.OK() {
+		t.Error("Expected the reservation to be rejected when the bucket is full")
+	}
+	for i := 1; i < 3; i++ {
+		if diff := delays[i] - delays[i-1]; diff != interval {
+			t.Errorf("Expected the requests to leak out one interval apart, got %v", delays)
+		}
+	}
+
+	// the reserved requests leak out without waiters
+	for level := 2; level >= 0; level-- {
+		clock.Advance(interval)
+		waitFor(t, func() bool { return bucketLevel(bucket) == level })
+	}
+	if r := bucket.ReserveN(3); !r.OK() {
+		t.Error("Expected the bucket to have room")
+	}
+}
+
+func TestLeakyBucket_WaitN(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	bucket := NewLeakyBucket(1, 2, 50*time.Millisecond).WithClock(clock)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := bucket.WaitN(ctx, 1); err != ErrWaitExceedsDeadline {
+		t.Errorf("Expected %v, got %v", ErrWaitExceedsDeadline, err)
+	}
+	if err := bucket.WaitN(context.Background(), 3); err != ErrLimitExceeded {
+		t.Errorf("Expected %v when the bucket cannot hold the requests, got %v", ErrLimitExceeded, err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		clock.BlockUntil(2) // the leak ticker and the timer of the wait
+		cancel()
+	}()
+	if err := bucket.WaitN(ctx, 2); err != context.Canceled {
+		t.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+
+	// the requests of the canceled wait stay in the bucket until they leak out
+	if err := bucket.WaitN(context.Background(), 1); err != ErrLimitExceeded {
+		t.Errorf("Expected %v, got %v", ErrLimitExceeded, err)
+	}
+	for level := 1; level >= 0; level-- {
+		clock.Advance(50 * time.Millisecond)
+		waitFor(t, func() bool { return bucketLevel(bucket) == level })
+	}
+	if r := bucket.ReserveN(2); !r.OK() {
+		t.Error("Expected the bucket to have room")
+	}
+}
+
+// waiters returns the number of timers and tickers waiting for the clock.
+func waiters(c *FakeClock) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+func TestLeakyBucket_Close(t *testing.T) {
+	interval := 100 * time.Millisecond
+	clock := NewFakeClock(time.Now())
+	bucket := LeakyBucketBuilder(1, 3).Interval(interval).Clock(clock).Build()
+
+	// the leaking goroutine stops ticking once the queued requests leaked out
+	if _, ok := bucket.Schedule(1); !ok {
+		t.Fatal("Expected the request to be queued")
+	}
+	clock.BlockUntil(1)
+	clock.Advance(interval)
+	waitFor(t, func() bool { return waiters(clock) == 0 })
+
+	allowed := make(chan bool)
+	go func() { allowed <- bucket.AllowN(2) }()
+	waitFor(t, func() bool { return len(bucket.queue) == 2 })
+	errs := make(chan error)
+	go func() { errs <- bucket.Wait(context.Background()) }()
+	waitFor(t, func() bool { return len(bucket.queue) == 3 })
+
+	bucket.Close()
+	bucket.Close()
+	if <-allowed {
+		t.Error("Expected the requests blocked in Allow to be rejected once the bucket is closed")
+	}
+	if err := <-errs; err != ErrLimiterClosed {
+		t.Errorf("Expected %v, got %v", ErrLimiterClosed, err)
+	}
+	waitFor(t, func() bool { return waiters(clock) == 0 })
+
+	clock.Advance(10 * interval)
+	if err := bucket.Wait(context.Background()); err != ErrLimiterClosed {
+		t.Errorf("Expected %v, got %v", ErrLimiterClosed, err)
+	}
+	if _, ok := bucket.Schedule(1); ok {
+		t.Error("Expected the requests to be rejected once the bucket is closed")
+	}
+	if d := bucket.Decide(1); d.Allowed || d.RetryAfter != InfDuration {
+		t.Errorf("Expected the requests to never be allowed once the bucket is closed, got %+v", d)
+	}
+}
+
+func TestLeakyBucket_Context(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	bucket := LeakyBucketBuilder(1, 1).Interval(time.Hour).Context(ctx).Build()
+
+	errs := make(chan error)
+	go func() { errs <- bucket.Wait(context.Background()) }()
+	waitFor(t, func() bool { return len(bucket.queue) == 1 })
+	cancel()
+	if err := <-errs; err != ErrLimiterClosed {
+		t.Errorf("Expected %v once the context is done, got %v", ErrLimiterClosed, err)
+	}
+
+	if r := bucket.Reserve(); r.OK() {
+		t.Error("Expected the requests to be rejected once the context is done")
+	}
+	if !panics(func() { LeakyBucketBuilder(1, 0).Build() }) {
+		t.Error("Expected a bucket without capacity to panic")
+	}
+}
+
+// panics reports whether f panics.
+func panics(f func()) (panicked bool) {
+	defer func() { panicked = recover() != nil }()
+	f()
+	return false
+}
+
+func TestLeakyBucket_Virtual(t *testing.T) {
+	interval := 100 * time.Millisecond
+	clock := NewFakeClock(time.Now())
+	bucket := LeakyBucketBuilder(2, 4).Interval(interval).Clock(clock).Virtual().Build()
+
+	// the requests are scheduled at the ticks, 'rate' at each one
+	for i, want := range []time.Duration{interval, interval, 2 * interval, 2 * interval} {
+		if delay, ok := bucket.Schedule(1); !ok || delay != want {
+			t.Errorf("Expected request %d to be scheduled in %v, got %v, %v", i, want, delay, ok)
+		}
+	}
+	if _, ok := bucket.Schedule(1); ok {
+		t.Error("Expected the requests to be rejected once the bucket is full")
+	}
+
+	// the first tick leaks two requests
+	clock.Advance(interval)
+	if delay, ok := bucket.Schedule(2); !ok || delay != 2*interval {
+		t.Errorf("Expected the requests to be scheduled in %v, got %v, %v", 2*interval, delay, ok)
+	}
+	if d := bucket.Decide(1); d.Allowed || d.RetryAfter != interval || d.Remaining != 0 {
+		t.Errorf("Expected the bucket to have room after a tick, got %+v", d)
+	}
+
+	// Allow sleeps until the requests are scheduled, without goroutine leaking them
+	clock.Advance(2 * interval)
+	allowed := make(chan bool)
+	go func() { allowed <- bucket.AllowN(3) }()
+	clock.BlockUntil(1)
+	clock.Advance(interval)
+	select {
+	case <-allowed:
+		t.Fatal("Expected the last request to leak out at the second tick")
+	default:
+	}
+	clock.Advance(interval)
+	if !<-allowed {
+		t.Error("Expected the requests to be allowed")
+	}
+
+	bucket.Close()
+	if bucket.AllowN(1) {
+		t.Error("Expected the requests to be rejected once the bucket is closed")
+	}
+}
+
+// TestLeakyBucket_VirtualMatchesQueue checks that the virtual scheduling schedules the requests
+// at the time they leak out of the queue.
+func TestLeakyBucket_VirtualMatchesQueue(t *testing.T) {
+	interval := 100 * time.Millisecond
+	clock := NewFakeClock(time.Now())
+	queued := LeakyBucketBuilder(3, 7).Interval(interval).Clock(clock).Build()
+	virtual := LeakyBucketBuilder(3, 7).Interval(interval).Clock(clock).Virtual().Build()
+	defer queued.Close()
+
+	for i, step := range []struct {
+		advance time.Duration
+		n       int
+	}{
+		{0, 2}, {0, 4}, {0, 2}, {interval / 2, 1}, {interval / 2, 3},
+		{interval / 4, 2}, {3 * interval, 1}, {interval / 2, 7}, {interval, 1},
+	} {
+		// a tick at a time, the ticks being dropped while the queue is leaking
+		for advanced := time.Duration(0); advanced < step.advance; advanced += interval / 4 {
+			clock.Advance(interval / 4)
+			waitFor(t, func() bool { return bucketLevel(queued) == bucketLevel(virtual) })
+		}
+		wantDelay, wantOK := queued.Schedule(step.n)
+		if delay, ok := virtual.Schedule(step.n); delay != wantDelay || ok != wantOK {
+			t.Errorf("Step %d: expected %v, %v like the queue, got %v, %v", i, wantDelay, wantOK, delay, ok)
+		}
+	}
+}
+
+// bucketLevel returns the number of requests in the bucket.
+func bucketLevel(l *LeakyBucket) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.level(l.clock.Now())
+}
+
+func TestLeakyBucket_Reconfigure(t *testing.T) {
+	interval := 100 * time.Millisecond
+	clock := NewFakeClock(time.Now())
+	bucket := LeakyBucketBuilder(2, 4).Interval(interval).Clock(clock).Virtual().Build()
+
+	for i := 0; i < 4; i++ {
+		bucket.Schedule(1)
+	}
+	// the scheduled requests leak out at the new rate
+	bucket.SetLimit(4)
+	bucket.SetBurst(6)
+	if delay, ok := bucket.Schedule(1); !ok || delay != 2*interval {
+		t.Errorf("Expected the request to be scheduled in %v, got %v, %v", 2*interval, delay, ok)
+	}
+	bucket.SetInterval(time.Second)
+	if _, ok := bucket.Schedule(2); ok {
+		t.Error("Expected the requests beyond the capacity to be rejected")
+	}
+	bucket.SetBurst(8)
+	if delay, ok := bucket.Schedule(3); !ok || delay != 2*time.Second {
+		t.Errorf("Expected the requests to be scheduled in %v, got %v, %v", 2*time.Second, delay, ok)
+	}
+
+	// the leaking goroutine restarts at the new interval
+	queued := LeakyBucketBuilder(1, 1).Interval(time.Hour).Clock(clock).Build()
+	defer queued.Close()
+	queued.Schedule(1)
+	queued.SetInterval(time.Minute)
+	waitFor(t, func() bool { return waiters(clock) == 1 })
+	clock.Advance(time.Minute)
+	waitFor(t, func() bool { return bucketLevel(queued) == 0 && waiters(clock) == 0 })
+
+	queued.SetBurst(3)
+	if _, ok := queued.Schedule(3); !ok {
+		t.Error("Expected the queue to hold the new capacity")
+	}
+	if !panics(func() { queued.SetLimit(0) }) {
+		t.Error("Expected a zero rate to panic")
+	}
+}
@@ -0,0 +1,173 @@
+package ratelimiter
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The rate limit headers of the IETF draft "RateLimit header fields for HTTP".
+const (
+	HeaderRateLimitLimit     = "RateLimit-Limit"
+	HeaderRateLimitRemaining = "RateLimit-Remaining"
+	HeaderRateLimitReset     = "RateLimit-Reset"
+	HeaderRetryAfter         = "Retry-After"
+)
+
+// KeyFunc extracts the key a request is rate-limited by.
+type KeyFunc func(r *http.Request) string
+
+// KeyByIP keys the requests by the IP of the client connection.
+// The forwarding headers are ignored, since they can be forged by the clients,
+// use KeyByHeader behind a trusted proxy.
+func KeyByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// KeyByPath keys the requests by their URL path.
+func KeyByPath(r *http.Request) string {
+	return r.URL.Path
+}
+
+// KeyByHeader keys the requests by the value of the given header.
+func KeyByHeader(name string) KeyFunc {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// route is the limiter of the requests whose path matches a pattern.
+type route struct {
+	pattern string
+	limiter func(key string) Limiter
+}
+
+// match reports whether the path matches the pattern of the route,
+// exactly or by prefix if the pattern ends with a slash.
+func (r route) match(path string) bool {
+	if strings.HasSuffix(r.pattern, "/") {
+		return strings.HasPrefix(path, r.pattern)
+	}
+	return path == r.pattern
+}
+
+type middlewareBuilder struct {
+	key       KeyFunc
+	limiter   func(key string) Limiter
+	routes    []route
+	onLimited http.Handler
+}
+
+// MiddlewareBuilder returns a new builder for building an HTTP middleware,
+// rejecting the requests exceeding the limit of their key with 429 Too Many Requests.
+// The requests are decided with Limiter.Decide, so none of them waits for the limiter.
+func MiddlewareBuilder() *middlewareBuilder {
+	return &middlewareBuilder{key: KeyByIP}
+}
+
+// Key sets how the key of the requests is extracted, it defaults to KeyByIP.
+func (b *middlewareBuilder) Key(key KeyFunc) *middlewareBuilder {
+	b.key = key
+	return b
+}
+
+// Limiter sets the limiter of the requests matching no route, given their key.
+// It is typically the Limiter method of a KeyedLimiter, or returns a shared limiter.
+// If not set, the requests matching no route are not limited.
+func (b *middlewareBuilder) Limiter(limiter func(key string) Limiter) *middlewareBuilder {
+	b.limiter = limiter
+	return b
+}
+
+// Route sets the limiter of the requests whose path matches the pattern, given their key.
+// A pattern ending with a slash matches the paths it prefixes, others match exactly.
+// The longest matching pattern wins.
+func (b *middlewareBuilder) Route(pattern string, limiter func(key string) Limiter) *middlewareBuilder {
+	b.routes = append(b.routes, route{pattern: pattern, limiter: limiter})
+	return b
+}
+
+// OnLimited sets the handler of the rejected requests, after the headers are set.
+// It defaults to replying 429 Too Many Requests.
+func (b *middlewareBuilder) OnLimited(handler http.Handler) *middlewareBuilder {
+	b.onLimited = handler
+	return b
+}
+
+// Build builds the middleware.
+func (b *middlewareBuilder) Build() func(http.Handler) http.Handler {
+	if b.key == nil {
+		panic("unspecified key")
+	}
+	routes := append([]route(nil), b.routes...)
+	sort.SliceStable(routes, func(i, j int) bool {
+		return len(routes[i].pattern) > len(routes[j].pattern)
+	})
+	onLimited := b.onLimited
+	if onLimited == nil {
+		onLimited = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		})
+	}
+
+	m := &middleware{key: b.key, limiter: b.limiter, routes: routes, onLimited: onLimited}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			m.serve(w, r, next)
+		})
+	}
+}
+
+type middleware struct {
+	key       KeyFunc
+	limiter   func(key string) Limiter
+	routes    []route
+	onLimited http.Handler
+}
+
+// serve passes the request to next if the limiter of its route allows it,
+// reporting the decision of the limiter in the headers.
+func (m *middleware) serve(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	limiterOf := m.limiter
+	for _, route := range m.routes {
+		if route.match(r.URL.Path) {
+			limiterOf = route.limiter
+			break
+		}
+	}
+	if limiterOf == nil {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	d := limiterOf(m.key(r)).Decide(1)
+	writeDecision(w.Header(), &d)
+	if !d.Allowed {
+		m.onLimited.ServeHTTP(w, r)
+		return
+	}
+	next.ServeHTTP(w, r)
+}
+
+// writeDecision sets the rate limit headers of the decision, and Retry-After if the request is rejected.
+func writeDecision(h http.Header, d *Decision) {
+	h.Set(HeaderRateLimitLimit, strconv.Itoa(d.Limit))
+	h.Set(HeaderRateLimitRemaining, strconv.Itoa(d.Remaining))
+	h.Set(HeaderRateLimitReset, seconds(d.ResetAt.Sub(d.now)))
+	if !d.Allowed && d.RetryAfter != InfDuration {
+		h.Set(HeaderRetryAfter, seconds(d.RetryAfter))
+	}
+}
+
+// seconds formats the duration in whole seconds, rounded up.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(max(d, 0).Seconds())))
+}
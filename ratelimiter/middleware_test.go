@@ -0,0 +1,93 @@
+package ratelimiter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	perKey := NewKeyedLimiter(10, func(string) Limiter {
+		return Builder().Algorithm(AlgorithmFixedWindows).Limit(2).Interval(time.Minute).Clock(clock).Build()
+	})
+	login := Builder().Algorithm(AlgorithmTokenBucket).Limit(1).Interval(10 * time.Second).Clock(clock).Build()
+
+	handler := MiddlewareBuilder().
+		Key(KeyByHeader("X-User")).
+		Limiter(perKey.Limiter).
+		Route("/login", func(string) Limiter { return login }).
+		Route("/public/", nil).
+		Build()(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	serve := func(path, user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-User", user)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve("/", "alice")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get(HeaderRateLimitLimit))
+	assert.Equal(t, "1", rec.Header().Get(HeaderRateLimitRemaining))
+	assert.Equal(t, "60", rec.Header().Get(HeaderRateLimitReset))
+	assert.Empty(t, rec.Header().Get(HeaderRetryAfter))
+
+	clock.Advance(15 * time.Second)
+	assert.Equal(t, http.StatusNoContent, serve("/", "alice").Code)
+	rec = serve("/", "alice")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "0", rec.Header().Get(HeaderRateLimitRemaining))
+	assert.Equal(t, "45", rec.Header().Get(HeaderRetryAfter))
+	assert.Equal(t, http.StatusNoContent, serve("/", "bob").Code, "Expected each key to have its own limit")
+
+	// the routes have their own limits, the longest pattern wins
+	assert.Equal(t, http.StatusNoContent, serve("/login", "bob").Code)
+	rec = serve("/login", "carol")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "5", rec.Header().Get(HeaderRetryAfter))
+	assert.Equal(t, http.StatusTooManyRequests, serve("/login/", "alice").Code, "Expected /login/ to use the default limit")
+	for i := 0; i < 5; i++ {
+		rec = serve("/public/index.html", "alice")
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Empty(t, rec.Header().Get(HeaderRateLimitLimit))
+	}
+}
+
+func TestMiddleware_OnLimited(t *testing.T) {
+	l := New(AlgorithmSlidingWindowLog, 1, time.Minute)
+	handler := MiddlewareBuilder().
+		Limiter(func(string) Limiter { return l }).
+		OnLimited(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		})).
+		Build()(http.NotFoundHandler())
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "60", rec.Header().Get(HeaderRetryAfter))
+
+	assert.Panics(t, func() { MiddlewareBuilder().Key(nil).Build() })
+}
+
+func TestKeyFuncs(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("X-Api-Key", "secret")
+	assert.Equal(t, "192.0.2.1", KeyByIP(req))
+	assert.Equal(t, "/users/1", KeyByPath(req))
+	assert.Equal(t, "secret", KeyByHeader("X-Api-Key")(req))
+
+	req.RemoteAddr = "pipe"
+	assert.Equal(t, "pipe", KeyByIP(req))
+}
@@ -0,0 +1,240 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// member is implemented by the limiters a Multi combines,
+// which can take back the requests they allowed.
+type member interface {
+	Limiter
+	reserver
+	// decide is Decide at now, also returning the reservation of the allowed requests.
+	decide(now time.Time, n int) (*Reservation, Decision)
+	// refund takes back the requests of the reservation, whenever it acts.
+	refund(r *Reservation)
+	Burst() int
+	currentClock() Clock
+	setClock(clock Clock)
+}
+
+// Multi is a limiter enforcing several limits at once, such as 10 requests per second
+// and 500 per minute. Requests are only counted by its limiters if all of them allow them:
+// the ones counted by the first limiters are taken back when a later one rejects them.
+//
+// The combined limiters must share the same clock, which is the clock of the Multi
+// and can be replaced by WithClock.
+// Only token buckets, fixed windows, sliding windows (log and count), GCRA and other Multis
+// can be combined, NewMulti rejects the leaky buckets, whose queued requests leak out anyway,
+// and the warm-up buckets, whose cold rate cannot be taken back.
+// The limiters of a class or a key, such as Hierarchy, PriorityLimiter and KeyedLimiter,
+// are not Limiters and cannot be combined either.
+type Multi struct {
+	mu       sync.Mutex // Serializes the requests, so that they do not roll each other back
+	limiters []member
+	clock    Clock
+}
+
+// NewMulti creates a new limiter allowing requests once all the limiters allow them.
+// It panics if no limiter is provided, if a limiter cannot be combined,
+// or if the limiters do not share the same clock.
+func NewMulti(limiters ...Limiter) *Multi {
+	if len(limiters) == 0 {
+		panic("no limiter to combine")
+	}
+	m := &Multi{limiters: make([]member, 0, len(limiters))}
+	for _, l := range limiters {
+		ml, ok := l.(member)
+		if !ok {
+			panic("limiter cannot be combined, its requests cannot be taken back")
+		}
+		m.limiters = append(m.limiters, ml)
+	}
+	m.clock = m.limiters[0].currentClock()
+	for _, l := range m.limiters[1:] {
+		if l.currentClock() != m.clock {
+			panic("limiters do not share the same clock")
+		}
+	}
+	return m
+}
+
+// Allow checks if a single request is allowed by all the limiters.
+func (m *Multi) Allow() bool {
+	return m.AllowN(1)
+}
+
+// AllowN checks if 'n' requests are allowed by all the limiters, counting them if so.
+func (m *Multi) AllowN(n int) bool {
+	return m.reserveN(m.clock.Now(), n, 0).OK()
+}
+
+// Wait blocks until a single request is allowed or the context is done.
+func (m *Multi) Wait(ctx context.Context) error {
+	return m.WaitN(ctx, 1)
+}
+
+// WaitN blocks until 'n' requests are allowed by all the limiters.
+// It returns an error if a limiter can never allow them, the context is done,
+// or the wait would exceed the context deadline.
+func (m *Multi) WaitN(ctx context.Context, n int) error {
+	return waitN(ctx, m.clock, m, n)
+}
+
+// Reserve reserves a single request in all the limiters.
+func (m *Multi) Reserve() *Reservation {
+	return m.ReserveN(1)
+}
+
+// ReserveN reserves 'n' requests in all the limiters, the reservation delay being the longest one.
+// The reservation is not OK if a limiter can never allow them.
+func (m *Multi) ReserveN(n int) *Reservation {
+	return m.reserveN(m.clock.Now(), n, InfDuration)
+}
+
+// reserveN reserves 'n' requests in each limiter within maxWait,
+// taking back the ones already reserved if a limiter rejects them.
+func (m *Multi) reserveN(now time.Time, n int, maxWait time.Duration) *Reservation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	parts := make([]*Reservation, 0, len(m.limiters))
+	timeToAct := now
+	for _, l := range m.limiters {
+		r := l.reserveN(now, n, maxWait)
+		if !r.OK() {
+			m.rollback(parts)
+			return &Reservation{timeToAct: r.timeToAct}
+		}
+		parts = append(parts, r)
+		if r.timeToAct.After(timeToAct) {
+			timeToAct = r.timeToAct
+		}
+	}
+	return &Reservation{ok: true, tokens: n, timeToAct: timeToAct, limiter: m, clock: m.clock, parts: parts}
+}
+
+// cancel cancels the reservations of the limiters, the ones whose time to act has passed staying counted.
+func (m *Multi) cancel(r *Reservation, now time.Time) {
+	if r.tokens == 0 {
+		return
+	}
+	r.tokens = 0
+	for _, p := range r.parts {
+		p.CancelAt(now)
+	}
+}
+
+// refund takes back the requests of the reservation from all the limiters.
+func (m *Multi) refund(r *Reservation) {
+	if r.tokens == 0 {
+		return
+	}
+	r.tokens = 0
+	m.rollback(r.parts)
+}
+
+// rollback takes back the reservations of the first limiters.
+func (m *Multi) rollback(parts []*Reservation) {
+	for i, p := range parts {
+		m.limiters[i].refund(p)
+	}
+}
+
+// Decide reports whether 'n' requests are allowed by all the limiters, counting them if so.
+// The decision reports the remaining quota of the most restrictive limiter, the latest time
+// all the limiters are reset, and the longest delay before the rejected requests are allowed.
+func (m *Multi) Decide(n int) Decision {
+	_, d := m.decide(m.clock.Now(), n)
+	return d
+}
+
+// decide is Decide at now, also returning the reservation of the allowed requests.
+// Every limiter decides, so that the longest delay is known, the requests being taken back
+// from the limiters allowing them if another one does not.
+func (m *Multi) decide(now time.Time, n int) (*Reservation, Decision) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	parts := make([]*Reservation, len(m.limiters))
+	decisions := make([]Decision, len(m.limiters))
+	allowed := true
+	for i, l := range m.limiters {
+		parts[i], decisions[i] = l.decide(now, n)
+		allowed = allowed && decisions[i].Allowed
+	}
+	if allowed {
+		r := &Reservation{ok: true, tokens: n, timeToAct: now, limiter: m, clock: m.clock, parts: parts}
+		return r, combineDecisions(now, decisions)
+	}
+	for i, l := range m.limiters {
+		if decisions[i].Allowed {
+			l.refund(parts[i])
+			decisions[i].Remaining = min(decisions[i].Remaining+n, decisions[i].Limit)
+		}
+	}
+	return &Reservation{}, combineDecisions(now, decisions)
+}
+
+// combineDecisions returns the decision made at now by all the limiters.
+func combineDecisions(now time.Time, decisions []Decision) Decision {
+	d := Decision{Allowed: true, now: now}
+	for i := range decisions {
+		p := &decisions[i]
+		if !p.Allowed {
+			d.Allowed = false
+			d.RetryAfter = max(d.RetryAfter, p.RetryAfter)
+		}
+		if p.ResetAt.After(d.ResetAt) {
+			d.ResetAt = p.ResetAt
+		}
+		if i == 0 || p.Remaining < d.Remaining {
+			d.Remaining, d.Limit = p.Remaining, p.Limit
+		}
+	}
+	return d
+}
+
+// Limiters returns the combined limiters, whose limits can be changed through Reconfigurable.
+func (m *Multi) Limiters() []Limiter {
+	limiters := make([]Limiter, len(m.limiters))
+	for i, l := range m.limiters {
+		limiters[i] = l
+	}
+	return limiters
+}
+
+// Burst returns the smallest burst of the limiters, the most requests they all allow at once.
+func (m *Multi) Burst() int {
+	burst := m.limiters[0].Burst()
+	for _, l := range m.limiters[1:] {
+		burst = min(burst, l.Burst())
+	}
+	return burst
+}
+
+// WithClock sets the clock of the limiter and of the combined limiters, starting them over,
+// and returns the limiter, as in NewMulti(perSecond, perMinute).WithClock(clock).
+func (m *Multi) WithClock(clock Clock) *Multi {
+	m.setClock(clock)
+	return m
+}
+
+// setClock replaces the clock of the limiter and of the combined limiters.
+func (m *Multi) setClock(clock Clock) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clock = clock
+	for _, l := range m.limiters {
+		l.setClock(clock)
+	}
+}
+
+// currentClock returns the clock of the limiter.
+func (m *Multi) currentClock() Clock {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.clock
+}
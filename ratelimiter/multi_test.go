@@ -0,0 +1,84 @@
+package ratelimiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMulti(t *testing.T) {
+	start := time.Now()
+	clock := NewFakeClock(start)
+	perMinute := NewSlidingWindowLog(3, time.Minute)
+	perSecond := NewFixedWindows(2, time.Second)
+	m := NewMulti(perMinute, perSecond).WithClock(clock)
+
+	assert.True(t, m.AllowN(2))
+	assert.False(t, m.Allow())
+	assert.Len(t, perMinute.logs, 2, "Expected the requests rejected by a limiter to be taken back from the others")
+
+	clock.Advance(time.Second + time.Nanosecond)
+	assert.True(t, m.Allow())
+	assert.False(t, m.Allow())
+	assert.Equal(t, 1, perSecond.count)
+
+	d := m.Decide(1)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, 59*time.Second-time.Nanosecond, d.RetryAfter)
+	assert.Equal(t, 0, d.Remaining)
+	assert.Equal(t, 3, d.Limit)
+	assert.Equal(t, start.Add(61*time.Second+time.Nanosecond), d.ResetAt, "Expected the latest reset")
+	assert.Equal(t, 1, perSecond.count)
+
+	assert.Equal(t, []Limiter{perMinute, perSecond}, m.Limiters())
+	assert.Panics(t, func() { NewMulti() })
+	assert.Panics(t, func() { NewMulti(perSecond, NewLeakyBucket(1, 1)) })
+	assert.Panics(t, func() { NewMulti(perSecond, NewWarmUpBucket(1, time.Second)) })
+	assert.Panics(t, func() { NewMulti(perSecond, NewTokenBucket(1, 1)) }, "Expected limiters with different clocks not to be combined")
+}
+
+func TestMulti_Rollback(t *testing.T) {
+	for _, algorithm := range []Algorithm{
+		AlgorithmTokenBucket,
+		AlgorithmFixedWindows,
+		AlgorithmSlidingWindowLog,
+		AlgorithmSlidingWindowCount,
+		AlgorithmGCRA,
+	} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			clock := NewFakeClock(time.Now())
+			l := Builder().Algorithm(algorithm).Limit(2).Interval(time.Second).Clock(clock).Build()
+			full := NewFixedWindows(1, time.Hour).WithClock(clock)
+			m := NewMulti(l, NewMulti(full))
+			assert.True(t, full.Allow())
+
+			for i := 0; i < 3; i++ {
+				assert.False(t, m.Allow())
+				assert.False(t, m.Decide(1).Allowed)
+			}
+			d := l.Decide(2)
+			assert.True(t, d.Allowed, "Expected the rejected requests not to be counted")
+		})
+	}
+}
+
+func TestMulti_Reserve(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	tb := NewTokenBucket(1, 1, time.Second).WithClock(clock)
+	fw := NewFixedWindows(1, 2*time.Second).WithClock(clock)
+	m := NewMulti(tb, fw)
+
+	assert.Equal(t, time.Duration(0), m.Reserve().Delay())
+	r := m.Reserve()
+	assert.Equal(t, 2*time.Second, r.Delay(), "Expected the longest delay")
+	r.Cancel()
+	assert.Equal(t, 2*time.Second, m.Reserve().Delay(), "Expected the canceled requests to be taken back")
+
+	assert.False(t, m.ReserveN(2).OK())
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.ErrorIs(t, m.Wait(ctx), ErrWaitExceedsDeadline)
+	assert.ErrorIs(t, m.WaitN(context.Background(), 2), ErrLimitExceeded)
+}
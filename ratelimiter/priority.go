@@ -0,0 +1,267 @@
+package ratelimiter
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// priorityFractionsTolerance is the rounding error tolerated on the sum of the fractions of the classes.
+const priorityFractionsTolerance = 1e-9
+
+// Priority is the priority of a request, 0 being the most important.
+type Priority int
+
+// Pressure reports how saturated a resource is, from 0 when idle to 1 when saturated.
+type Pressure interface {
+	Pressure() float64
+}
+
+// PressureFunc is a function reporting the pressure of a resource.
+type PressureFunc func() float64
+
+// Pressure returns f().
+func (f PressureFunc) Pressure() float64 {
+	return f()
+}
+
+// LimiterPressure returns the pressure of a reference limiter, the fraction of its limit in use.
+func LimiterPressure(l Limiter) Pressure {
+	return PressureFunc(func() float64 {
+		d := l.Decide(0)
+		if d.Limit <= 0 {
+			return 1
+		}
+		return min(max(1-float64(d.Remaining)/float64(d.Limit), 0), 1)
+	})
+}
+
+// PriorityLimiter is a limiter reserving a fraction of its limit to each priority class,
+// which sheds the least important requests first under overload, such as the batch and
+// prefetch requests before the critical user requests.
+//
+// Each class has a bucket of its fraction of the limit, refilled continuously.
+// A request takes the tokens of its class, and borrows the tokens of the less important
+// classes once they are spent, starting from the least important one, so the important
+// requests may use the whole limit while the less important ones are kept within their share.
+// When a pressure is set, the requests of a class are also shed while the pressure is at
+// least the shedding threshold of the class, such as when a reference limiter or an adaptive
+// limiter is saturated.
+type PriorityLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration // The interval the limit is allowed in
+	classes  []*priorityClass
+	pressure Pressure
+	lastTime time.Time // The time the buckets were last refilled
+	clock    Clock
+}
+
+// priorityClass is the bucket of a priority class.
+type priorityClass struct {
+	capacity float64 // The requests reserved to the class per interval, and the capacity of its bucket
+	tokens   float64
+	shedAt   float64 // The pressure from which the requests of the class are shed
+}
+
+type priorityBuilder struct {
+	limit     int
+	interval  time.Duration
+	fractions []float64
+	shedAt    []float64
+	pressure  Pressure
+	clock     Clock
+}
+
+// PriorityBuilder returns a new builder for building a priority limiter allowing 'limit' requests per interval.
+func PriorityBuilder(limit int) *priorityBuilder {
+	return &priorityBuilder{limit: limit, interval: time.Second}
+}
+
+// Interval sets the interval of the limit, it defaults to 1 second.
+func (b *priorityBuilder) Interval(interval time.Duration) *priorityBuilder {
+	b.interval = interval
+	return b
+}
+
+// Class adds a class reserved the fraction of the limit, whose requests are shed from the pressure
+// 'shedAt'. The classes are added from the most important to the least important,
+// and their fractions must add up to 1.
+func (b *priorityBuilder) Class(fraction, shedAt float64) *priorityBuilder {
+	b.fractions = append(b.fractions, fraction)
+	b.shedAt = append(b.shedAt, shedAt)
+	return b
+}
+
+// Pressure sets the pressure from which the requests are shed, they are not shed without one.
+func (b *priorityBuilder) Pressure(pressure Pressure) *priorityBuilder {
+	b.pressure = pressure
+	return b
+}
+
+// Clock sets the clock of the limiter, it defaults to the time package.
+func (b *priorityBuilder) Clock(clock Clock) *priorityBuilder {
+	b.clock = clock
+	return b
+}
+
+// Build builds a new priority limiter.
+func (b *priorityBuilder) Build() *PriorityLimiter {
+	if b.limit <= 0 || b.interval <= 0 || len(b.fractions) == 0 {
+		panic("unspecified limit, interval or classes")
+	}
+	var sum float64
+	for _, fraction := range b.fractions {
+		if fraction <= 0 {
+			panic("fractions must be greater than 0")
+		}
+		sum += fraction
+	}
+	if math.Abs(sum-1) > priorityFractionsTolerance {
+		panic("fractions must add up to 1")
+	}
+
+	l := &PriorityLimiter{interval: b.interval, pressure: b.pressure, clock: b.clock}
+	if l.clock == nil {
+		l.clock = realClock{}
+	}
+	for i, fraction := range b.fractions {
+		capacity := fraction * float64(b.limit)
+		l.classes = append(l.classes, &priorityClass{capacity: capacity, tokens: capacity, shedAt: b.shedAt[i]})
+	}
+	l.lastTime = l.clock.Now()
+	return l
+}
+
+// NewPriorityLimiter creates a new priority limiter allowing 'limit' requests per second,
+// reserving the fractions of the limit to the classes, from the most important to the least important.
+// It does not shed requests under pressure.
+func NewPriorityLimiter(limit int, fractions ...float64) *PriorityLimiter {
+	b := PriorityBuilder(limit)
+	for _, fraction := range fractions {
+		b.Class(fraction, math.Inf(1))
+	}
+	return b.Build()
+}
+
+// Allow checks if a single request of the priority is allowed now.
+func (l *PriorityLimiter) Allow(p Priority) bool {
+	return l.AllowN(p, 1)
+}
+
+// AllowN checks if 'n' requests of the priority are allowed now, counting them if so.
+func (l *PriorityLimiter) AllowN(p Priority, n int) bool {
+	return l.Decide(p, n).Allowed
+}
+
+// Decide reports whether 'n' requests of the priority are allowed now, counting them if so,
+// along with the requests the priority may still make now, borrowing included.
+// The requests shed under pressure are told to retry after an interval.
+// The priorities having no class, such as the ones of the requests of unknown origin,
+// are the least important class.
+func (l *PriorityLimiter) Decide(p Priority, n int) Decision {
+	if p < 0 || int(p) >= len(l.classes) {
+		p = Priority(len(l.classes) - 1)
+	}
+	// the pressure is read before taking the lock, as it may come from another limiter
+	shed := l.pressure != nil && l.pressure.Pressure() >= l.classes[p].shedAt
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	l.refill(now)
+
+	// the class borrows from the less important classes, the least important first
+	own, lower := l.classes[p], l.classes[p+1:]
+	borrowed := append([]*priorityClass{own}, lower...)
+	slices.Reverse(borrowed[1:])
+
+	d := Decision{now: now}
+	var available float64
+	for _, c := range borrowed {
+		available += c.tokens
+		d.Limit += int(math.Round(c.capacity))
+	}
+	switch {
+	case shed:
+		d.RetryAfter = l.interval
+	case available >= float64(n):
+		d.Allowed = true
+		takeTokens(borrowed, float64(n))
+	default:
+		d.RetryAfter = l.refillTime(borrowed, float64(n))
+	}
+
+	d.Remaining = int(available)
+	if d.Allowed {
+		d.Remaining = int(available - float64(n))
+	}
+	d.ResetAt = now.Add(l.refillTime(borrowed, math.Inf(1)))
+	return d
+}
+
+// takeTokens takes 'n' tokens from the classes in order.
+func takeTokens(classes []*priorityClass, n float64) {
+	for _, c := range classes {
+		taken := min(c.tokens, n)
+		c.tokens -= taken
+		n -= taken
+	}
+}
+
+// refillTime returns how long until the classes hold 'n' tokens, InfDuration if they never do.
+// Passing an infinite number of tokens returns how long until the classes are full.
+func (l *PriorityLimiter) refillTime(classes []*priorityClass, n float64) time.Duration {
+	var tokens, rate float64
+	for _, c := range classes {
+		tokens += c.tokens
+		rate += c.capacity
+	}
+	if math.IsInf(n, 1) {
+		n = rate
+	}
+	if n > rate+priorityFractionsTolerance {
+		return InfDuration
+	}
+
+	// the classes refill at the sum of their rates, which drops as they are full
+	byFill := slices.Clone(classes)
+	slices.SortFunc(byFill, func(a, b *priorityClass) int { return cmp.Compare(a.fillTime(), b.fillTime()) })
+	var elapsed float64
+	for _, c := range byFill {
+		refilled := (c.fillTime() - elapsed) * rate
+		if tokens+refilled >= n {
+			break
+		}
+		tokens += refilled
+		elapsed = c.fillTime()
+		rate -= c.capacity
+	}
+	if tokens < n && rate > 0 {
+		elapsed += (n - tokens) / rate
+	}
+	return time.Duration(math.Ceil(elapsed * float64(l.interval)))
+}
+
+// fillTime returns the number of intervals until the bucket of the class is full.
+func (c *priorityClass) fillTime() float64 {
+	return (c.capacity - c.tokens) / c.capacity
+}
+
+// refill refills the buckets of the classes up to now.
+func (l *PriorityLimiter) refill(now time.Time) {
+	elapsed := float64(now.Sub(l.lastTime)) / float64(l.interval)
+	if elapsed <= 0 {
+		return
+	}
+	for _, c := range l.classes {
+		c.tokens = min(c.tokens+elapsed*c.capacity, c.capacity)
+	}
+	l.lastTime = now
+}
+
+// Classes returns the number of priority classes.
+func (l *PriorityLimiter) Classes() int {
+	return len(l.classes)
+}
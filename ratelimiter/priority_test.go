@@ -0,0 +1,118 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	critical Priority = iota
+	normal
+	batch
+)
+
+func TestPriorityLimiter_Borrowing(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	l := PriorityBuilder(8).Class(0.5, 1).Class(0.25, 1).Class(0.25, 1).Clock(clock).Build()
+	assert.Equal(t, 3, l.Classes())
+
+	// the batch requests are kept within their share
+	d := l.Decide(batch, 3)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, 2, d.Remaining)
+	assert.Equal(t, 2, d.Limit)
+	assert.Equal(t, InfDuration, d.RetryAfter)
+
+	// the critical requests borrow from the least important class first
+	assert.True(t, l.AllowN(critical, 5))
+	assert.False(t, l.AllowN(batch, 2))
+	d = l.Decide(normal, 3)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 0, d.Remaining)
+	assert.Equal(t, 4, d.Limit)
+
+	d = l.Decide(batch, 1)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, 500*time.Millisecond, d.RetryAfter)
+	d = l.Decide(critical, 1)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, 8, d.Limit)
+	assert.Equal(t, 125*time.Millisecond, d.RetryAfter, "Expected the critical requests to borrow the refilled tokens")
+	assert.Equal(t, time.Second, d.ResetAt.Sub(clock.Now()))
+
+	clock.Advance(d.RetryAfter)
+	assert.True(t, l.Allow(critical))
+	assert.False(t, l.Allow(critical))
+
+	// the classes full first stop refilling the others
+	clock.Advance(time.Second)
+	assert.True(t, l.AllowN(critical, 4))
+	d = l.Decide(critical, 6)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, 4, d.Remaining)
+	assert.Equal(t, 500*time.Millisecond, d.RetryAfter)
+}
+
+func TestPriorityLimiter_Shedding(t *testing.T) {
+	load := 0.0
+	l := PriorityBuilder(10).
+		Class(0.5, 1).
+		Class(0.3, 0.9).
+		Class(0.2, 0.7).
+		Pressure(PressureFunc(func() float64 { return load })).
+		Build()
+	assert.True(t, l.Allow(batch))
+
+	load = 0.8
+	d := l.Decide(batch, 1)
+	assert.False(t, d.Allowed, "Expected the batch requests to be shed first")
+	assert.Equal(t, time.Second, d.RetryAfter)
+	assert.Equal(t, 1, d.Remaining)
+	assert.True(t, l.Allow(normal))
+
+	load = 1
+	assert.False(t, l.Allow(normal))
+	assert.False(t, l.Allow(critical))
+
+	load = 0.5
+	assert.True(t, l.Allow(batch))
+}
+
+func TestPriorityLimiter_Pressure(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	tb := Builder().Algorithm(AlgorithmTokenBucket).Limit(4).Clock(clock).Build()
+	p := LimiterPressure(tb)
+	assert.Equal(t, 0.0, p.Pressure())
+	assert.True(t, tb.AllowN(3))
+	assert.Equal(t, 0.75, p.Pressure())
+
+	a := AdaptiveBuilder(NewAIMD(time.Second)).InitialLimit(4).Build()
+	for range 2 {
+		a.Acquire()
+	}
+	assert.Equal(t, 0.5, a.Pressure())
+	l := PriorityBuilder(10).Class(0.5, 1).Class(0.5, 0.5).Pressure(a).Build()
+	assert.True(t, l.Allow(0))
+	assert.False(t, l.Allow(1))
+}
+
+func TestPriorityLimiter_Build(t *testing.T) {
+	assert.Panics(t, func() { NewPriorityLimiter(10) })
+	assert.Panics(t, func() { NewPriorityLimiter(0, 1) })
+	assert.Panics(t, func() { NewPriorityLimiter(10, 0.5, 0.4) })
+	assert.Panics(t, func() { NewPriorityLimiter(10, 1.5, -0.5) })
+	assert.NotPanics(t, func() { NewPriorityLimiter(10, 0.7, 0.2, 0.1) })
+}
+
+func TestPriorityLimiter_UnknownPriority(t *testing.T) {
+	l := NewPriorityLimiter(8, 0.5, 0.25, 0.25)
+	for _, p := range []Priority{batch + 1, -1} {
+		d := l.Decide(p, 3)
+		assert.False(t, d.Allowed, "Expected the priority without class to be the least important one")
+		assert.Equal(t, 2, d.Limit)
+	}
+	assert.True(t, l.AllowN(batch+1, 2))
+	assert.False(t, l.Allow(batch), "Expected the requests to count against the least important class")
+}
@@ -0,0 +1,142 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+)
+
+// InfDuration is the duration returned by Delay when a Reservation is not OK.
+const InfDuration = time.Duration(math.MaxInt64)
+
+// ErrLimitExceeded is returned by Wait when the request can never be allowed,
+// because it exceeds the capacity of the limiter.
+var ErrLimitExceeded = errors.New("rate limit exceeded")
+
+// ErrWaitExceedsDeadline is returned by Wait when the request would be allowed
+// after the deadline of the context.
+var ErrWaitExceedsDeadline = errors.New("wait would exceed context deadline")
+
+// Reservation holds information about requests that are permitted by a limiter after a delay.
+type Reservation struct {
+	ok bool
+	// tokens is the number of reserved tokens, zero once canceled.
+	tokens int
+	// timeToAct is the time the requests are permitted,
+	// also set when they are rejected for being permitted too late.
+	timeToAct time.Time
+	// limiter is the limiter the tokens are returned to on cancellation, if any.
+	limiter canceler
+	// clock is the clock of the limiter.
+	clock Clock
+	// parts are the reservations of the limiters combined by a Multi.
+	parts []*Reservation
+}
+
+// OK reports whether the limiter can provide the requested number of tokens.
+// If OK is false, Delay returns InfDuration.
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// Delay returns how long the caller must wait before acting.
+// Zero means act immediately.
+func (r *Reservation) Delay() time.Duration {
+	return r.DelayFrom(r.now())
+}
+
+// DelayFrom returns how long the caller must wait before acting, from the given time.
+func (r *Reservation) DelayFrom(now time.Time) time.Duration {
+	if !r.ok {
+		return InfDuration
+	}
+	return max(r.timeToAct.Sub(now), 0)
+}
+
+// Cancel indicates that the reservation holder will not perform the reserved action
+// and returns the tokens to the limiter, as far as possible without affecting
+// the reservations made after it.
+// It does nothing if the reservation is not OK, already canceled,
+// or if its time to act has passed.
+func (r *Reservation) Cancel() {
+	r.CancelAt(r.now())
+}
+
+// now returns the current time of the clock of the limiter.
+func (r *Reservation) now() time.Time {
+	if r.clock == nil {
+		return time.Now()
+	}
+	return r.clock.Now()
+}
+
+// CancelAt is like Cancel, at the given time.
+func (r *Reservation) CancelAt(now time.Time) {
+	if !r.ok || r.limiter == nil {
+		return
+	}
+	r.limiter.cancel(r, now)
+}
+
+// reserver is implemented by the limiters computing when requests may happen.
+type reserver interface {
+	// reserveN reserves n tokens at now if they are available within maxWait.
+	reserveN(now time.Time, n int, maxWait time.Duration) *Reservation
+}
+
+// canceler is implemented by the limiters able to take back reserved tokens.
+type canceler interface {
+	// cancel returns the tokens of the reservation if it has not acted yet at now,
+	// under the lock of the limiter. It marks the reservation as canceled by
+	// zeroing its tokens, and does nothing if it has already been canceled.
+	cancel(r *Reservation, now time.Time)
+}
+
+// waitN reserves n tokens and sleeps until they are available.
+// The tokens are only reserved if they are available before the deadline of the context.
+func waitN(ctx context.Context, clock Clock, l reserver, n int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	now := clock.Now()
+	r := l.reserveN(now, n, untilDeadline(ctx))
+	if err := r.err(); err != nil {
+		return err
+	}
+	delay := r.DelayFrom(now)
+	if delay == 0 {
+		return nil
+	}
+
+	timer := clock.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		r.Cancel()
+		return ctx.Err()
+	}
+}
+
+// untilDeadline returns how long the requests may wait before the deadline of the context.
+// The deadline is always measured with the time package, whatever the clock of the limiter.
+func untilDeadline(ctx context.Context) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok {
+		return time.Until(deadline)
+	}
+	return InfDuration
+}
+
+// err returns the reason why the reservation is not OK, if so.
+func (r *Reservation) err() error {
+	switch {
+	case r.ok:
+		return nil
+	case r.timeToAct.IsZero():
+		return ErrLimitExceeded
+	default:
+		return ErrWaitExceedsDeadline
+	}
+}
@@ -0,0 +1,69 @@
+package ratelimiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReservation(t *testing.T) {
+	now := time.Now()
+
+	r := &Reservation{}
+	assert.False(t, r.OK())
+	assert.Equal(t, InfDuration, r.Delay())
+
+	r = &Reservation{ok: true, tokens: 1, timeToAct: now.Add(time.Second)}
+	assert.True(t, r.OK())
+	assert.Equal(t, time.Second, r.DelayFrom(now))
+	assert.Equal(t, time.Duration(0), r.DelayFrom(now.Add(2*time.Second)))
+}
+
+func TestWaitN(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	l := NewTokenBucket(1, 2, 50*time.Millisecond).WithClock(clock)
+	assert.NoError(t, l.WaitN(context.Background(), 2))
+	assert.ErrorIs(t, l.WaitN(context.Background(), 3), ErrLimitExceeded)
+
+	// the token is generated after the deadline, it is not reserved
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, l.WaitN(ctx, 1), ErrWaitExceedsDeadline)
+	assert.Equal(t, 0, waiters(clock), "Expected WaitN to return without waiting")
+	assert.Equal(t, 0, l.Tokens())
+
+	// the token is generated before the deadline
+	ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	errs := make(chan error, 1)
+	go func() { errs <- l.WaitN(ctx, 1) }()
+	clock.BlockUntil(1)
+	clock.Advance(50 * time.Millisecond)
+	assert.NoError(t, <-errs)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		clock.BlockUntil(1)
+		cancel()
+	}()
+	assert.ErrorIs(t, l.WaitN(ctx, 1), context.Canceled, "Expected WaitN to return when the context is done")
+}
+
+func TestWaitN_CancelsOnContextDone(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	l := NewTokenBucket(1, 1, time.Second).WithClock(clock)
+	assert.True(t, l.Allow())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		clock.BlockUntil(1)
+		cancel()
+	}()
+	assert.ErrorIs(t, l.WaitN(ctx, 1), context.Canceled)
+	assert.Equal(t, 0, l.Tokens(), "Expected the reserved token to be returned")
+
+	r := &Reservation{}
+	assert.NotPanics(t, r.Cancel)
+}
@@ -1,19 +1,26 @@
 package ratelimiter
 
 import (
+	"context"
+	"slices"
 	"sync"
 	"time"
 )
 
 // SlidingWindowCount represents a rate limiter based on the sliding window count algorithm.
 type SlidingWindowCount struct {
-	mu             sync.Mutex
-	buckets        []int         // Number of requests in each time bucket
-	size           int           // Maximum allowed requests in the window
-	interval       time.Duration // Total sliding window size (e.g., 1 second)
-	bucketInterval time.Duration // Size of each time bucket (e.g., 100 milliseconds)
-	lastTime       time.Time     // The last time when a request was made
-	lastIndex      int           // Index of the last bucket that was updated
+	mu              sync.Mutex
+	bucketRing[int]               // Number of requests in each time bucket
+	size            int           // Maximum allowed requests in the window
+	interval        time.Duration // Total sliding window size (e.g., 1 second)
+	pending         []booking     // Requests reserved in future buckets, sorted by time
+	clock           Clock         // The clock telling the time
+}
+
+// booking is a number of requests reserved in the bucket starting at a future time.
+type booking struct {
+	at time.Time
+	n  int
 }
 
 // NewSlidingWindowCount creates a new Sliding Window Count rate limiter.
@@ -27,16 +34,11 @@ func NewSlidingWindowCount(size int, interval time.Duration, bucketCount int) *S
 	// Calculate the size of each bucket (how long each bucket represents in time)
 	bucketSize := interval / time.Duration(bucketCount)
 
-	// Initialize empty buckets
-	buckets := make([]int, bucketCount)
-
 	return &SlidingWindowCount{
-		buckets:        buckets,
-		size:           size,
-		interval:       interval,
-		bucketInterval: bucketSize,
-		lastTime:       time.Now(),
-		lastIndex:      0,
+		bucketRing: newBucketRing[int](bucketCount, bucketSize, time.Now()),
+		size:       size,
+		interval:   interval,
+		clock:      realClock{},
 	}
 }
 
@@ -47,33 +49,251 @@ func (sw *SlidingWindowCount) Allow() bool {
 
 // AllowN checks if 'n' requests are allowed within the current sliding window.
 func (sw *SlidingWindowCount) AllowN(n int) bool {
+	return sw.reserveN(sw.clock.Now(), n, 0).OK()
+}
+
+// Wait blocks until a single request is allowed or the context is done.
+func (sw *SlidingWindowCount) Wait(ctx context.Context) error {
+	return sw.WaitN(ctx, 1)
+}
+
+// WaitN blocks until 'n' requests are allowed.
+// It returns an error if 'n' exceeds the size, the context is done,
+// or the wait would exceed the context deadline.
+func (sw *SlidingWindowCount) WaitN(ctx context.Context, n int) error {
+	return waitN(ctx, sw.clock, sw, n)
+}
+
+// Reserve reserves a single request in the first bucket whose window has room for it.
+func (sw *SlidingWindowCount) Reserve() *Reservation {
+	return sw.ReserveN(1)
+}
+
+// ReserveN reserves 'n' requests in the first bucket whose window has room for them.
+// The reservation is not OK if 'n' exceeds the size.
+func (sw *SlidingWindowCount) ReserveN(n int) *Reservation {
+	return sw.reserveN(sw.clock.Now(), n, InfDuration)
+}
+
+// reserveN adds 'n' requests to the first bucket, from the current one, whose
+// window has room for them, if it starts within maxWait.
+// Requests are only reserved after the already reserved ones, so that the
+// windows of the later buckets never hold more requests.
+func (sw *SlidingWindowCount) reserveN(now time.Time, n int, maxWait time.Duration) *Reservation {
 	sw.mu.Lock()
 	defer sw.mu.Unlock()
+	return sw.reserve(now, n, maxWait)
+}
+
+// reserve is reserveN with the lock held.
+func (sw *SlidingWindowCount) reserve(now time.Time, n int, maxWait time.Duration) *Reservation {
+	if n > sw.size {
+		return &Reservation{}
+	}
 
 	// Update the buckets based on the current time
-	sw.updateBuckets()
+	sw.updateBuckets(now)
 
-	// Check if we can allow the new requests
-	if sw.totalCount()+n <= sw.size {
+	offset := sw.firstOffset(n)
+	timeToAct := sw.bucketTime(now, offset)
+	if timeToAct.Sub(now) > maxWait {
+		return &Reservation{timeToAct: timeToAct}
+	}
+
+	if offset == 0 {
 		// Add the new requests to the current time bucket
 		sw.addRequests(n)
-		return true
+	} else if last := len(sw.pending) - 1; last >= 0 && sw.pending[last].at.Equal(timeToAct) {
+		sw.pending[last].n += n
+	} else {
+		sw.pending = append(sw.pending, booking{at: timeToAct, n: n})
+	}
+	return &Reservation{ok: true, tokens: n, timeToAct: timeToAct, limiter: sw, clock: sw.clock}
+}
+
+// cancel removes the reserved requests from their future bucket.
+func (sw *SlidingWindowCount) cancel(r *Reservation, now time.Time) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	if r.tokens == 0 || !r.timeToAct.After(now) {
+		return
+	}
+	sw.uncount(r, now)
+}
+
+// refund removes the requests of the reservation from their bucket, whenever it acts.
+func (sw *SlidingWindowCount) refund(r *Reservation) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if r.tokens > 0 {
+		sw.uncount(r, sw.clock.Now())
+	}
+}
+
+// uncount removes the requests of the reservation from their future bucket, or from the
+// bucket they were counted in if it is still in the window, and marks the reservation
+// as canceled. It must be called with the lock held.
+func (sw *SlidingWindowCount) uncount(r *Reservation, now time.Time) {
+	n := r.tokens
+	r.tokens = 0
+	sw.updateBuckets(now)
+	for i := range sw.pending {
+		if sw.pending[i].at.Equal(r.timeToAct) {
+			sw.pending[i].n -= n
+			if sw.pending[i].n <= 0 {
+				sw.pending = slices.Delete(sw.pending, i, i+1)
+			}
+			return
+		}
+	}
+
+	age := 0
+	if r.timeToAct.Before(sw.lastTime) {
+		age = int((sw.lastTime.Sub(r.timeToAct) + sw.bucketInterval - 1) / sw.bucketInterval)
+	}
+	if age < len(sw.buckets) {
+		i := sw.index(age)
+		sw.buckets[i] = max(sw.buckets[i]-n, 0)
 	}
-	return false
 }
 
-// updateBuckets shifts and clears outdated buckets based on the current time.
-func (sw *SlidingWindowCount) updateBuckets() {
-	now := time.Now()
-	bucketPassed := sw.bucketPassed(now)
+// updateBuckets moves to the bucket of the given time, clearing the buckets
+// that left the window and filling the reserved ones.
+func (sw *SlidingWindowCount) updateBuckets(now time.Time) {
+	if sw.advance(now) == 0 {
+		return
+	}
+
+	for len(sw.pending) > 0 && !sw.pending[0].at.After(sw.lastTime) {
+		if age := -sw.offset(sw.pending[0].at); age < len(sw.buckets) {
+			sw.buckets[sw.index(age)] += sw.pending[0].n
+		}
+		sw.pending = sw.pending[1:]
+	}
+}
 
-	for i := 0; i < bucketPassed; i++ {
-		idx := (i + sw.lastIndex) % len(sw.buckets)
-		sw.buckets[idx] = 0
+// firstOffset returns the offset of the first bucket, from the current one or the one
+// of the last reservation, whose window has room for 'n' requests.
+func (sw *SlidingWindowCount) firstOffset(n int) int {
+	offset := 0
+	if len(sw.pending) > 0 {
+		offset = sw.offset(sw.pending[len(sw.pending)-1].at)
 	}
+	// the window of the bucket after the window of the last reservation is empty
+	for sw.windowCount(offset)+n > sw.size {
+		offset++
+	}
+	return offset
+}
+
+// bucketTime returns the time requests may happen in the bucket 'offset' buckets after the current one.
+func (sw *SlidingWindowCount) bucketTime(now time.Time, offset int) time.Time {
+	if offset <= 0 {
+		return now
+	}
+	return sw.lastTime.Add(time.Duration(offset) * sw.bucketInterval)
+}
 
-	sw.lastTime = now
-	sw.lastIndex = (sw.lastIndex + bucketPassed) % len(sw.buckets)
+// Decide reports whether 'n' requests may happen now, counting them if so,
+// along with the requests remaining in the current window.
+func (sw *SlidingWindowCount) Decide(n int) Decision {
+	_, d := sw.decide(sw.clock.Now(), n)
+	return d
+}
+
+// decide is Decide at now, also returning the reservation of the allowed requests.
+func (sw *SlidingWindowCount) decide(now time.Time, n int) (*Reservation, Decision) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	r := sw.reserve(now, n, 0)
+	return r, newDecision(now, r, sw.quota(now))
+}
+
+// quota returns the quota of the current window.
+// Nothing remains while requests are reserved, since new ones are only allowed after them.
+// It must be called with the lock held.
+func (sw *SlidingWindowCount) quota(now time.Time) quota {
+	sw.updateBuckets(now)
+	q := quota{limit: sw.size, resetAt: now}
+	// the window is empty once the youngest requests have left it
+	if len(sw.pending) > 0 {
+		q.resetAt = sw.pending[len(sw.pending)-1].at.Add(sw.interval)
+		return q
+	}
+	q.remaining = max(sw.size-sw.windowCount(0), 0)
+	for age := range sw.buckets {
+		if sw.buckets[sw.index(age)] > 0 {
+			q.resetAt = sw.bucketTime(now, len(sw.buckets)-age)
+			break
+		}
+	}
+	return q
+}
+
+// Burst returns the limit of the window, which is allowed at once.
+func (sw *SlidingWindowCount) Burst() int {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return sw.size
+}
+
+// WithClock sets the clock of the limiter, which defaults to the time package, and returns the limiter,
+// as in NewSlidingWindowCount(10, time.Second, 10).WithClock(clock).
+func (sw *SlidingWindowCount) WithClock(clock Clock) *SlidingWindowCount {
+	sw.setClock(clock)
+	return sw
+}
+
+// setClock replaces the clock of the limiter, the current bucket starts at its current time.
+func (sw *SlidingWindowCount) setClock(clock Clock) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.clock = clock
+	sw.reset(clock.Now())
+	sw.pending = nil
+}
+
+// currentClock returns the clock of the limiter.
+func (sw *SlidingWindowCount) currentClock() Clock {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return sw.clock
+}
+
+// SetLimit changes the number of requests allowed in the window,
+// the requests already in it still count.
+func (sw *SlidingWindowCount) SetLimit(limit int) {
+	if limit <= 0 {
+		panic("limit must be greater than 0")
+	}
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.size = limit
+}
+
+// SetInterval changes the duration of the window, keeping the number of buckets.
+// The requests are moved to the new bucket containing the start of their former one,
+// so that they leave the window no earlier than they were counted.
+func (sw *SlidingWindowCount) SetInterval(interval time.Duration) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	bucketInterval := interval / time.Duration(len(sw.buckets))
+	if bucketInterval <= 0 {
+		panic("interval must be greater than the number of buckets")
+	}
+
+	sw.updateBuckets(sw.clock.Now())
+	buckets := make([]int, len(sw.buckets))
+	for age := range sw.buckets {
+		// the current bucket keeps its start and its index
+		if newAge := int(time.Duration(age) * sw.bucketInterval / bucketInterval); newAge < len(buckets) {
+			buckets[sw.index(newAge)] += sw.buckets[sw.index(age)]
+		}
+	}
+	sw.buckets = buckets
+	sw.interval = interval
+	sw.bucketInterval = bucketInterval
 }
 
 // totalCount returns the total number of requests in the current sliding window.
@@ -85,15 +305,22 @@ func (sw *SlidingWindowCount) totalCount() int {
 	return total
 }
 
+// windowCount returns the number of requests in the window of the bucket
+// 'offset' buckets after the current one, including the reserved ones.
+func (sw *SlidingWindowCount) windowCount(offset int) int {
+	total := 0
+	for age := 0; age < len(sw.buckets)-offset; age++ {
+		total += sw.buckets[sw.index(age)]
+	}
+	for _, b := range sw.pending {
+		if o := sw.offset(b.at); o > offset-len(sw.buckets) && o <= offset {
+			total += b.n
+		}
+	}
+	return total
+}
+
 // addRequests adds the given number of requests to the current time bucket.
 func (sw *SlidingWindowCount) addRequests(n int) {
 	sw.buckets[sw.lastIndex] += n
 }
-
-func (sw *SlidingWindowCount) bucketPassed(now time.Time) int {
-	res := int(now.Sub(sw.lastTime) / sw.bucketInterval)
-	if res > len(sw.buckets) {
-		res = len(sw.buckets)
-	}
-	return res
-}
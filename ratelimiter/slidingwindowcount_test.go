@@ -40,7 +40,8 @@ func TestSlidingWindowCount_ShouldWork(t *testing.T) {
 	bucketCount := 10
 	windowInterval := time.Millisecond * time.Duration(bucketCount)
 
-	sw := NewSlidingWindowCount(size, windowInterval, bucketCount)
+	clock := NewFakeClock(time.Now())
+	sw := NewSlidingWindowCount(size, windowInterval, bucketCount).WithClock(clock)
 
 	// first 20 tokens should be allowed
 	for i := 0; i < size; i++ {
@@ -51,12 +52,99 @@ func TestSlidingWindowCount_ShouldWork(t *testing.T) {
 	assert.False(t, sw.Allow())
 	assert.Equal(t, size, sw.totalCount())
 
-	// sleep for 1/2 interval, some older tokens would be removed, new should be allowed
-	time.Sleep(windowInterval / 2)
+	// advance 1/2 interval, the first bucket is still in the window, new should be rejected
+	clock.Advance(windowInterval / 2)
+	assert.False(t, sw.Allow())
+
+	// advance until the first bucket has left the window, new should be allowed
+	clock.Advance(windowInterval / 2)
 	assert.True(t, sw.Allow())
 
-	// sleep for a long time, all buckets should be cleared
-	time.Sleep(windowInterval * 2)
+	// advance a long time, all buckets should be cleared
+	clock.Advance(windowInterval * 2)
 	assert.True(t, sw.Allow())
 	assert.Equal(t, 1, sw.totalCount())
 }
+
+func TestSlidingWindowCount_Rotation(t *testing.T) {
+	sw := NewSlidingWindowCount(4, 100*time.Millisecond, 4) // buckets of 25ms
+	now := sw.lastTime
+
+	// requests every 0.8 bucket move through the buckets
+	for i := 0; i < 4; i++ {
+		assert.True(t, sw.reserveN(now.Add(time.Duration(i)*20*time.Millisecond), 1, 0).OK())
+	}
+	assert.Equal(t, []int{2, 1, 1, 0}, sw.buckets)
+	assert.False(t, sw.reserveN(now.Add(99*time.Millisecond), 1, 0).OK())
+
+	// the first bucket leaves the window
+	assert.True(t, sw.reserveN(now.Add(100*time.Millisecond), 2, 0).OK())
+	assert.Equal(t, []int{2, 1, 1, 0}, sw.buckets)
+	assert.Equal(t, 4, sw.totalCount())
+}
+
+func TestSlidingWindowCount_Reserve(t *testing.T) {
+	const bucket = 25 * time.Millisecond
+	sw := NewSlidingWindowCount(2, 4*bucket, 4)
+	now := sw.lastTime
+
+	assert.True(t, sw.reserveN(now, 1, 0).OK())
+	assert.True(t, sw.reserveN(now.Add(bucket), 1, 0).OK())
+
+	// the first bucket leaves the window at the fifth bucket
+	r := sw.reserveN(now.Add(bucket), 1, InfDuration)
+	assert.Equal(t, 3*bucket, r.DelayFrom(now.Add(bucket)))
+	// then the second one
+	assert.False(t, sw.reserveN(now.Add(bucket), 1, 3*bucket).OK())
+	r = sw.reserveN(now.Add(bucket), 1, InfDuration)
+	assert.Equal(t, 4*bucket, r.DelayFrom(now.Add(bucket)))
+	assert.False(t, sw.reserveN(now, 3, InfDuration).OK())
+
+	// the reserved requests fill their buckets
+	assert.False(t, sw.reserveN(now.Add(5*bucket), 1, 0).OK())
+	assert.Equal(t, 2, sw.totalCount())
+	assert.Empty(t, sw.pending)
+}
+
+func TestSlidingWindowCount_Cancel(t *testing.T) {
+	const bucket = 25 * time.Millisecond
+	sw := NewSlidingWindowCount(2, 4*bucket, 4)
+	now := sw.lastTime
+
+	sw.reserveN(now, 2, 0)
+	r1 := sw.reserveN(now, 1, InfDuration)
+	r2 := sw.reserveN(now, 1, InfDuration)
+	assert.Equal(t, []booking{{at: now.Add(4 * bucket), n: 2}}, sw.pending)
+
+	r1.CancelAt(now)
+	r1.CancelAt(now)
+	assert.Equal(t, []booking{{at: now.Add(4 * bucket), n: 1}}, sw.pending)
+	r2.CancelAt(now)
+	assert.Empty(t, sw.pending)
+}
+
+func TestSlidingWindowCount_Reconfigure(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	sw := NewSlidingWindowCount(10, time.Second, 10).WithClock(clock)
+
+	assert.True(t, sw.AllowN(4))
+	clock.Advance(300 * time.Millisecond)
+	assert.True(t, sw.AllowN(3))
+
+	// the buckets of 100ms become buckets of 200ms
+	sw.SetInterval(2 * time.Second)
+	assert.Equal(t, 3, sw.buckets[sw.index(0)])
+	assert.Equal(t, 4, sw.buckets[sw.index(1)])
+	assert.Equal(t, 7, sw.windowCount(0))
+
+	sw.SetLimit(8)
+	assert.False(t, sw.AllowN(2))
+	assert.True(t, sw.Allow())
+
+	// the requests of the former buckets older than the new window have left it
+	sw.SetInterval(200 * time.Millisecond)
+	assert.Equal(t, 4, sw.windowCount(0))
+	assert.True(t, sw.AllowN(4))
+	assert.False(t, sw.Allow())
+	assert.Panics(t, func() { sw.SetInterval(time.Nanosecond) })
+}
@@ -1,6 +1,7 @@
 package ratelimiter
 
 import (
+	"context"
 	"slices"
 	"sync"
 	"time"
@@ -14,6 +15,7 @@ type SlidingWindowLog struct {
 	size     int           // Maximum number of allowed requests within the window
 	interval time.Duration // The sliding time window (e.g., 1 second)
 	logs     []time.Time   // Timestamps of the requests
+	clock    Clock         // The clock telling the time
 }
 
 // NewSlidingWindowLog creates a new SlidingWindowLog rate limiter.
@@ -28,6 +30,7 @@ func NewSlidingWindowLog(size int, interval ...time.Duration) *SlidingWindowLog
 		size:     size,
 		interval: time.Second, // Default interval is 1 second
 		logs:     make([]time.Time, 0, size),
+		clock:    realClock{},
 	}
 
 	// Override interval if provided
@@ -44,46 +47,203 @@ func (sw *SlidingWindowLog) Allow() bool {
 }
 
 // AllowN checks if 'n' requests can be allowed within the current time window.
-// It first tries to accept the requests if there's enough space without removing old requests.
-// If the log is full, it removes expired logs and tries again.
 func (sw *SlidingWindowLog) AllowN(n int) bool {
+	return sw.reserveN(sw.clock.Now(), n, 0).OK()
+}
+
+// Wait blocks until a single request is allowed or the context is done.
+func (sw *SlidingWindowLog) Wait(ctx context.Context) error {
+	return sw.WaitN(ctx, 1)
+}
+
+// WaitN blocks until 'n' requests are allowed.
+// It returns an error if 'n' exceeds the size, the context is done,
+// or the wait would exceed the context deadline.
+func (sw *SlidingWindowLog) WaitN(ctx context.Context, n int) error {
+	return waitN(ctx, sw.clock, sw, n)
+}
+
+// Reserve reserves a single request at the time the window has room for it.
+func (sw *SlidingWindowLog) Reserve() *Reservation {
+	return sw.ReserveN(1)
+}
+
+// ReserveN reserves 'n' requests at the time the window has room for them.
+// The reservation is not OK if 'n' exceeds the size.
+func (sw *SlidingWindowLog) ReserveN(n int) *Reservation {
+	return sw.reserveN(sw.clock.Now(), n, InfDuration)
+}
+
+// reserveN logs 'n' requests at the earliest time the window has room for them,
+// if it is within maxWait. Reserved requests are logged in the future.
+// If the log is not full, the requests are accepted directly.
+// If the log is full, old entries that are outside the window are removed,
+// and the requests are logged once enough of the remaining ones have left the window.
+func (sw *SlidingWindowLog) reserveN(now time.Time, n int, maxWait time.Duration) *Reservation {
 	sw.mu.Lock()
 	defer sw.mu.Unlock()
+	return sw.reserve(now, n, maxWait)
+}
 
-	now := time.Now()
+// reserve is reserveN with the lock held.
+func (sw *SlidingWindowLog) reserve(now time.Time, n int, maxWait time.Duration) *Reservation {
+	if n > sw.size {
+		return &Reservation{}
+	}
 
-	// If the log is not full, try to accept the new requests directly
-	if sw.tryAccept(n, now) {
-		return true
+	if len(sw.logs)+n > sw.size {
+		sw.removeOlderThan(now.Add(-sw.interval))
 	}
 
-	// If the log is full, remove old entries that are outside the window
-	sw.removeOlderThan(now.Add(-sw.interval))
+	timeToAct := now
+	if k := len(sw.logs) + n - sw.size; k > 0 {
+		// the k oldest requests must leave the window first,
+		// every later window holds at most as many requests
+		timeToAct = sw.logs[k-1].Add(sw.interval)
+	}
+	if timeToAct.Sub(now) > maxWait {
+		return &Reservation{timeToAct: timeToAct}
+	}
 
-	// Try to accept the requests again after removing old entries
-	return sw.tryAccept(n, now)
+	sw.insert(n, timeToAct)
+	return &Reservation{ok: true, tokens: n, timeToAct: timeToAct, limiter: sw, clock: sw.clock}
 }
 
-// tryAccept attempts to accept 'n' new requests. If there's enough space in the logs,
-// the requests will be accepted and timestamps added. Returns true if successful.
-func (sw *SlidingWindowLog) tryAccept(n int, now time.Time) bool {
-	if len(sw.logs)+n <= sw.size {
-		sw.append(n, now)
-		return true
+// cancel removes the reserved requests from the logs.
+func (sw *SlidingWindowLog) cancel(r *Reservation, now time.Time) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	if r.tokens == 0 || !r.timeToAct.After(now) {
+		return
 	}
-	return false
+	sw.unlog(r)
+}
+
+// refund removes the requests of the reservation from the logs, whenever it acts.
+func (sw *SlidingWindowLog) refund(r *Reservation) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.unlog(r)
 }
 
-func (sw *SlidingWindowLog) append(n int, now time.Time) {
-	batch := make([]time.Time, n)
-	for i := 0; i < n; i++ {
-		batch[i] = now
+// unlog removes the requests of the reservation still logged,
+// and marks it as canceled. It must be called with the lock held.
+func (sw *SlidingWindowLog) unlog(r *Reservation) {
+	i, _ := slices.BinarySearchFunc(sw.logs, r.timeToAct, func(t, at time.Time) int {
+		return t.Compare(at)
+	})
+	j := i
+	for j < min(i+r.tokens, len(sw.logs)) && sw.logs[j].Equal(r.timeToAct) {
+		j++
 	}
-	sw.logs = append(sw.logs, batch...)
+	sw.logs = slices.Delete(sw.logs, i, j)
+	r.tokens = 0
+}
+
+// insert logs 'n' requests at the given time, keeping the logs sorted.
+func (sw *SlidingWindowLog) insert(n int, at time.Time) {
+	i, _ := slices.BinarySearchFunc(sw.logs, at, func(t, at time.Time) int {
+		if t.After(at) {
+			return 1
+		}
+		return -1
+	})
+	sw.logs = slices.Insert(sw.logs, i, slices.Repeat([]time.Time{at}, n)...)
 }
 
+// removeOlderThan removes the requests logged at or before the threshold,
+// which have left the window.
 func (sw *SlidingWindowLog) removeOlderThan(threshold time.Time) {
 	sw.logs = slices.DeleteFunc(sw.logs, func(t time.Time) bool {
-		return t.Before(threshold)
+		return !t.After(threshold)
 	})
 }
+
+// Decide reports whether 'n' requests may happen now, counting them if so,
+// along with the requests remaining in the window.
+func (sw *SlidingWindowLog) Decide(n int) Decision {
+	_, d := sw.decide(sw.clock.Now(), n)
+	return d
+}
+
+// decide is Decide at now, also returning the reservation of the allowed requests.
+func (sw *SlidingWindowLog) decide(now time.Time, n int) (*Reservation, Decision) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	r := sw.reserve(now, n, 0)
+	return r, newDecision(now, r, sw.quota(now))
+}
+
+// quota returns the quota of the window, counting the reserved requests.
+// It must be called with the lock held.
+func (sw *SlidingWindowLog) quota(now time.Time) quota {
+	sw.removeOlderThan(now.Add(-sw.interval))
+	q := quota{limit: sw.size, remaining: max(sw.size-len(sw.logs), 0), resetAt: now}
+	if len(sw.logs) > 0 {
+		// the window is empty once the newest request has left it
+		q.resetAt = sw.logs[len(sw.logs)-1].Add(sw.interval)
+	}
+	return q
+}
+
+// Burst returns the limit of the window, which is allowed at once.
+func (sw *SlidingWindowLog) Burst() int {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return sw.size
+}
+
+// WithClock sets the clock of the limiter, which defaults to the time package, and returns the limiter,
+// as in NewSlidingWindowLog(10).WithClock(clock).
+func (sw *SlidingWindowLog) WithClock(clock Clock) *SlidingWindowLog {
+	sw.setClock(clock)
+	return sw
+}
+
+// setClock replaces the clock of the limiter, forgetting the logged requests.
+func (sw *SlidingWindowLog) setClock(clock Clock) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.clock = clock
+	sw.logs = sw.logs[:0]
+}
+
+// currentClock returns the clock of the limiter.
+func (sw *SlidingWindowLog) currentClock() Clock {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return sw.clock
+}
+
+// SetLimit changes the number of requests allowed in the window.
+// Only the newest 'limit' requests are kept in the log, since the older ones
+// must have left the window before a new request is allowed.
+func (sw *SlidingWindowLog) SetLimit(limit int) {
+	if limit <= 0 {
+		panic("limit must be greater than 0")
+	}
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.size = limit
+	sw.trim(sw.clock.Now())
+}
+
+// SetInterval changes the duration of the window, the requests having left it being removed from the log.
+func (sw *SlidingWindowLog) SetInterval(interval time.Duration) {
+	if interval <= 0 {
+		panic("interval must be greater than 0")
+	}
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.interval = interval
+	sw.trim(sw.clock.Now())
+}
+
+// trim removes the requests that left the window, and the oldest ones beyond the size.
+func (sw *SlidingWindowLog) trim(now time.Time) {
+	sw.removeOlderThan(now.Add(-sw.interval))
+	if extra := len(sw.logs) - sw.size; extra > 0 {
+		sw.logs = slices.Delete(sw.logs, 0, extra)
+	}
+}
@@ -25,12 +25,13 @@ func TestSlidingWindowLog_ShouldWork(t *testing.T) {
 	size := 10
 	interval := time.Millisecond * time.Duration(size)
 
-	sw := NewSlidingWindowLog(size, interval)
+	clock := NewFakeClock(time.Now())
+	sw := NewSlidingWindowLog(size, interval).WithClock(clock)
 
 	// first 10 tokens should be allowed
 	for i := 0; i < size; i++ {
 		if i < size-3 {
-			time.Sleep(interval / time.Duration(size)) // just sleep 7/10 interval
+			clock.Advance(interval / time.Duration(size)) // just advance 7/10 interval
 		}
 		assert.True(t, sw.Allow())
 	}
@@ -38,7 +39,69 @@ func TestSlidingWindowLog_ShouldWork(t *testing.T) {
 	// in current window, no more tokens should be allowed
 	assert.False(t, sw.Allow())
 
-	// sleep for 1/2 interval, some older tokens would be removed, new should be allowed
-	time.Sleep(interval / 2)
+	// advance 1/2 interval, some older tokens would be removed, new should be allowed
+	clock.Advance(interval / 2)
 	assert.True(t, sw.Allow())
 }
+
+func TestSlidingWindowLog_Reserve(t *testing.T) {
+	const interval = 100 * time.Millisecond
+	sw := NewSlidingWindowLog(2, interval)
+	now := time.Now()
+
+	assert.True(t, sw.reserveN(now, 1, 0).OK())
+	assert.True(t, sw.reserveN(now.Add(interval/2), 1, 0).OK())
+
+	// the first request leaves the window after an interval
+	r := sw.reserveN(now.Add(interval/2), 1, InfDuration)
+	assert.Equal(t, interval/2, r.DelayFrom(now.Add(interval/2)))
+	// then the second one
+	r = sw.reserveN(now.Add(interval/2), 1, InfDuration)
+	assert.Equal(t, interval, r.DelayFrom(now.Add(interval/2)))
+
+	assert.False(t, sw.reserveN(now, 3, InfDuration).OK())
+	assert.Len(t, sw.logs, 4)
+	assert.False(t, sw.reserveN(now.Add(interval), 1, 0).OK())
+
+	// requests logged exactly an interval ago have left the window
+	assert.True(t, sw.reserveN(now.Add(5*interval/2), 2, 0).OK())
+}
+
+func TestSlidingWindowLog_Cancel(t *testing.T) {
+	const interval = 100 * time.Millisecond
+	sw := NewSlidingWindowLog(2, interval)
+	now := time.Now()
+
+	acted := sw.reserveN(now, 2, InfDuration)
+	r := sw.reserveN(now, 2, InfDuration)
+	acted.CancelAt(now)
+	assert.Len(t, sw.logs, 4)
+
+	r.CancelAt(now)
+	r.CancelAt(now)
+	assert.Equal(t, []time.Time{now, now}, sw.logs)
+	assert.Equal(t, interval, sw.reserveN(now, 1, InfDuration).DelayFrom(now))
+}
+
+func TestSlidingWindowLog_Reconfigure(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	sw := NewSlidingWindowLog(4, time.Second).WithClock(clock)
+
+	assert.True(t, sw.AllowN(3))
+	clock.Advance(500 * time.Millisecond)
+	assert.True(t, sw.Allow())
+
+	// only the newest requests are kept
+	sw.SetLimit(2)
+	assert.Len(t, sw.logs, 2)
+	d := sw.Decide(1)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, 500*time.Millisecond, d.RetryAfter)
+
+	// the requests having left the new window are removed
+	sw.SetInterval(200 * time.Millisecond)
+	assert.Len(t, sw.logs, 1)
+	assert.True(t, sw.Allow())
+	assert.False(t, sw.Allow())
+	assert.Panics(t, func() { sw.SetLimit(-1) })
+}
@@ -0,0 +1,136 @@
+package ratelimiter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Store keeps the state of the limiters shared by several replicas, such as Redis.
+// The keys expire after their TTL, a zero TTL meaning they never expire.
+type Store interface {
+	// Get returns the value of the key, nil if it does not exist.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// CompareAndSwap sets the value of the key to newValue, with the TTL, if its value is oldValue,
+	// nil meaning that the key does not exist. It reports whether the value was set.
+	CompareAndSwap(ctx context.Context, key string, oldValue, newValue []byte, ttl time.Duration) (bool, error)
+	// IncrBy adds delta to the integer value of the key and returns the result.
+	// A key that does not exist is created with the TTL and the value delta.
+	IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+}
+
+// minMemoryStoreSweep is the number of keys a MemoryStore holds before sweeping the expired ones.
+const minMemoryStoreSweep = 1024
+
+// MemoryStore is a Store keeping the keys in memory, as a stand-in for a shared store
+// in tests or when a single process is enough.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]memoryEntry
+	nextSweep int // The number of keys from which the expired ones are swept
+	clock     Clock
+}
+
+type memoryEntry struct {
+	value []byte
+	// expireAt is the time the entry expires, zero if it never expires.
+	expireAt time.Time
+}
+
+// NewMemoryStore creates a new empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry), nextSweep: minMemoryStoreSweep, clock: realClock{}}
+}
+
+// WithClock sets the clock expiring the keys, which defaults to the time package, and returns the store.
+func (s *MemoryStore) WithClock(clock Clock) *MemoryStore {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clock = clock
+	return s
+}
+
+// Get returns the value of the key, nil if it does not exist.
+func (s *MemoryStore) Get(_ context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.get(key, s.clock.Now())
+	if !ok {
+		return nil, nil
+	}
+	return append([]byte{}, e.value...), nil // not nil even if empty
+}
+
+// CompareAndSwap sets the value of the key to newValue if its value is oldValue, see Store.
+func (s *MemoryStore) CompareAndSwap(_ context.Context, key string, oldValue, newValue []byte, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	e, ok := s.get(key, now)
+	if ok != (oldValue != nil) || !bytes.Equal(e.value, oldValue) {
+		return false, nil
+	}
+	s.set(key, bytes.Clone(newValue), ttl, now)
+	return true, nil
+}
+
+// IncrBy adds delta to the integer value of the key, see Store.
+// The TTL of an existing key is kept.
+func (s *MemoryStore) IncrBy(_ context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	e, ok := s.get(key, now)
+	if !ok {
+		s.set(key, strconv.AppendInt(nil, delta, 10), ttl, now)
+		return delta, nil
+	}
+	n, err := strconv.ParseInt(string(e.value), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("value of key %q is not an integer: %w", key, err)
+	}
+	n += delta
+	s.entries[key] = memoryEntry{value: strconv.AppendInt(nil, n, 10), expireAt: e.expireAt}
+	return n, nil
+}
+
+// Len returns the number of keys in the store, including the expired ones not swept yet.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// get returns the entry of the key, dropping it if it has expired.
+func (s *MemoryStore) get(key string, now time.Time) (memoryEntry, bool) {
+	e, ok := s.entries[key]
+	if ok && !e.expireAt.IsZero() && !now.Before(e.expireAt) {
+		delete(s.entries, key)
+		return memoryEntry{}, false
+	}
+	return e, ok
+}
+
+// set sets the entry of the key, sweeping the expired entries once the store has grown enough.
+func (s *MemoryStore) set(key string, value []byte, ttl time.Duration, now time.Time) {
+	e := memoryEntry{value: value}
+	if ttl > 0 {
+		e.expireAt = now.Add(ttl)
+	}
+	s.entries[key] = e
+
+	if len(s.entries) >= s.nextSweep {
+		for k, e := range s.entries {
+			if !e.expireAt.IsZero() && !now.Before(e.expireAt) {
+				delete(s.entries, k)
+			}
+		}
+		s.nextSweep = max(2*len(s.entries), minMemoryStoreSweep)
+	}
+}
@@ -0,0 +1,99 @@
+package ratelimiter
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	testStore(t, NewMemoryStore().WithClock(clock), clock)
+}
+
+func TestRemoteStore(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	testStore(t, startStoreServer(t, NewMemoryStore().WithClock(clock)), clock)
+}
+
+// startStoreServer serves the store on a local port and returns a client of it.
+func startStoreServer(t *testing.T, store Store) *RemoteStore {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := NewStoreServer(store)
+	done := make(chan error, 1)
+	go func() { done <- server.Serve(l) }()
+
+	client, err := DialStore(l.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, client.Close())
+		assert.NoError(t, server.Close())
+		assert.NoError(t, <-done)
+	})
+	return client
+}
+
+// testStore tests the store, whose keys expire by the clock.
+func testStore(t *testing.T, store Store, clock *FakeClock) {
+	ctx := context.Background()
+
+	v, err := store.Get(ctx, "cas")
+	assert.NoError(t, err)
+	assert.Nil(t, v)
+
+	swapped, err := store.CompareAndSwap(ctx, "cas", []byte("a"), []byte("b"), 0)
+	assert.NoError(t, err)
+	assert.False(t, swapped, "Expected no swap when the key does not exist")
+	swapped, err = store.CompareAndSwap(ctx, "cas", nil, []byte("a"), 0)
+	assert.NoError(t, err)
+	assert.True(t, swapped)
+	swapped, _ = store.CompareAndSwap(ctx, "cas", nil, []byte("b"), 0)
+	assert.False(t, swapped, "Expected no swap when the key exists")
+	swapped, _ = store.CompareAndSwap(ctx, "cas", []byte("a"), []byte{}, 0)
+	assert.True(t, swapped)
+	v, _ = store.Get(ctx, "cas")
+	assert.Equal(t, []byte{}, v, "Expected an empty value to exist")
+
+	n, err := store.IncrBy(ctx, "counter", 2, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	n, _ = store.IncrBy(ctx, "counter", -3, 0)
+	assert.Equal(t, int64(-1), n)
+	v, _ = store.Get(ctx, "counter")
+	assert.Equal(t, "-1", string(v))
+	_, err = store.IncrBy(ctx, "cas", 1, 0)
+	assert.Error(t, err, "Expected an error incrementing a value that is not an integer")
+
+	// the keys expire after their TTL
+	_, _ = store.IncrBy(ctx, "expiring", 1, 20*time.Millisecond)
+	n, _ = store.IncrBy(ctx, "expiring", 1, time.Hour)
+	assert.Equal(t, int64(2), n, "Expected the TTL of an existing key to be kept")
+	_, _ = store.CompareAndSwap(ctx, "expiring-cas", nil, []byte("a"), 20*time.Millisecond)
+	clock.Advance(20 * time.Millisecond)
+	v, _ = store.Get(ctx, "expiring")
+	assert.Nil(t, v)
+	swapped, _ = store.CompareAndSwap(ctx, "expiring-cas", nil, []byte("b"), 0)
+	assert.True(t, swapped, "Expected an expired key not to exist")
+}
+
+func TestMemoryStore_Sweep(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	s := NewMemoryStore().WithClock(clock)
+	ctx := context.Background()
+	for i := 0; i < minMemoryStoreSweep-1; i++ {
+		_, _ = s.IncrBy(ctx, strconv.Itoa(i), 1, 50*time.Millisecond)
+	}
+	assert.Equal(t, minMemoryStoreSweep-1, s.Len())
+
+	clock.Advance(50 * time.Millisecond)
+	_, _ = s.CompareAndSwap(ctx, "kept", nil, []byte("a"), 0)
+	assert.Equal(t, 1, s.Len(), "Expected the expired keys to be swept")
+	assert.Equal(t, minMemoryStoreSweep, s.nextSweep)
+}
@@ -0,0 +1,378 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StoreLimiter is a limiter keeping the state of each key in a Store shared by several replicas,
+// so that the limit is global. The replicas must have synchronized clocks.
+type StoreLimiter interface {
+	// Decide reports whether n requests of the key may happen now, counting them if so,
+	// see Limiter.Decide. It returns ErrStoreConflict if other replicas keep changing the key meanwhile.
+	Decide(ctx context.Context, key string, n int) (Decision, error)
+}
+
+// maxCASAttempts is the number of times a StoreLimiter decides before giving up
+// when the state of the key keeps changing.
+const maxCASAttempts = 10
+
+// ErrStoreConflict is returned by a StoreLimiter when the state of the key kept being changed
+// by other replicas while it was deciding.
+var ErrStoreConflict = errors.New("store state changed concurrently")
+
+// storeKey returns the key of the store holding the state of the algorithm for the key.
+func storeKey(algorithm Algorithm, key string, suffix ...string) string {
+	return strings.Join(append([]string{string(algorithm), key}, suffix...), ":")
+}
+
+// StoreFixedWindows is a fixed window limiter counting the requests in a Store.
+// The windows are aligned on multiples of the interval, so that the replicas agree on them.
+type StoreFixedWindows struct {
+	store    Store
+	size     int
+	interval time.Duration
+	clock    Clock
+}
+
+// NewStoreFixedWindows creates a new fixed window limiter allowing 'size' requests per interval.
+// If no interval is provided, it defaults to 1 second.
+func NewStoreFixedWindows(store Store, size int, interval ...time.Duration) *StoreFixedWindows {
+	fw := &StoreFixedWindows{store: store, size: size, interval: time.Second, clock: realClock{}}
+	if len(interval) > 0 {
+		fw.interval = interval[0]
+	}
+	if fw.size <= 0 || fw.interval <= 0 {
+		panic("size and interval must be greater than 0")
+	}
+	return fw
+}
+
+// Decide increments the count of the current window of the key, and decrements it back
+// if it exceeds the size.
+func (fw *StoreFixedWindows) Decide(ctx context.Context, key string, n int) (Decision, error) {
+	now := fw.clock.Now()
+	start := now.Truncate(fw.interval)
+	end := start.Add(fw.interval)
+	d := Decision{Limit: fw.size, ResetAt: end, RetryAfter: end.Sub(now), now: now}
+	if n > fw.size {
+		d.RetryAfter = InfDuration
+		return d, nil
+	}
+
+	k := storeKey(AlgorithmFixedWindows, key, strconv.FormatInt(start.UnixNano(), 10))
+	count, err := fw.store.IncrBy(ctx, k, int64(n), end.Sub(now))
+	if err != nil {
+		return Decision{}, err
+	}
+	if count > int64(fw.size) {
+		// the requests of the other replicas may have been counted back already
+		_, err = fw.store.IncrBy(ctx, k, -int64(n), end.Sub(now))
+		d.Remaining = max(fw.size-int(count)+n, 0)
+		return d, err
+	}
+	d.Allowed, d.Remaining, d.RetryAfter = true, fw.size-int(count), 0
+	return d, nil
+}
+
+// WithClock sets the clock of the limiter, which defaults to the time package, and returns the limiter,
+// as in NewStoreFixedWindows(store, 10).WithClock(clock).
+func (fw *StoreFixedWindows) WithClock(clock Clock) *StoreFixedWindows {
+	fw.setClock(clock)
+	return fw
+}
+
+// setClock replaces the clock of the limiter.
+func (fw *StoreFixedWindows) setClock(clock Clock) {
+	fw.clock = clock
+}
+
+// StoreSlidingWindowCount is a sliding window count limiter counting the requests
+// of each bucket in a Store. The buckets are aligned on multiples of their interval,
+// so that the replicas agree on them.
+type StoreSlidingWindowCount struct {
+	store          Store
+	size           int
+	buckets        int
+	bucketInterval time.Duration
+	clock          Clock
+}
+
+// NewStoreSlidingWindowCount creates a new sliding window count limiter allowing 'size' requests
+// per interval, divided into 'bucketCount' buckets.
+func NewStoreSlidingWindowCount(store Store, size int, interval time.Duration, bucketCount int) *StoreSlidingWindowCount {
+	if size <= 0 || interval <= 0 || bucketCount <= 0 {
+		panic("size, interval, and bucketCount must be greater than 0")
+	}
+	return &StoreSlidingWindowCount{
+		store:          store,
+		size:           size,
+		buckets:        bucketCount,
+		bucketInterval: interval / time.Duration(bucketCount),
+		clock:          realClock{},
+	}
+}
+
+// Decide increments the count of the current bucket of the key, and decrements it back if the
+// window exceeds the size. The requests are only counted in the current bucket, so its count
+// includes the concurrent requests of the other replicas and the window is never exceeded.
+func (sw *StoreSlidingWindowCount) Decide(ctx context.Context, key string, n int) (Decision, error) {
+	now := sw.clock.Now()
+	current := now.Truncate(sw.bucketInterval)
+	window := time.Duration(sw.buckets) * sw.bucketInterval
+	d := Decision{Limit: sw.size, ResetAt: now, RetryAfter: InfDuration, now: now}
+	if n > sw.size {
+		return d, nil
+	}
+
+	counts, err := sw.counts(ctx, key, current)
+	if err != nil {
+		return Decision{}, err
+	}
+	k := sw.key(key, current)
+	count, err := sw.store.IncrBy(ctx, k, int64(n), window+sw.bucketInterval)
+	if err != nil {
+		return Decision{}, err
+	}
+	counts[0] = int(count)
+
+	total := 0
+	for _, c := range counts {
+		total += c
+	}
+	for age, c := range counts {
+		if c > 0 {
+			// the youngest requests leave the window last
+			d.ResetAt = current.Add(window - time.Duration(age)*sw.bucketInterval)
+			break
+		}
+	}
+	if total <= sw.size {
+		d.Allowed, d.Remaining, d.RetryAfter = true, sw.size-total, 0
+		return d, nil
+	}
+
+	_, err = sw.store.IncrBy(ctx, k, -int64(n), window+sw.bucketInterval)
+	total -= n
+	d.Remaining = max(sw.size-total, 0)
+	// the requests fit once enough of the oldest buckets have left the window
+	for age := sw.buckets - 1; age >= 0; age-- {
+		total -= counts[age]
+		if age == 0 {
+			total += n
+		}
+		if total+n <= sw.size {
+			d.RetryAfter = current.Add(window - time.Duration(age)*sw.bucketInterval).Sub(now)
+			break
+		}
+	}
+	return d, err
+}
+
+// counts returns the counts of the buckets of the window of the current bucket,
+// counts[age] being the count of the bucket 'age' buckets before it.
+// The count of the current bucket is left to the caller.
+func (sw *StoreSlidingWindowCount) counts(ctx context.Context, key string, current time.Time) ([]int, error) {
+	counts := make([]int, sw.buckets)
+	for age := 1; age < sw.buckets; age++ {
+		k := sw.key(key, current.Add(-time.Duration(age)*sw.bucketInterval))
+		v, err := sw.store.Get(ctx, k)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			continue
+		}
+		if counts[age], err = strconv.Atoi(string(v)); err != nil {
+			return nil, errInvalidState(k, v)
+		}
+	}
+	return counts, nil
+}
+
+// key returns the key of the store counting the requests of the key in the bucket starting at the given time.
+func (sw *StoreSlidingWindowCount) key(key string, start time.Time) string {
+	return storeKey(AlgorithmSlidingWindowCount, key, strconv.FormatInt(start.UnixNano(), 10))
+}
+
+// WithClock sets the clock of the limiter, which defaults to the time package, and returns the limiter,
+// as in NewStoreSlidingWindowCount(store, 10, time.Second, 10).WithClock(clock).
+func (sw *StoreSlidingWindowCount) WithClock(clock Clock) *StoreSlidingWindowCount {
+	sw.setClock(clock)
+	return sw
+}
+
+// setClock replaces the clock of the limiter.
+func (sw *StoreSlidingWindowCount) setClock(clock Clock) {
+	sw.clock = clock
+}
+
+// StoreTokenBucket is a token bucket limiter keeping the tokens of each key and the time
+// they were last generated in a Store, updated with compare-and-swap.
+type StoreTokenBucket struct {
+	store    Store
+	rate     float64
+	capacity int
+	interval time.Duration
+	clock    Clock
+}
+
+// NewStoreTokenBucket creates a new token bucket limiter generating 'rate' tokens per interval,
+// up to 'capacity' tokens. If no interval is provided, it defaults to 1 second.
+func NewStoreTokenBucket(store Store, rate float64, capacity int, interval ...time.Duration) *StoreTokenBucket {
+	l := &StoreTokenBucket{store: store, rate: rate, capacity: capacity, interval: time.Second, clock: realClock{}}
+	if len(interval) > 0 {
+		l.interval = interval[0]
+	}
+	if l.rate <= 0 || l.capacity <= 0 || l.interval <= 0 {
+		panic("rate, capacity and interval must be greater than 0")
+	}
+	return l
+}
+
+// Decide takes 'n' tokens from the bucket of the key if it holds them, like TokenBucket.Decide.
+// A key that does not exist has a full bucket.
+func (l *StoreTokenBucket) Decide(ctx context.Context, key string, n int) (Decision, error) {
+	k := storeKey(AlgorithmTokenBucket, key)
+	return casDecide(ctx, l.store, k, func(state []byte) (Decision, []byte, time.Duration, error) {
+		now := l.clock.Now()
+		tb := &TokenBucket{rate: l.rate, capacity: l.capacity, tokens: float64(l.capacity), interval: l.interval, lastTime: now}
+		if state != nil {
+			tokens, last, ok := strings.Cut(string(state), " ")
+			var err error
+			if tb.tokens, err = strconv.ParseFloat(tokens, 64); err != nil || !ok {
+				return Decision{}, nil, 0, errInvalidState(k, state)
+			}
+			nanos, err := strconv.ParseInt(last, 10, 64)
+			if err != nil {
+				return Decision{}, nil, 0, errInvalidState(k, state)
+			}
+			tb.lastTime = time.Unix(0, nanos)
+		}
+
+		d := newDecision(now, tb.reserve(now, n, 0), tb.quota(now))
+		state = strconv.AppendFloat(nil, tb.tokens, 'g', -1, 64)
+		state = append(state, ' ')
+		state = strconv.AppendInt(state, tb.lastTime.UnixNano(), 10)
+		// the state is dropped once the bucket is full again
+		return d, state, max(d.ResetAt.Sub(now), time.Millisecond), nil
+	})
+}
+
+// WithClock sets the clock of the limiter, which defaults to the time package, and returns the limiter,
+// as in NewStoreTokenBucket(store, 10, 10).WithClock(clock).
+func (l *StoreTokenBucket) WithClock(clock Clock) *StoreTokenBucket {
+	l.setClock(clock)
+	return l
+}
+
+// setClock replaces the clock of the limiter.
+func (l *StoreTokenBucket) setClock(clock Clock) {
+	l.clock = clock
+}
+
+// StoreGCRA is a GCRA limiter keeping the theoretical arrival time of each key in a Store,
+// updated with compare-and-swap.
+type StoreGCRA struct {
+	store Store
+	gcra  *GCRA // The configuration of the limiter, its state is unused
+}
+
+// NewStoreGCRA creates a new GCRA limiter allowing 'rate' requests per interval,
+// and up to 'burst' requests at once. If no interval is provided, it defaults to 1 second.
+func NewStoreGCRA(store Store, rate, burst int, interval ...time.Duration) *StoreGCRA {
+	return &StoreGCRA{store: store, gcra: NewGCRA(rate, burst, interval...)}
+}
+
+// Decide moves the theoretical arrival time of the key forward if the requests conform
+// to the rate, like GCRA.Decide. A key that does not exist has its full burst.
+func (g *StoreGCRA) Decide(ctx context.Context, key string, n int) (Decision, error) {
+	k := storeKey(AlgorithmGCRA, key)
+	return casDecide(ctx, g.store, k, func(state []byte) (Decision, []byte, time.Duration, error) {
+		now := g.gcra.clock.Now()
+		l := &GCRA{emission: g.gcra.emission, tolerance: g.gcra.tolerance, burst: g.gcra.burst}
+		if state != nil {
+			nanos, err := strconv.ParseInt(string(state), 10, 64)
+			if err != nil {
+				return Decision{}, nil, 0, errInvalidState(k, state)
+			}
+			l.tat = time.Unix(0, nanos)
+		}
+
+		d := newDecision(now, l.reserve(now, n, 0), l.quota(now))
+		// the key is reset once the theoretical arrival time is reached
+		return d, strconv.AppendInt(nil, l.tat.UnixNano(), 10), max(l.tat.Sub(now), time.Millisecond), nil
+	})
+}
+
+// WithClock sets the clock of the limiter, which defaults to the time package, and returns the limiter,
+// as in NewStoreGCRA(store, 10, 5).WithClock(clock).
+func (g *StoreGCRA) WithClock(clock Clock) *StoreGCRA {
+	g.setClock(clock)
+	return g
+}
+
+// setClock replaces the clock of the limiter.
+func (g *StoreGCRA) setClock(clock Clock) {
+	g.gcra.clock = clock
+}
+
+// casDecide decides with the state of the key, and stores the new state with its TTL if
+// the requests are allowed, unless the state has changed in the meantime, in which case
+// it decides again with the new one, up to maxCASAttempts times.
+func casDecide(
+	ctx context.Context, store Store, key string,
+	decide func(state []byte) (d Decision, newState []byte, ttl time.Duration, err error),
+) (Decision, error) {
+	for range maxCASAttempts {
+		state, err := store.Get(ctx, key)
+		if err != nil {
+			return Decision{}, err
+		}
+		d, newState, ttl, err := decide(state)
+		if err != nil || !d.Allowed {
+			return d, err
+		}
+		swapped, err := store.CompareAndSwap(ctx, key, state, newState, ttl)
+		if err != nil || swapped {
+			return d, err
+		}
+	}
+	return Decision{}, ErrStoreConflict
+}
+
+// errInvalidState returns the error of a key of the store whose state cannot be parsed.
+func errInvalidState(key string, state []byte) error {
+	return fmt.Errorf("invalid state %q of key %q", state, key)
+}
+
+// BuildStore builds a new limiter keeping its state in the store, with the given algorithm and limit.
+// Only the fixed window, sliding window count, token bucket and GCRA algorithms are supported.
+func (b *builder) BuildStore(store Store) StoreLimiter {
+	if b.algorithm == "" || b.limit <= 0 {
+		panic("unspecified algorithm or limit")
+	}
+	interval, burst, buckets := b.defaults()
+
+	var l StoreLimiter
+	switch b.algorithm {
+	case AlgorithmFixedWindows:
+		l = NewStoreFixedWindows(store, b.limit, interval)
+	case AlgorithmSlidingWindowCount:
+		l = NewStoreSlidingWindowCount(store, b.limit, interval, buckets)
+	case AlgorithmTokenBucket:
+		l = NewStoreTokenBucket(store, float64(b.limit), burst, interval)
+	case AlgorithmGCRA:
+		l = NewStoreGCRA(store, b.limit, burst, interval)
+	default:
+		panic("unsupported store algorithm: " + b.algorithm)
+	}
+	if b.clock != nil {
+		l.(interface{ setClock(Clock) }).setClock(b.clock)
+	}
+	return l
+}
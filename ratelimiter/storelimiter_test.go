@@ -0,0 +1,185 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decide(t *testing.T, l StoreLimiter, key string, n int) Decision {
+	t.Helper()
+	d, err := l.Decide(context.Background(), key, n)
+	require.NoError(t, err)
+	return d
+}
+
+func TestStoreFixedWindows(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_700_000_000, 0)) // at the start of a second, on which the store windows are aligned
+	l := Builder().Algorithm(AlgorithmFixedWindows).Limit(2).Clock(clock).BuildStore(NewMemoryStore())
+
+	clock.Advance(500 * time.Millisecond)
+	assert.Equal(t, 1, decide(t, l, "a", 1).Remaining)
+	d := decide(t, l, "a", 1)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 0, d.Remaining)
+	assert.Equal(t, 500*time.Millisecond, d.ResetAt.Sub(clock.Now()))
+	assert.True(t, decide(t, l, "b", 2).Allowed, "Expected each key to have its own window")
+
+	d = decide(t, l, "a", 1)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, 0, d.Remaining)
+	assert.Equal(t, 500*time.Millisecond, d.RetryAfter)
+	assert.Equal(t, InfDuration, decide(t, l, "a", 3).RetryAfter)
+
+	clock.Advance(500 * time.Millisecond)
+	assert.True(t, decide(t, l, "a", 2).Allowed)
+}
+
+func TestStoreSlidingWindowCount(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_700_000_000, 0))
+	l := Builder().Algorithm(AlgorithmSlidingWindowCount).Limit(4).Buckets(4).Clock(clock).BuildStore(NewMemoryStore())
+
+	assert.True(t, decide(t, l, "a", 2).Allowed)
+	clock.Advance(250 * time.Millisecond)
+	d := decide(t, l, "a", 2)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 0, d.Remaining)
+	assert.Equal(t, time.Second, d.ResetAt.Sub(clock.Now()))
+
+	// the requests of the first bucket leave the window first
+	d = decide(t, l, "a", 1)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, 750*time.Millisecond, d.RetryAfter)
+	d = decide(t, l, "a", 3)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, time.Second, d.RetryAfter)
+	assert.Equal(t, InfDuration, decide(t, l, "a", 5).RetryAfter)
+
+	clock.Advance(750 * time.Millisecond)
+	d = decide(t, l, "a", 2)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 0, d.Remaining)
+}
+
+func TestStoreTokenBucket(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_700_000_000, 0))
+	l := Builder().Algorithm(AlgorithmTokenBucket).Limit(1).Burst(2).Clock(clock).BuildStore(NewMemoryStore())
+
+	d := decide(t, l, "a", 2)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 0, d.Remaining)
+	assert.Equal(t, 2*time.Second, d.ResetAt.Sub(clock.Now()))
+	d = decide(t, l, "a", 1)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, time.Second, d.RetryAfter)
+
+	clock.Advance(time.Second)
+	assert.True(t, decide(t, l, "a", 1).Allowed)
+	assert.False(t, decide(t, l, "a", 1).Allowed)
+}
+
+func TestStoreGCRA(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_700_000_000, 0))
+	l := Builder().Algorithm(AlgorithmGCRA).Limit(2).Burst(2).Clock(clock).BuildStore(NewMemoryStore())
+
+	assert.Equal(t, 1, decide(t, l, "a", 1).Remaining)
+	assert.True(t, decide(t, l, "a", 1).Allowed)
+	d := decide(t, l, "a", 1)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, 500*time.Millisecond, d.RetryAfter)
+
+	clock.Advance(500 * time.Millisecond)
+	assert.True(t, decide(t, l, "a", 1).Allowed)
+}
+
+func TestStoreLimiter_InvalidState(t *testing.T) {
+	store := NewMemoryStore()
+	_, _ = store.CompareAndSwap(context.Background(), storeKey(AlgorithmGCRA, "a"), nil, []byte("x"), 0)
+	_, _ = store.CompareAndSwap(context.Background(), storeKey(AlgorithmTokenBucket, "a"), nil, []byte("1"), 0)
+
+	_, err := NewStoreGCRA(store, 1, 1).Decide(context.Background(), "a", 1)
+	assert.Error(t, err)
+	_, err = NewStoreTokenBucket(store, 1, 1).Decide(context.Background(), "a", 1)
+	assert.Error(t, err)
+}
+
+// conflictStore is a Store whose keys are always changed before they are swapped.
+type conflictStore struct {
+	Store
+	attempts int
+}
+
+func (s *conflictStore) CompareAndSwap(context.Context, string, []byte, []byte, time.Duration) (bool, error) {
+	s.attempts++
+	return false, nil
+}
+
+func TestStoreLimiter_Conflict(t *testing.T) {
+	store := &conflictStore{Store: NewMemoryStore()}
+	_, err := NewStoreGCRA(store, 1, 1).Decide(context.Background(), "a", 1)
+	assert.ErrorIs(t, err, ErrStoreConflict)
+	assert.Equal(t, maxCASAttempts, store.attempts)
+}
+
+func TestBuildStore(t *testing.T) {
+	store := NewMemoryStore()
+	assert.IsType(t, &StoreFixedWindows{}, Builder().Algorithm(AlgorithmFixedWindows).Limit(1).BuildStore(store))
+	assert.IsType(t, &StoreSlidingWindowCount{}, Builder().Algorithm(AlgorithmSlidingWindowCount).Limit(1).BuildStore(store))
+	assert.IsType(t, &StoreTokenBucket{}, Builder().Algorithm(AlgorithmTokenBucket).Limit(1).BuildStore(store))
+	assert.IsType(t, &StoreGCRA{}, Builder().Algorithm(AlgorithmGCRA).Limit(1).BuildStore(store))
+
+	assert.Panics(t, func() { Builder().Algorithm(AlgorithmLeakyBucket).Limit(1).BuildStore(store) })
+	assert.Panics(t, func() { Builder().Algorithm(AlgorithmGCRA).BuildStore(store) })
+	assert.Panics(t, func() { NewStoreFixedWindows(store, 0) })
+	assert.Panics(t, func() { NewStoreFixedWindows(store, 1, 0) })
+	assert.Panics(t, func() { NewStoreTokenBucket(store, 0, 1) })
+	assert.Panics(t, func() { NewStoreTokenBucket(store, 1, 0) })
+	assert.Panics(t, func() { NewStoreTokenBucket(store, 1, 1, -time.Second) })
+}
+
+// TestStoreLimiter_MultiNode checks that the limit is global across nodes
+// sharing a store served over TCP, under concurrent requests.
+func TestStoreLimiter_MultiNode(t *testing.T) {
+	const limit = 5
+	first := startStoreServer(t, NewMemoryStore())
+	nodes := []Store{first}
+	for i := 0; i < 2; i++ {
+		node, err := DialStore(first.conn.RemoteAddr().String())
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, node.Close()) }()
+		nodes = append(nodes, node)
+	}
+
+	for _, algorithm := range []Algorithm{
+		AlgorithmFixedWindows,
+		AlgorithmSlidingWindowCount,
+		AlgorithmTokenBucket,
+		AlgorithmGCRA,
+	} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			var allowed atomic.Int64
+			var wg sync.WaitGroup
+			for _, store := range nodes {
+				l := Builder().Algorithm(algorithm).Limit(limit).Interval(time.Hour).BuildStore(store)
+				for i := 0; i < 2*limit; i++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						d, err := l.Decide(context.Background(), "global", 1)
+						assert.NoError(t, err)
+						if d.Allowed {
+							allowed.Add(1)
+						}
+					}()
+				}
+			}
+			wg.Wait()
+			assert.Equal(t, int64(limit), allowed.Load())
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package ratelimiter
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrStoreClosed is returned by a RemoteStore once it is closed.
+var ErrStoreClosed = errors.New("store closed")
+
+// storeOp is an operation of the store protocol.
+type storeOp uint8
+
+const (
+	storeOpGet storeOp = iota + 1
+	storeOpCompareAndSwap
+	storeOpIncrBy
+)
+
+// storeRequest is a request of the store protocol, gob-encoded on the connection.
+type storeRequest struct {
+	Op       storeOp
+	Key      string
+	Old      []byte
+	HasOld   bool // gob does not tell a nil slice from an empty one
+	New      []byte
+	Delta    int64
+	TTL      time.Duration
+	Deadline time.Time
+}
+
+// storeResponse is the response to a storeRequest.
+type storeResponse struct {
+	Value   []byte
+	Found   bool
+	Swapped bool
+	N       int64
+	Err     string
+}
+
+// StoreServer serves a Store over TCP, so that the limiters of several processes
+// can share it through RemoteStore. It is meant to test multi-node behavior locally.
+type StoreServer struct {
+	store Store
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// NewStoreServer creates a new server serving the store.
+func NewStoreServer(store Store) *StoreServer {
+	return &StoreServer{
+		store:     store,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// Serve accepts the connections of the listener and serves them, until the server is closed.
+// It returns nil once the server is closed, or the error accepting a connection.
+func (s *StoreServer) Serve(l net.Listener) error {
+	if !s.track(l, nil) {
+		return ErrStoreClosed
+	}
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			delete(s.listeners, l)
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		if !s.track(nil, conn) {
+			return errors.Join(conn.Close(), ErrStoreClosed)
+		}
+		s.wg.Add(1)
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops the listeners, closes the connections and waits for them to be done.
+func (s *StoreServer) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var errs []error
+	for l := range s.listeners {
+		errs = append(errs, l.Close())
+	}
+	for conn := range s.conns {
+		errs = append(errs, conn.Close())
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return errors.Join(errs...)
+}
+
+// track records the listener or the connection, unless the server is closed.
+func (s *StoreServer) track(l net.Listener, conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	if l != nil {
+		s.listeners[l] = struct{}{}
+	}
+	if conn != nil {
+		s.conns[conn] = struct{}{}
+	}
+	return true
+}
+
+// serveConn handles the requests of the connection one after the other, until it is closed.
+func (s *StoreServer) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	dec := gob.NewDecoder(conn)
+	enc := gob.NewEncoder(conn)
+	for {
+		var req storeRequest
+		if err := dec.Decode(&req); err != nil {
+			return
+		}
+		resp := s.handle(&req)
+		if err := enc.Encode(&resp); err != nil {
+			return
+		}
+	}
+}
+
+// handle applies the request to the store, within the deadline of the client.
+func (s *StoreServer) handle(req *storeRequest) storeResponse {
+	ctx := context.Background()
+	if !req.Deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, req.Deadline)
+		defer cancel()
+	}
+
+	var resp storeResponse
+	var err error
+	switch req.Op {
+	case storeOpGet:
+		resp.Value, err = s.store.Get(ctx, req.Key)
+		resp.Found = resp.Value != nil
+	case storeOpCompareAndSwap:
+		var old []byte
+		if req.HasOld {
+			old = req.Old
+			if old == nil {
+				old = []byte{}
+			}
+		}
+		resp.Swapped, err = s.store.CompareAndSwap(ctx, req.Key, old, req.New, req.TTL)
+	case storeOpIncrBy:
+		resp.N, err = s.store.IncrBy(ctx, req.Key, req.Delta, req.TTL)
+	default:
+		err = fmt.Errorf("unknown store operation %d", req.Op)
+	}
+	if err != nil {
+		resp.Err = err.Error()
+	}
+	return resp
+}
+
+// RemoteStore is a Store served by a StoreServer.
+// Its requests are sent one after the other on a single connection, which is closed
+// if a request fails to be sent or answered, and dialed again by the next request.
+type RemoteStore struct {
+	addr   string
+	mu     sync.Mutex
+	conn   net.Conn // nil once broken, until dialed again
+	enc    *gob.Encoder
+	dec    *gob.Decoder
+	closed bool
+}
+
+// DialStore connects to the StoreServer at the address.
+func DialStore(addr string) (*RemoteStore, error) {
+	s := &RemoteStore{addr: addr}
+	if err := s.dial(context.Background()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// dial connects to the server. It must be called with the lock held.
+func (s *RemoteStore) dial(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	s.conn, s.enc, s.dec = conn, gob.NewEncoder(conn), gob.NewDecoder(conn)
+	return nil
+}
+
+// Get returns the value of the key, nil if it does not exist.
+func (s *RemoteStore) Get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := s.do(ctx, &storeRequest{Op: storeOpGet, Key: key})
+	if err != nil || !resp.Found {
+		return nil, err
+	}
+	if resp.Value == nil {
+		return []byte{}, nil
+	}
+	return resp.Value, nil
+}
+
+// CompareAndSwap sets the value of the key to newValue if its value is oldValue, see Store.
+func (s *RemoteStore) CompareAndSwap(ctx context.Context, key string, oldValue, newValue []byte, ttl time.Duration) (bool, error) {
+	resp, err := s.do(ctx, &storeRequest{
+		Op: storeOpCompareAndSwap, Key: key, Old: oldValue, HasOld: oldValue != nil, New: newValue, TTL: ttl,
+	})
+	return resp.Swapped, err
+}
+
+// IncrBy adds delta to the integer value of the key, see Store.
+func (s *RemoteStore) IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	resp, err := s.do(ctx, &storeRequest{Op: storeOpIncrBy, Key: key, Delta: delta, TTL: ttl})
+	return resp.N, err
+}
+
+// Close closes the connection to the server.
+func (s *RemoteStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+// do sends the request and waits for its response until the deadline of the context,
+// connecting again to the server if the connection is broken.
+// The connection is closed if the exchange fails, since it is then out of sync.
+func (s *RemoteStore) do(ctx context.Context, req *storeRequest) (storeResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return storeResponse{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return storeResponse{}, ErrStoreClosed
+	}
+	if s.conn == nil {
+		if err := s.dial(ctx); err != nil {
+			return storeResponse{}, err
+		}
+	}
+
+	req.Deadline, _ = ctx.Deadline()
+	var resp storeResponse
+	err := s.conn.SetDeadline(req.Deadline)
+	if err == nil {
+		err = s.enc.Encode(req)
+	}
+	if err == nil {
+		err = s.dec.Decode(&resp)
+	}
+	if err != nil {
+		conn := s.conn
+		s.conn = nil
+		return storeResponse{}, errors.Join(err, conn.Close())
+	}
+	if resp.Err != "" {
+		return storeResponse{}, errors.New(resp.Err)
+	}
+	return resp, nil
+}
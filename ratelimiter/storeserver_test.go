@@ -0,0 +1,70 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowStore is a Store answering after a delay.
+type slowStore struct {
+	Store
+	delay time.Duration
+}
+
+func (s slowStore) Get(ctx context.Context, key string) ([]byte, error) {
+	time.Sleep(s.delay)
+	return s.Store.Get(ctx, key)
+}
+
+func TestRemoteStore_Errors(t *testing.T) {
+	client := startStoreServer(t, slowStore{Store: NewMemoryStore(), delay: 50 * time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := client.Get(ctx, "key")
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// the connection is out of sync once a response is not received in time
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = client.Get(ctx, "key")
+	var netErr net.Error
+	assert.True(t, errors.As(err, &netErr) && netErr.Timeout(), "Expected a timeout, got %v", err)
+	assert.Nil(t, client.conn, "Expected the connection to be closed")
+
+	// the next request connects again
+	n, err := client.IncrBy(context.Background(), "key", 1, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
+
+func TestStoreServer_Close(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := NewStoreServer(NewMemoryStore())
+	done := make(chan error, 1)
+	go func() { done <- server.Serve(l) }()
+
+	client, err := DialStore(l.Addr().String())
+	require.NoError(t, err)
+	_, err = client.IncrBy(context.Background(), "key", 1, 0)
+	require.NoError(t, err)
+
+	assert.NoError(t, server.Close())
+	assert.NoError(t, <-done)
+	_, err = client.IncrBy(context.Background(), "key", 1, 0)
+	assert.Error(t, err, "Expected the connection to be closed by the server")
+	assert.NoError(t, client.Close())
+	_, err = client.Get(context.Background(), "key")
+	assert.ErrorIs(t, err, ErrStoreClosed)
+
+	assert.ErrorIs(t, server.Serve(l), ErrStoreClosed)
+	_, err = DialStore(l.Addr().String())
+	assert.Error(t, err)
+}
@@ -0,0 +1,119 @@
+package ratelimiter
+
+import (
+	"context"
+	"io"
+)
+
+// Reader is an io.Reader whose throughput is limited to a number of bytes per interval,
+// each byte read taking a token of the limiter.
+// Sharing the limiter between several readers and writers caps their aggregate throughput.
+type Reader struct {
+	r         io.Reader
+	limiter   Limiter
+	ctx       context.Context
+	chunkSize int // The most bytes read at once, the burst of the limiter if 0
+}
+
+// NewReader returns a reader reading from r no faster than the limiter allows.
+func NewReader(r io.Reader, limiter Limiter) *Reader {
+	return &Reader{r: r, limiter: limiter, ctx: context.Background()}
+}
+
+// WithContext returns a copy of the reader whose reads stop waiting for the limiter once the context is done.
+func (r *Reader) WithContext(ctx context.Context) *Reader {
+	r2 := *r
+	r2.ctx = ctx
+	return &r2
+}
+
+// WithChunkSize returns a copy of the reader reading up to n bytes at once, instead of the burst of the limiter.
+// It panics if n is not positive.
+func (r *Reader) WithChunkSize(n int) *Reader {
+	if n <= 0 {
+		panic("chunk size must be greater than 0")
+	}
+	r2 := *r
+	r2.chunkSize = n
+	return &r2
+}
+
+// Read reads up to the chunk size, and waits for the tokens of the bytes read.
+// It returns the error of WaitN along with the bytes read if the wait fails.
+func (r *Reader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return r.r.Read(p)
+	}
+	n, err := r.r.Read(p[:min(len(p), chunkSize(r.chunkSize, r.limiter))])
+	if n > 0 {
+		if werr := r.limiter.WaitN(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// Writer is an io.Writer whose throughput is limited to a number of bytes per interval,
+// each byte written taking a token of the limiter.
+// Sharing the limiter between several readers and writers caps their aggregate throughput.
+type Writer struct {
+	w         io.Writer
+	limiter   Limiter
+	ctx       context.Context
+	chunkSize int // The most bytes written at once, the burst of the limiter if 0
+}
+
+// NewWriter returns a writer writing to w no faster than the limiter allows.
+func NewWriter(w io.Writer, limiter Limiter) *Writer {
+	return &Writer{w: w, limiter: limiter, ctx: context.Background()}
+}
+
+// WithContext returns a copy of the writer whose writes stop waiting for the limiter once the context is done.
+func (w *Writer) WithContext(ctx context.Context) *Writer {
+	w2 := *w
+	w2.ctx = ctx
+	return &w2
+}
+
+// WithChunkSize returns a copy of the writer writing up to n bytes at once, instead of the burst of the limiter.
+// It panics if n is not positive.
+func (w *Writer) WithChunkSize(n int) *Writer {
+	if n <= 0 {
+		panic("chunk size must be greater than 0")
+	}
+	w2 := *w
+	w2.chunkSize = n
+	return &w2
+}
+
+// Write splits p into chunks of the chunk size, and writes each of them once
+// its tokens are available. It returns the number of bytes written before the first error.
+func (w *Writer) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		chunk := p[:min(len(p), chunkSize(w.chunkSize, w.limiter))]
+		if err := w.limiter.WaitN(w.ctx, len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := w.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// chunkSize returns the number of bytes read or written at once: the size if set, or else the burst
+// of the limiter, the most tokens it can provide at once. The limiters not implementing Burster,
+// whose burst is unknown, are read from and written to a byte at a time.
+func chunkSize(size int, l Limiter) int {
+	if size > 0 {
+		return size
+	}
+	if b, ok := l.(Burster); ok {
+		return max(b.Burst(), 1)
+	}
+	return 1
+}
@@ -0,0 +1,100 @@
+package ratelimiter
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// chunkWriter records the size of the chunks written.
+type chunkWriter struct {
+	bytes.Buffer
+	chunks []int
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	w.chunks = append(w.chunks, len(p))
+	return w.Buffer.Write(p)
+}
+
+// advanceWhileWaiting advances the clock by each of the delays, once a timer waits for it.
+func advanceWhileWaiting(clock *FakeClock, delays ...time.Duration) {
+	for _, d := range delays {
+		clock.BlockUntil(1)
+		clock.Advance(d)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	l := NewTokenBucket(100, 100, 100*time.Millisecond).WithClock(clock)
+	data := bytes.Repeat([]byte("x"), 250)
+
+	w := &chunkWriter{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		n, err := NewWriter(w, l).Write(data)
+		assert.NoError(t, err)
+		assert.Equal(t, len(data), n)
+	}()
+	advanceWhileWaiting(clock, 100*time.Millisecond, 100*time.Millisecond)
+	<-done
+	assert.Equal(t, []int{100, 100, 50}, w.chunks, "Expected the writes to be split into bursts")
+	assert.Equal(t, data, w.Bytes())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	n, err := NewWriter(w, l).WithContext(ctx).Write(data)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 0, n)
+}
+
+func TestChunkSize(t *testing.T) {
+	l := NewTokenBucket(100, 100)
+	assert.Equal(t, 100, chunkSize(0, l))
+	assert.Equal(t, 10, chunkSize(10, l))
+	assert.Equal(t, 20, chunkSize(0, NewWarmUpBucket(20, time.Second)), "Expected the stable rate of a warm-up bucket")
+	assert.Equal(t, 5, chunkSize(0, NewMulti(NewTokenBucket(10, 5), NewFixedWindows(8, time.Second))))
+	assert.Equal(t, 1, chunkSize(0, struct{ Limiter }{l}), "Expected a byte at a time without a known burst")
+
+	w := &chunkWriter{}
+	n, err := NewWriter(w, l).WithChunkSize(40).Write(bytes.Repeat([]byte("x"), 100))
+	assert.NoError(t, err)
+	assert.Equal(t, 100, n)
+	assert.Equal(t, []int{40, 40, 20}, w.chunks)
+	assert.Panics(t, func() { NewReader(bytes.NewReader(nil), l).WithChunkSize(0) })
+}
+
+func TestReader(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	l := NewTokenBucket(100, 100, 100*time.Millisecond).WithClock(clock)
+	data := bytes.Repeat([]byte("x"), 250)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		read, err := io.ReadAll(NewReader(bytes.NewReader(data), l))
+		assert.NoError(t, err)
+		assert.Equal(t, data, read)
+	}()
+	advanceWhileWaiting(clock, 100*time.Millisecond, 100*time.Millisecond)
+	<-done
+
+	// the readers sharing the limiter wait for each other
+	clock.Advance(time.Second)
+	r1, r2 := NewReader(bytes.NewReader(data), l), NewReader(bytes.NewReader(data), l)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	p := make([]byte, len(data))
+	n, err := r1.Read(p)
+	assert.NoError(t, err)
+	assert.Equal(t, 100, n)
+	n, err = r2.WithContext(ctx).Read(p)
+	assert.ErrorIs(t, err, ErrWaitExceedsDeadline)
+	assert.Equal(t, 100, n, "Expected the bytes read to be returned with the error")
+}
@@ -1,6 +1,8 @@
 package ratelimiter
 
 import (
+	"context"
+	"math"
 	"sync"
 	"time"
 )
@@ -36,6 +38,11 @@ type TokenBucket struct {
 
 	// lastTime is the time of the last token generation.
 	lastTime time.Time
+
+	// lastEvent is the latest time to act of the reservations.
+	lastEvent time.Time
+
+	clock Clock
 }
 
 // NewTokenBucket creates a new token bucket limiter.
@@ -46,6 +53,7 @@ func NewTokenBucket(rate float64, capacity int, interval ...time.Duration) *Toke
 		tokens:   float64(capacity), // initialize with full capacity
 		interval: time.Second,       // default interval is 1 second
 		lastTime: time.Now(),        // initialize lastTime to current time
+		clock:    realClock{},
 	}
 
 	if len(interval) > 0 {
@@ -62,17 +70,99 @@ func (l *TokenBucket) Allow() bool {
 
 // AllowN returns true if the limiter allows n tokens to be processed.
 func (l *TokenBucket) AllowN(n int) bool {
+	return l.reserveN(l.clock.Now(), n, 0).OK()
+}
+
+// Wait blocks until the limiter allows 1 token to be processed or the context is done.
+func (l *TokenBucket) Wait(ctx context.Context) error {
+	return l.WaitN(ctx, 1)
+}
+
+// WaitN blocks until the limiter allows n tokens to be processed.
+// It returns an error if n exceeds the capacity, the context is done,
+// or the wait would exceed the context deadline.
+func (l *TokenBucket) WaitN(ctx context.Context, n int) error {
+	return waitN(ctx, l.clock, l, n)
+}
+
+// Reserve reserves 1 token, which becomes available after the reservation delay.
+func (l *TokenBucket) Reserve() *Reservation {
+	return l.ReserveN(1)
+}
+
+// ReserveN reserves n tokens, which become available after the reservation delay.
+// The reservation is not OK if n exceeds the capacity.
+func (l *TokenBucket) ReserveN(n int) *Reservation {
+	return l.reserveN(l.clock.Now(), n, InfDuration)
+}
+
+// reserveN takes n tokens from the bucket, which may go into debt
+// if the missing tokens are generated within maxWait.
+func (l *TokenBucket) reserveN(now time.Time, n int, maxWait time.Duration) *Reservation {
 	l.mu.Lock()
 	defer l.mu.Unlock()
+	return l.reserve(now, n, maxWait)
+}
 
-	l.advance(time.Now())
+// reserve is reserveN with the lock held.
+func (l *TokenBucket) reserve(now time.Time, n int, maxWait time.Duration) *Reservation {
+	if n > l.capacity {
+		return &Reservation{}
+	}
 
-	if float64(n) > l.tokens {
-		return false
+	l.advance(now)
+
+	tokens := l.tokens - float64(n)
+	timeToAct := now
+	if tokens < 0 {
+		if l.rate <= 0 {
+			return &Reservation{}
+		}
+		// the missing tokens are generated at the end of the next intervals
+		intervals := time.Duration(math.Ceil(-tokens / l.rate))
+		timeToAct = l.lastTime.Add(intervals * l.interval)
+	}
+	if timeToAct.Sub(now) > maxWait {
+		return &Reservation{timeToAct: timeToAct}
 	}
 
-	l.tokens -= float64(n)
-	return true
+	l.tokens = tokens
+	if timeToAct.After(l.lastEvent) {
+		l.lastEvent = timeToAct
+	}
+	return &Reservation{ok: true, tokens: n, timeToAct: timeToAct, limiter: l, clock: l.clock}
+}
+
+// cancel returns the reserved tokens to the bucket, except the ones generated
+// between the time to act of the reservation and the latest one, which have been
+// promised to later reservations.
+func (l *TokenBucket) cancel(r *Reservation, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if r.tokens == 0 || !r.timeToAct.After(now) {
+		return
+	}
+	intervals := l.lastEvent.Sub(r.timeToAct) / l.interval
+	restore := float64(r.tokens) - float64(intervals)*l.rate
+	r.tokens = 0
+	if restore <= 0 {
+		return
+	}
+
+	l.advance(now)
+	l.tokens = min(l.tokens+restore, float64(l.capacity))
+}
+
+// refund returns all the tokens of the reservation to the bucket, whenever it acts.
+func (l *TokenBucket) refund(r *Reservation) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if r.tokens == 0 {
+		return
+	}
+	l.tokens = min(l.tokens+float64(r.tokens), float64(l.capacity))
+	r.tokens = 0
 }
 
 // advance advances the limiter to the next time interval,
@@ -96,6 +186,109 @@ func (l *TokenBucket) advance(n time.Time) {
 	l.lastTime = l.lastTime.Add(l.interval * intervalCount)
 }
 
+// Decide reports whether 'n' requests may happen now, counting them if so,
+// along with the tokens remaining in the bucket.
+func (l *TokenBucket) Decide(n int) Decision {
+	_, d := l.decide(l.clock.Now(), n)
+	return d
+}
+
+// decide is Decide at now, also returning the reservation of the allowed requests.
+func (l *TokenBucket) decide(now time.Time, n int) (*Reservation, Decision) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r := l.reserve(now, n, 0)
+	return r, newDecision(now, r, l.quota(now))
+}
+
+// quota returns the quota of the bucket, whose tokens may be in debt.
+// It must be called with the lock held.
+func (l *TokenBucket) quota(now time.Time) quota {
+	l.advance(now)
+	q := quota{limit: l.capacity, remaining: max(int(l.tokens), 0), resetAt: now}
+	if missing := float64(l.capacity) - l.tokens; missing > 0 && l.rate > 0 {
+		// the bucket is full once the missing tokens are generated
+		intervals := time.Duration(math.Ceil(missing / l.rate))
+		q.resetAt = l.lastTime.Add(intervals * l.interval)
+	}
+	return q
+}
+
+// Burst returns the capacity of the bucket.
+func (l *TokenBucket) Burst() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.capacity
+}
+
+// WithClock sets the clock of the limiter, which defaults to the time package, and returns the limiter,
+// as in NewTokenBucket(10, 10).WithClock(clock).
+func (l *TokenBucket) WithClock(clock Clock) *TokenBucket {
+	l.setClock(clock)
+	return l
+}
+
+// setClock replaces the clock of the limiter, from which the bucket is refilled.
+func (l *TokenBucket) setClock(clock Clock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.clock = clock
+	l.lastTime = clock.Now()
+	l.lastEvent = time.Time{}
+}
+
+// currentClock returns the clock of the limiter.
+func (l *TokenBucket) currentClock() Clock {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.clock
+}
+
+// SetLimit changes the number of tokens generated per interval, see SetRate.
+func (l *TokenBucket) SetLimit(limit int) {
+	if limit <= 0 {
+		panic("limit must be greater than 0")
+	}
+	l.SetRate(float64(limit))
+}
+
+// SetRate changes the number of tokens generated per interval, which may be fractional
+// as the rate given to NewTokenBucket. The tokens of the intervals already over are generated at the former rate.
+func (l *TokenBucket) SetRate(rate float64) {
+	if !(rate > 0) {
+		panic("rate must be greater than 0")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.advance(l.clock.Now())
+	l.rate = rate
+}
+
+// SetBurst changes the capacity of the bucket, dropping the tokens in excess.
+func (l *TokenBucket) SetBurst(burst int) {
+	if burst <= 0 {
+		panic("burst must be greater than 0")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.advance(l.clock.Now())
+	l.capacity = burst
+	l.tokens = min(l.tokens, float64(burst))
+}
+
+// SetInterval changes the interval at which tokens are generated.
+// The tokens of the intervals already over are generated first, and the next ones
+// are generated one new interval after the last generation.
+func (l *TokenBucket) SetInterval(interval time.Duration) {
+	if interval <= 0 {
+		panic("interval must be greater than 0")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.advance(l.clock.Now())
+	l.interval = interval
+}
+
 func (l *TokenBucket) Tokens() int {
 	l.mu.Lock()
 	defer l.mu.Unlock()
@@ -103,13 +296,19 @@ func (l *TokenBucket) Tokens() int {
 }
 
 func (l *TokenBucket) Capacity() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	return l.capacity
 }
 
 func (l *TokenBucket) Rate() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	return l.rate
 }
 
 func (l *TokenBucket) Interval() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	return l.interval
 }
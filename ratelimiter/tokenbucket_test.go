@@ -1,6 +1,7 @@
 package ratelimiter
 
 import (
+	"math"
 	"testing"
 	"time"
 
@@ -11,7 +12,8 @@ func TestTokenBucket_ShouldWork(t *testing.T) {
 	const rate = 10
 	const capacity = 100
 
-	rl := NewTokenBucket(rate, capacity, time.Millisecond)
+	clock := NewFakeClock(time.Now())
+	rl := NewTokenBucket(rate, capacity, time.Millisecond).WithClock(clock)
 	assert.Equal(t, capacity, rl.Tokens())
 	assert.Equal(t, capacity, rl.Capacity())
 	assert.Equal(t, float64(rate), rl.Rate())
@@ -27,8 +29,8 @@ func TestTokenBucket_ShouldWork(t *testing.T) {
 		assert.False(t, rl.Allow())
 	}
 
-	// sleep for 1 interval to generate new tokens
-	time.Sleep(time.Millisecond)
+	// advance 1 interval to generate new tokens
+	clock.Advance(time.Millisecond)
 	for i := 0; i < rate; i++ {
 		assert.True(t, rl.Allow())
 	}
@@ -38,9 +40,109 @@ func TestTokenBucket_ShouldWork(t *testing.T) {
 		assert.False(t, rl.Allow())
 	}
 
-	// sleep lots of intervals, new tokens should be allowed
+	// advance lots of intervals, new tokens should be allowed
 	// and tokens should be replenished.
-	time.Sleep(time.Millisecond * 10)
+	clock.Advance(time.Millisecond * 10)
 	assert.True(t, rl.Allow())
 	assert.Equal(t, capacity-1, rl.Tokens())
 }
+
+func TestTokenBucket_Reserve(t *testing.T) {
+	const interval = 100 * time.Millisecond
+	rl := NewTokenBucket(1, 2, interval)
+	now := rl.lastTime
+
+	r := rl.reserveN(now, 2, InfDuration)
+	assert.True(t, r.OK())
+	assert.Equal(t, time.Duration(0), r.DelayFrom(now))
+
+	// the bucket goes into debt, the tokens are generated at the end of the next intervals
+	r = rl.reserveN(now, 1, InfDuration)
+	assert.Equal(t, interval, r.DelayFrom(now))
+	r = rl.reserveN(now.Add(interval/2), 1, InfDuration)
+	assert.Equal(t, 2*interval-interval/2, r.DelayFrom(now.Add(interval/2)))
+
+	// more than the capacity or beyond the maximum wait should not be reserved
+	assert.False(t, rl.reserveN(now, 3, InfDuration).OK())
+	assert.False(t, rl.reserveN(now, 1, 2*interval).OK())
+	assert.False(t, rl.reserveN(now, 1, 0).OK())
+	assert.Equal(t, -2, rl.Tokens())
+
+	r = rl.reserveN(now, 1, 3*interval)
+	assert.Equal(t, 3*interval, r.DelayFrom(now))
+}
+
+func TestTokenBucket_Cancel(t *testing.T) {
+	const interval = 100 * time.Millisecond
+	rl := NewTokenBucket(1, 3, interval)
+	now := rl.lastTime
+
+	acted := rl.reserveN(now, 2, InfDuration)
+	r1 := rl.reserveN(now, 2, InfDuration) // 1 token generated after an interval
+	r2 := rl.reserveN(now, 1, InfDuration) // after two intervals
+
+	// the tokens of an acted reservation are not returned
+	acted.CancelAt(now)
+	assert.Equal(t, -2, rl.Tokens())
+
+	// the token generated between r1 and r2 is promised to r2
+	r1.CancelAt(now)
+	assert.Equal(t, -1, rl.Tokens())
+	r1.CancelAt(now)
+	assert.Equal(t, -1, rl.Tokens(), "Expected a second cancellation to do nothing")
+
+	r2.CancelAt(now)
+	assert.Equal(t, 0, rl.Tokens())
+
+	// the reservation acts when its token is generated
+	rl.reserveN(now, 1, InfDuration).CancelAt(now.Add(interval))
+	assert.False(t, rl.reserveN(now.Add(interval), 1, 0).OK(), "Expected the token to stay consumed")
+}
+
+func TestTokenBucket_Reconfigure(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	tb := NewTokenBucket(2, 4, time.Second).WithClock(clock)
+
+	assert.True(t, tb.AllowN(4))
+	tb.SetLimit(4)
+	clock.Advance(time.Second)
+	assert.True(t, tb.AllowN(4), "Expected the tokens to be generated at the new rate")
+	assert.False(t, tb.Allow())
+
+	tb.SetBurst(2)
+	clock.Advance(time.Second)
+	assert.False(t, tb.AllowN(3), "Expected the requests beyond the new capacity to be rejected")
+	assert.True(t, tb.AllowN(2))
+
+	tb.SetInterval(2 * time.Second)
+	clock.Advance(time.Second)
+	assert.False(t, tb.Allow())
+	clock.Advance(time.Second)
+	assert.True(t, tb.AllowN(2))
+	assert.Equal(t, 4.0, tb.Rate())
+	assert.Equal(t, 2, tb.Capacity())
+	assert.Equal(t, 2*time.Second, tb.Interval())
+
+	// the tokens in excess are dropped
+	clock.Advance(time.Minute)
+	tb.SetBurst(1)
+	assert.Equal(t, 1, tb.Tokens())
+	assert.Panics(t, func() { tb.SetLimit(0) })
+}
+
+func TestTokenBucket_SetRate(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	tb := NewTokenBucket(0.5, 1, time.Second).WithClock(clock)
+
+	assert.True(t, tb.Allow())
+	tb.SetLimit(1)
+	tb.SetRate(0.5)
+	assert.Equal(t, 0.5, tb.Rate(), "Expected the fractional rate to be restored")
+	clock.Advance(time.Second)
+	assert.False(t, tb.Allow())
+	clock.Advance(time.Second)
+	assert.True(t, tb.Allow())
+
+	assert.Panics(t, func() { tb.SetRate(0) })
+	assert.Panics(t, func() { tb.SetRate(math.NaN()) })
+}
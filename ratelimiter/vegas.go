@@ -0,0 +1,93 @@
+package ratelimiter
+
+import (
+	"math"
+	"time"
+)
+
+// defaultVegasProbeMultiplier is the number of windows of requests after which
+// Vegas measures again the latency without load by default.
+const defaultVegasProbeMultiplier = 30
+
+// Vegas is an AdaptiveAlgorithm estimating the number of requests queued downstream
+// from the increase of their latency over the latency without load, like TCP Vegas.
+// The limit increases while the queue is small and decreases once it is large,
+// the thresholds growing logarithmically with the limit.
+// Like TCP Vegas, the limit is adjusted about once per window of 'limit' requests,
+// each sample applying 1/limit of the adjustment.
+type Vegas struct {
+	probeMultiplier int
+	rttNoLoad       time.Duration // The minimum latency since the last probe
+	probeCount      int           // The samples since the last probe
+	probing         int           // The samples left in the current probe, zero if not probing
+	probeLimit      float64       // The limit before the current probe
+	probeRTT        time.Duration // The minimum latency during the current probe
+}
+
+// NewVegas creates a new Vegas algorithm. The latency without load is the minimum latency,
+// probed again every 'probeMultiplier' windows of requests, 30 if not provided, 0 to never probe.
+// Like the ProbeRTT state of TCP BBR, a probe halves the limit for two windows of requests
+// to measure the latency with fewer requests in flight, so that the limit recovers once
+// the downstream latency has increased for good.
+func NewVegas(probeMultiplier ...int) *Vegas {
+	v := &Vegas{probeMultiplier: defaultVegasProbeMultiplier}
+	if len(probeMultiplier) > 0 {
+		v.probeMultiplier = probeMultiplier[0]
+	}
+	return v
+}
+
+// Update adjusts the limit from the queue size estimated from the sample latency.
+func (v *Vegas) Update(limit float64, s Sample) float64 {
+	if v.probing > 0 {
+		return v.probe(limit, s)
+	}
+	v.probeCount++
+	if v.probeMultiplier > 0 && float64(v.probeCount) >= float64(v.probeMultiplier)*limit {
+		v.probeCount = 0
+		v.probing = 2 * int(math.Ceil(limit))
+		v.probeLimit = limit
+		v.probeRTT = 0
+		return limit / 2
+	}
+	if v.rttNoLoad == 0 || s.RTT < v.rttNoLoad {
+		v.rttNoLoad = s.RTT
+		return limit
+	}
+
+	// the thresholds of the queue size, in requests
+	threshold := max(1, math.Log10(limit))
+	alpha, beta := 3*threshold, 6*threshold
+	if s.Dropped {
+		return limit - beta/limit
+	}
+	if appLimited(limit, s) {
+		return limit
+	}
+
+	queue := math.Ceil(limit * (1 - float64(v.rttNoLoad)/float64(s.RTT)))
+	switch {
+	case queue <= threshold:
+		return limit + beta/limit
+	case queue < alpha:
+		return limit + threshold/limit
+	case queue > beta:
+		return limit - threshold/limit
+	default:
+		return limit
+	}
+}
+
+// probe measures the minimum latency while the limit is halved,
+// which becomes the latency without load once the probe is over.
+func (v *Vegas) probe(limit float64, s Sample) float64 {
+	if v.probeRTT == 0 || s.RTT < v.probeRTT {
+		v.probeRTT = s.RTT
+	}
+	v.probing--
+	if v.probing > 0 {
+		return limit
+	}
+	v.rttNoLoad = v.probeRTT
+	return v.probeLimit
+}
@@ -0,0 +1,228 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// warmUpColdFactor is the ratio of the interval between two requests of a cold
+// WarmUpBucket over the one at the stable rate.
+const warmUpColdFactor = 3
+
+// WarmUpBucket is a token bucket ramping the rate up after a cold start, like the
+// SmoothWarmingUp rate limiter of Guava, so that a backend whose caches are empty
+// is not sent its full steady-state rate at once.
+//
+// The bucket stores the permits left unused, up to a maximum. While more than half
+// of them are stored, the bucket is cold and the requests are spaced by an interval
+// decreasing linearly from three times the stable one, so that the bucket warms up to
+// the stable rate over the warm-up period. Unlike a token bucket, the stored permits do
+// not allow bursts: they slow the requests down, and fill up again after being idle,
+// making the bucket cold again after it has been idle for the warm-up period.
+//
+// Like Guava, the requests are allowed as soon as the previous ones are paid for,
+// the later requests waiting for their cost.
+type WarmUpBucket struct {
+	mu       sync.Mutex
+	rate     float64       // The number of requests allowed per interval at the stable rate
+	interval time.Duration // The interval of the rate
+	warmUp   time.Duration // The time to warm up from cold to the stable rate
+
+	stableInterval   float64   // The interval between two requests at the stable rate, in nanoseconds
+	coldInterval     float64   // The interval between two requests when cold, in nanoseconds
+	thresholdPermits float64   // The stored permits from which the bucket is warming up
+	maxPermits       float64   // The maximum stored permits
+	slope            float64   // The increase of the interval per permit stored above the threshold
+	storedPermits    float64   // The permits stored while the bucket was idle
+	nextFree         time.Time // The time the next requests are allowed, once the previous ones are paid for
+	clock            Clock     // The clock telling the time
+}
+
+// NewWarmUpBucket creates a new token bucket allowing 'rate' requests per interval once warmed up,
+// starting cold and warming up over the warm-up period.
+// If no interval is provided, it defaults to 1 second.
+func NewWarmUpBucket(rate float64, warmUp time.Duration, interval ...time.Duration) *WarmUpBucket {
+	if rate <= 0 || warmUp <= 0 {
+		panic("rate and warm-up period must be greater than 0")
+	}
+	l := &WarmUpBucket{rate: rate, interval: time.Second, warmUp: warmUp, clock: realClock{}}
+	if len(interval) > 0 {
+		l.interval = interval[0]
+	}
+	l.configure()
+	l.storedPermits = l.maxPermits
+	return l
+}
+
+// configure computes the shape of the warm-up from the rate, scaling the stored permits
+// to the new maximum. It must be called with the lock held.
+func (l *WarmUpBucket) configure() {
+	oldMaxPermits := l.maxPermits
+	l.stableInterval = float64(l.interval) / l.rate
+	l.coldInterval = l.stableInterval * warmUpColdFactor
+	// warming up from the threshold to the maximum takes twice as long as from zero to the threshold
+	l.thresholdPermits = float64(l.warmUp) / 2 / l.stableInterval
+	l.maxPermits = l.thresholdPermits + 2*float64(l.warmUp)/(l.stableInterval+l.coldInterval)
+	l.slope = (l.coldInterval - l.stableInterval) / (l.maxPermits - l.thresholdPermits)
+	if oldMaxPermits > 0 {
+		l.storedPermits = l.storedPermits * l.maxPermits / oldMaxPermits
+	}
+}
+
+// Allow checks if a single request is allowed now.
+func (l *WarmUpBucket) Allow() bool {
+	return l.AllowN(1)
+}
+
+// AllowN checks if 'n' requests are allowed now, the previous ones having been paid for.
+func (l *WarmUpBucket) AllowN(n int) bool {
+	return l.reserveN(l.clock.Now(), n, 0).OK()
+}
+
+// Wait blocks until a single request is allowed or the context is done.
+func (l *WarmUpBucket) Wait(ctx context.Context) error {
+	return l.WaitN(ctx, 1)
+}
+
+// WaitN blocks until 'n' requests are allowed.
+// It returns an error if the context is done, or the wait would exceed the context deadline.
+func (l *WarmUpBucket) WaitN(ctx context.Context, n int) error {
+	return waitN(ctx, l.clock, l, n)
+}
+
+// Reserve reserves a single request at the time the previous ones are paid for.
+func (l *WarmUpBucket) Reserve() *Reservation {
+	return l.ReserveN(1)
+}
+
+// ReserveN reserves 'n' requests at the time the previous ones are paid for.
+// Canceling the reservation does nothing, its cost has been charged to the next requests.
+func (l *WarmUpBucket) ReserveN(n int) *Reservation {
+	return l.reserveN(l.clock.Now(), n, InfDuration)
+}
+
+// reserveN reserves 'n' requests if the previous ones are paid for within maxWait,
+// delaying the next requests by their cost.
+func (l *WarmUpBucket) reserveN(now time.Time, n int, maxWait time.Duration) *Reservation {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.reserve(now, n, maxWait)
+}
+
+// reserve is reserveN with the lock held.
+func (l *WarmUpBucket) reserve(now time.Time, n int, maxWait time.Duration) *Reservation {
+	l.resync(now)
+	timeToAct := l.nextFree
+	if timeToAct.Sub(now) > maxWait {
+		return &Reservation{timeToAct: timeToAct}
+	}
+
+	// the stored permits cost more the colder the bucket is, the fresh ones cost the stable interval
+	spent := min(float64(n), l.storedPermits)
+	cost := l.storedCost(spent) + (float64(n)-spent)*l.stableInterval
+	l.storedPermits -= spent
+	l.nextFree = l.nextFree.Add(time.Duration(cost))
+	return &Reservation{ok: true, tokens: n, timeToAct: timeToAct, clock: l.clock}
+}
+
+// resync stores the permits of the time the bucket has been idle, at the rate making it
+// cold again after the warm-up period.
+func (l *WarmUpBucket) resync(now time.Time) {
+	if !now.After(l.nextFree) {
+		return
+	}
+	coolDownInterval := float64(l.warmUp) / l.maxPermits
+	l.storedPermits = min(l.maxPermits, l.storedPermits+float64(now.Sub(l.nextFree))/coolDownInterval)
+	l.nextFree = now
+}
+
+// storedCost returns the time spent by taking 'n' of the stored permits: the area under the interval
+// of the permits above the threshold, which grows linearly up to the cold interval, and the stable
+// interval for the ones below it.
+func (l *WarmUpBucket) storedCost(n float64) float64 {
+	var cost float64
+	if above := l.storedPermits - l.thresholdPermits; above > 0 {
+		taken := min(above, n)
+		cost = taken * (l.permitInterval(above) + l.permitInterval(above-taken)) / 2
+		n -= taken
+	}
+	return cost + n*l.stableInterval
+}
+
+// permitInterval returns the interval of the permit stored 'above' permits above the threshold.
+func (l *WarmUpBucket) permitInterval(above float64) float64 {
+	return l.stableInterval + above*l.slope
+}
+
+// Decide reports whether 'n' requests are allowed now, counting them if so.
+// The bucket spaces the requests, so a single batch of requests is allowed at once,
+// and the limit is reset once the next requests are allowed.
+func (l *WarmUpBucket) Decide(n int) Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	r := l.reserve(now, n, 0)
+	q := quota{limit: 1, resetAt: l.nextFree}
+	if !l.nextFree.After(now) {
+		q.remaining = 1
+	}
+	return newDecision(now, r, q)
+}
+
+// SetLimit changes the number of requests allowed per interval once warmed up,
+// the stored permits keeping the bucket as cold as it was.
+func (l *WarmUpBucket) SetLimit(limit int) {
+	if limit <= 0 {
+		panic("limit must be greater than 0")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.resync(l.clock.Now())
+	l.rate = float64(limit)
+	l.configure()
+}
+
+// SetInterval changes the interval of the rate, the stored permits keeping the bucket as cold as it was.
+func (l *WarmUpBucket) SetInterval(interval time.Duration) {
+	if interval <= 0 {
+		panic("interval must be greater than 0")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.resync(l.clock.Now())
+	l.interval = interval
+	l.configure()
+}
+
+// Burst returns the number of requests allowed per interval at the stable rate. The bucket allows
+// any batch of requests once the previous ones are paid for, but a batch larger than that delays
+// the next requests by more than an interval.
+func (l *WarmUpBucket) Burst() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return max(int(l.rate), 1)
+}
+
+// WithClock sets the clock of the limiter, which defaults to the time package, and returns the limiter,
+// as in NewWarmUpBucket(10, time.Minute).WithClock(clock).
+func (l *WarmUpBucket) WithClock(clock Clock) *WarmUpBucket {
+	l.setClock(clock)
+	return l
+}
+
+// setClock replaces the clock of the limiter, the bucket starting cold.
+func (l *WarmUpBucket) setClock(clock Clock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.clock = clock
+	l.storedPermits = l.maxPermits
+	l.nextFree = time.Time{}
+}
+
+// currentClock returns the clock of the limiter.
+func (l *WarmUpBucket) currentClock() Clock {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.clock
+}
@@ -0,0 +1,60 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// intervals returns the intervals between the next 'n' requests reserved one after the other.
+func intervals(l *WarmUpBucket, n int) []time.Duration {
+	var delays []time.Duration
+	for i := 0; i <= n; i++ {
+		delays = append(delays, l.Reserve().Delay())
+	}
+	for i := 0; i < n; i++ {
+		delays[i] = delays[i+1] - delays[i]
+	}
+	return delays[:n]
+}
+
+func TestWarmUpBucket(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	l := Builder().Algorithm(AlgorithmTokenBucket).Limit(10).WarmUp(2 * time.Second).Clock(clock).Build().(*WarmUpBucket)
+
+	// cold, the requests are spaced by three times the stable interval, decreasing down to it
+	// over the warm-up period
+	cold := []time.Duration{290, 270, 250, 230, 210, 190, 170, 150, 130, 110, 100, 100}
+	for i := range cold {
+		cold[i] *= time.Millisecond
+	}
+	assert.Equal(t, cold, intervals(l, len(cold)))
+
+	// warmed up, the stored permits do not allow bursts
+	clock.Advance(2300 * time.Millisecond)
+	assert.True(t, l.Allow())
+	assert.False(t, l.Allow())
+	d := l.Decide(1)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, 100*time.Millisecond, d.RetryAfter)
+
+	// idle for the warm-up period, the bucket is cold again
+	clock.Advance(2100 * time.Millisecond)
+	assert.Equal(t, cold[:3], intervals(l, 3))
+
+	assert.Panics(t, func() { NewWarmUpBucket(0, time.Second) })
+	assert.Panics(t, func() { NewWarmUpBucket(1, 0) })
+}
+
+func TestWarmUpBucket_SetLimit(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	l := NewWarmUpBucket(10, 2*time.Second).WithClock(clock)
+
+	// the bucket stays as cold as it was, at the new rate
+	l.SetLimit(20)
+	assert.Equal(t, []time.Duration{147500 * time.Microsecond, 142500 * time.Microsecond}, intervals(l, 2))
+	l.SetInterval(2 * time.Second)
+	assert.InDelta(t, float64(100*time.Millisecond), l.stableInterval, 1)
+	assert.InDelta(t, float64(300*time.Millisecond), l.coldInterval, 1)
+}